@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Alert rule types evaluated after each daemon cycle
+const (
+	alertIPUnclaimed     = "ip-unclaimed"
+	alertIPMoved         = "ip-moved"
+	alertDuplicateOwner  = "duplicate-owner"
+	alertNodeUnreachable = "node-unreachable"
+	alertIPFlapping      = "ip-flapping"
+)
+
+// defaultFlapThreshold is how many owner changes within the flap window an
+// ip-flapping rule allows when it sets no threshold
+const defaultFlapThreshold = 3
+
+// alertTimeout bounds each webhook notification
+const alertTimeout = 10 * time.Second
+
+// alertConfig is the --alert-rules file, e.g.
+//
+//	rules:
+//	  - name: vip-flap
+//	    type: ip-moved
+//	    severity: critical
+//	    ips: ["7.10.20.0/28"]
+//	    notify: [oncall]
+//	  - type: node-unreachable
+//	    notify: [syslog]
+//	  - type: ip-flapping
+//	    threshold: 5
+//	targets:
+//	  oncall:
+//	    webhook: https://alerts.example.com/hook
+//
+// The syslog and stdout targets are always available.
+type alertConfig struct {
+	Rules   []alertRule            `json:"rules"`
+	Targets map[string]alertTarget `json:"targets"`
+}
+
+// alertRule fires for a condition found by a cycle. IPs, as IPs, CIDRs or
+// ranges, limits the IP rules to those addresses, and Nodes, as globs, the
+// node-unreachable rule to those nodes. Threshold is how many owner changes
+// within the flap window an ip-flapping rule allows.
+type alertRule struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Severity  string   `json:"severity"`
+	IPs       []string `json:"ips"`
+	Nodes     []string `json:"nodes"`
+	Threshold int      `json:"threshold"`
+	Notify    []string `json:"notify"`
+
+	ips map[string]bool
+}
+
+// alertTarget is where alerts are sent; only webhooks are configurable
+type alertTarget struct {
+	Webhook string `json:"webhook"`
+}
+
+// alert is a single notification, posted as JSON to webhooks
+type alert struct {
+	Rule     string    `json:"rule"`
+	Type     string    `json:"type"`
+	Severity string    `json:"severity"`
+	Subject  string    `json:"subject"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+}
+
+// alertEngine evaluates the rules after each cycle. Standing conditions like
+// an unclaimed IP alert once when they start, not on every cycle.
+type alertEngine struct {
+	config alertConfig
+	firing map[string]bool
+	client *http.Client
+}
+
+// loadAlertRules reads and validates a rules file
+func loadAlertRules(path string) (*alertEngine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config alertConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		switch rule.Type {
+		case alertIPUnclaimed, alertIPMoved, alertDuplicateOwner, alertNodeUnreachable, alertIPFlapping:
+		default:
+			return nil, fmt.Errorf("rule %d has unknown type %q", i+1, rule.Type)
+		}
+		if rule.Name == "" {
+			rule.Name = rule.Type
+		}
+		if rule.Type == alertIPFlapping && rule.Threshold == 0 {
+			rule.Threshold = defaultFlapThreshold
+		}
+		if rule.Severity == "" {
+			rule.Severity = "warning"
+		}
+		if len(rule.Notify) == 0 {
+			rule.Notify = []string{"stdout"}
+		}
+		for _, target := range rule.Notify {
+			if _, ok := config.Targets[target]; !ok && target != "syslog" && target != "stdout" {
+				return nil, fmt.Errorf("rule %s notifies unknown target %q", rule.Name, target)
+			}
+		}
+		if len(rule.IPs) > 0 {
+			rule.ips = make(map[string]bool)
+			for _, entry := range rule.IPs {
+				ips, err := expandIPEntry(entry)
+				if err != nil {
+					return nil, fmt.Errorf("rule %s: %v", rule.Name, err)
+				}
+				for _, ip := range ips {
+					rule.ips[ip] = true
+				}
+			}
+		}
+	}
+	return &alertEngine{config: config, firing: make(map[string]bool), client: &http.Client{Timeout: alertTimeout}}, nil
+}
+
+// appliesTo reports whether the rule covers subject, an IP or a node
+func (r alertRule) appliesTo(subject string) bool {
+	if r.Type == alertNodeUnreachable {
+		return len(r.Nodes) == 0 || matchesAny(r.Nodes, subject)
+	}
+	return r.ips == nil || r.ips[subject]
+}
+
+// evaluate checks the rules against a cycle. ips are the probed IPs, owners
+// the nodes now hosting each one, previous the owners of the last cycle as
+// joined by the daemon, flaps the owner changes of each IP within the flap
+// window and unreachable the nodes that could not be probed.
+func (e *alertEngine) evaluate(ips []string, owners map[string][]string, previous map[string]string, flaps map[string]int, unreachable []string) {
+	if e == nil {
+		return
+	}
+
+	// Conditions found in this cycle, by rule type and subject
+	found := map[string]map[string]string{
+		alertIPUnclaimed:     {},
+		alertIPMoved:         {},
+		alertDuplicateOwner:  {},
+		alertNodeUnreachable: {},
+		alertIPFlapping:      {},
+	}
+	for _, ip := range ips {
+		nodes := owners[ip]
+		switch {
+		case len(nodes) == 0:
+			found[alertIPUnclaimed][ip] = fmt.Sprintf("%s is not hosted by any node", ip)
+		case len(nodes) > 1:
+			found[alertDuplicateOwner][ip] = fmt.Sprintf("%s is hosted by %d nodes: %s", ip, len(nodes), strings.Join(nodes, ", "))
+		}
+		if was, ok := previous[ip]; ok && len(nodes) > 0 && was != strings.Join(nodes, ",") {
+			found[alertIPMoved][ip] = fmt.Sprintf("%s moved from %s to %s", ip, was, strings.Join(nodes, ","))
+		}
+		if flaps[ip] > 0 {
+			found[alertIPFlapping][ip] = fmt.Sprintf("%s changed owner %d times within the flap window", ip, flaps[ip])
+		}
+	}
+	for _, node := range unreachable {
+		found[alertNodeUnreachable][node] = fmt.Sprintf("node %s is unreachable", node)
+	}
+
+	firing := make(map[string]bool)
+	for _, rule := range e.config.Rules {
+		subjects := make([]string, 0, len(found[rule.Type]))
+		for subject := range found[rule.Type] {
+			subjects = append(subjects, subject)
+		}
+		sort.Strings(subjects)
+		for _, subject := range subjects {
+			if !rule.appliesTo(subject) {
+				continue
+			}
+			if rule.Type == alertIPFlapping && flaps[subject] <= rule.Threshold {
+				continue
+			}
+			key := rule.Name + "/" + subject
+			firing[key] = true
+			// Moves are events; the other conditions alert when they start
+			if e.firing[key] && rule.Type != alertIPMoved {
+				continue
+			}
+			e.notify(rule, alert{Rule: rule.Name, Type: rule.Type, Severity: rule.Severity, Subject: subject, Message: found[rule.Type][subject], Time: time.Now()})
+		}
+	}
+	e.firing = firing
+}
+
+// notify sends a to every target of rule. Failed notifications are logged.
+func (e *alertEngine) notify(rule alertRule, a alert) {
+	payload, err := json.Marshal(a)
+	if err != nil {
+		return
+	}
+	logf("alert %s", payload)
+	for _, name := range rule.Notify {
+		switch name {
+		case "stdout":
+			fmt.Printf("%s[%s] %s: %s%s\n", ColorRed, a.Severity, a.Rule, a.Message, ColorReset)
+		case "syslog":
+			if syslogWriter != nil {
+				syslogWriter.Warning(string(payload))
+			}
+		default:
+			resp, err := e.client.Post(e.config.Targets[name].Webhook, "application/json", bytes.NewReader(payload))
+			if err != nil {
+				logf("error sending alert to %s: %v", name, err)
+				continue
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				logf("error sending alert to %s: %s", name, resp.Status)
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// skipAnnotation set to true on a service leaves it out of probing, so
+	// application teams can opt out without central config changes
+	skipAnnotation = "lbip.haribhusal.io/skip"
+	// probeAnnotation set to true enrolls a service in --annotated-only runs
+	probeAnnotation = "lbip.haribhusal.io/probe"
+)
+
+// annotationTrue reports whether service has annotation set to a true value
+// such as "true" or "1"
+func annotationTrue(service corev1.Service, annotation string) bool {
+	value, err := strconv.ParseBool(service.Annotations[annotation])
+	return err == nil && value
+}
+
+// poolAnnotations name the MetalLB pool of a service, under the old and new
+// annotation prefixes. The pool MetalLB allocated from comes before the one
+// the service asked for.
+var poolAnnotations = []string{
+	"metallb.universe.tf/ip-allocated-from-pool",
+	"metallb.io/ip-allocated-from-pool",
+	"metallb.universe.tf/address-pool",
+	"metallb.io/address-pool",
+}
+
+// annotatedPool returns the pool named by service's MetalLB annotations, if
+// any
+func annotatedPool(service corev1.Service) string {
+	for _, annotation := range poolAnnotations {
+		if pool := service.Annotations[annotation]; pool != "" {
+			return pool
+		}
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// inventoryFile is the Ansible inventory generated from the cluster's nodes.
+// With --inventory-out or --inventory-in it points at the user's file, which
+// keepInventory stops from being removed at exit.
+var (
+	inventoryFile = "k8s.inventory"
+	keepInventory bool
+)
+
+// ansiblePath and ansibleExtraArgs are set from --ansible-path and
+// --ansible-extra-args for custom installations, vault passwords or SSH options
+var (
+	ansiblePath      = "ansible"
+	ansibleExtraArgs []string
+)
+
+// interfaceDetectionCommand prints the interface of the routes starting with '7'
+const interfaceDetectionCommand = "ip route | awk '/7/ {print $3}' | head -2"
+
+// ansibleShellArgs returns the ansible arguments that run command with the
+// shell module on the hosts matching pattern in the generated inventory.
+func ansibleShellArgs(pattern, ansibleUsername, command string) []string {
+	return append(ansibleModuleArgs(pattern, ansibleUsername, "shell"), "-a", command)
+}
+
+// ansibleModuleArgs returns the ansible arguments that run module, without
+// module arguments, on the hosts matching pattern in the generated inventory.
+func ansibleModuleArgs(pattern, ansibleUsername, module string) []string {
+	args := []string{"-i", inventoryFile, pattern}
+	if ansibleUsername != "" {
+		args = append(args, "-u", ansibleUsername)
+	}
+	args = append(args, ansibleSSHArgs()...)
+	args = append(args, ansibleExtraArgs...)
+	return append(args, "-m", module)
+}
+
+// splitArgs splits s into arguments the way a shell would, honouring single
+// quotes, double quotes and backslash escapes.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg, escaped := false, false
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// readInventoryNodes returns the hosts of the k8s group in an existing
+// inventory, which every ansible command targets.
+func readInventoryNodes(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []string
+	inGroup := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inGroup = line == "[k8s]"
+			continue
+		}
+		if inGroup {
+			nodes = append(nodes, strings.Fields(line)[0])
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no hosts found in the [k8s] group of %s", path)
+	}
+	return nodes, nil
+}
+
+// macAddressCommand prints the MAC address of iface
+func macAddressCommand(iface string) string {
+	return fmt.Sprintf("cat /sys/class/net/%s/address", iface)
+}
+
+// neighCommand dumps the neighbor table of iface as JSON
+func neighCommand(iface string) string {
+	return fmt.Sprintf("ip -json neigh show dev %s", iface)
+}
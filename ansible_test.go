@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "plain words", input: "-o StrictHostKeyChecking=no", want: []string{"-o", "StrictHostKeyChecking=no"}},
+		{name: "runs of whitespace", input: " -e\t a=1 \n", want: []string{"-e", "a=1"}},
+		{name: "single and double quotes", input: `'a b' "c d"`, want: []string{"a b", "c d"}},
+		{name: "quotes inside a word", input: `-e 'x=1 2'y`, want: []string{"-e", "x=1 2y"}},
+		{name: "escaped space", input: `a\ b`, want: []string{"a b"}},
+		{name: "escaped quote in double quotes", input: `"a \"q\""`, want: []string{`a "q"`}},
+		{name: "backslash is literal in single quotes", input: `'a\b'`, want: []string{`a\b`}},
+		{name: "empty quoted argument", input: `'' x`, want: []string{"", "x"}},
+		{name: "empty input", input: "  ", want: nil},
+		{name: "unterminated quote", input: `"open`, wantErr: true},
+		{name: "trailing backslash", input: `trailing\`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitArgs(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitArgs(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitArgs(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// archiveDayLayout names the dated directories of the report archive
+const archiveDayLayout = "2006-01-02"
+
+// reportArchive keeps the JSON report of every daemon cycle under a
+// directory per day, optionally gzip-compressed, and prunes reports older
+// than retention. A nil reportArchive keeps nothing.
+type reportArchive struct {
+	dir       string
+	compress  bool
+	retention time.Duration
+}
+
+// store writes r, finished at at, into the archive through a rename, so a
+// reader never sees a partial report
+func (a *reportArchive) store(r report, at time.Time) error {
+	if a == nil {
+		return nil
+	}
+	at = at.UTC()
+	dayDir := filepath.Join(a.dir, at.Format(archiveDayLayout))
+	if err := os.MkdirAll(dayDir, 0755); err != nil {
+		return err
+	}
+	name := "report-" + at.Format("150405") + "-" + r.Metadata.RunID + ".json"
+	if a.compress {
+		name += ".gz"
+	}
+	tmp, err := os.CreateTemp(dayDir, "."+name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	var w io.Writer = tmp
+	var gz *gzip.Writer
+	if a.compress {
+		gz = gzip.NewWriter(tmp)
+		w = gz
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dayDir, name))
+}
+
+// prune removes the archived reports older than the retention, and the day
+// directories left empty. Files that are not reports are left alone.
+func (a *reportArchive) prune(now time.Time) error {
+	if a == nil || a.retention <= 0 {
+		return nil
+	}
+	cutoff := now.Add(-a.retention)
+	days, err := os.ReadDir(a.dir)
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		if _, err := time.Parse(archiveDayLayout, day.Name()); err != nil || !day.IsDir() {
+			continue
+		}
+		dayDir := filepath.Join(a.dir, day.Name())
+		reports, err := filepath.Glob(filepath.Join(dayDir, "report-*.json*"))
+		if err != nil {
+			return err
+		}
+		for _, path := range reports {
+			info, err := os.Stat(path)
+			if err != nil || !info.ModTime().Before(cutoff) {
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			logf("pruned archived report %s", path)
+		}
+		// Fails while the directory still holds anything
+		os.Remove(dayDir)
+	}
+	return nil
+}
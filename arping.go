@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// arpingFlavor is the arping implementation installed on a node. They differ
+// in the interface flag and in how a missing reply is reported.
+type arpingFlavor int
+
+const (
+	arpingIputils arpingFlavor = iota
+	arpingBusybox
+	arpingHabets
+)
+
+// arpingFlavorCommand prints the version banner of whichever arping is installed
+const arpingFlavorCommand = "(arping -V; arping --help) 2>&1 | head -5"
+
+func (f arpingFlavor) String() string {
+	switch f {
+	case arpingBusybox:
+		return "busybox"
+	case arpingHabets:
+		return "habets"
+	}
+	return "iputils"
+}
+
+// command arpings ip once from iface
+func (f arpingFlavor) command(iface, ip string) string {
+	switch f {
+	case arpingBusybox:
+		// busybox exits 0 without a reply, so keep its summary line
+		return fmt.Sprintf("arping -I %s -c 1 %s", iface, ip)
+	case arpingHabets:
+		return fmt.Sprintf("arping -q -i %s -c 1 %s", iface, ip)
+	}
+	return fmt.Sprintf("arping -q -I %s %s -c 1", iface, ip)
+}
+
+// ansibleRC matches the exit status in an ad-hoc host header such as
+// "node-1 | FAILED | rc=1 >>"
+var ansibleRC = regexp.MustCompile(`\| rc=(\d+)`)
+
+// noReply reports whether the ansible output of command shows that nothing
+// answered. iputils and Habets arping exit 1 without a reply; any other
+// failure is returned as an error, as the playbook does.
+func (f arpingFlavor) noReply(out string, err error) (bool, error) {
+	if err == nil {
+		return f == arpingBusybox && strings.Contains(out, "Received 0 response"), nil
+	}
+	rc := "unknown"
+	if m := ansibleRC.FindStringSubmatch(out); m != nil {
+		rc = m[1]
+	}
+	if rc == "1" && f != arpingBusybox {
+		return true, nil
+	}
+	return false, fmt.Errorf("%s arping failed (rc=%s): %s", f, rc, strings.TrimSpace(out))
+}
+
+// arpingCommand arpings ip once from iface with iputils arping
+func arpingCommand(iface, ip string) string {
+	return arpingIputils.command(iface, ip)
+}
+
+// parseArpingFlavor recognizes the arping variant from its version banner
+func parseArpingFlavor(banner string) arpingFlavor {
+	switch {
+	case strings.Contains(banner, "BusyBox"):
+		return arpingBusybox
+	case strings.Contains(banner, "Habets") || strings.Contains(banner, "ARPing"):
+		return arpingHabets
+	}
+	return arpingIputils
+}
+
+// detectArpingFlavors returns the arping variant of every node that answered
+func detectArpingFlavors(ansibleUsername string) map[string]arpingFlavor {
+	out, _ := runCommand(exec.Command(ansiblePath, ansibleShellArgs("k8s", ansibleUsername, arpingFlavorCommand)...))
+	flavors := make(map[string]arpingFlavor)
+	for node, banner := range parseAnsibleOutput(string(out)) {
+		flavors[node] = parseArpingFlavor(banner)
+		logf("node %s runs %s arping", node, flavors[node])
+	}
+	return flavors
+}
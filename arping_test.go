@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseArpingFlavor(t *testing.T) {
+	tests := []struct {
+		banner string
+		want   arpingFlavor
+	}{
+		{banner: "BusyBox v1.36.1 (2023-06-21) multi-call binary.", want: arpingBusybox},
+		{banner: "ARPing 2.21, by Thomas Habets <thomas@habets.se>", want: arpingHabets},
+		{banner: "usage: arping [ -0aAbBdDeFhpqrRuUv ] ... Habets", want: arpingHabets},
+		{banner: "arping from iputils 20211215", want: arpingIputils},
+		{banner: "", want: arpingIputils},
+	}
+	for _, tt := range tests {
+		if got := parseArpingFlavor(tt.banner); got != tt.want {
+			t.Errorf("parseArpingFlavor(%q) = %s, want %s", tt.banner, got, tt.want)
+		}
+	}
+}
+
+func TestArpingFlavorNoReply(t *testing.T) {
+	exitErr := errors.New("exit status 2")
+	tests := []struct {
+		name   string
+		flavor arpingFlavor
+		out    string
+		err    error
+		want   bool
+		failed bool
+	}{
+		{name: "iputils without reply", flavor: arpingIputils, out: "node-1 | FAILED | rc=1 >>", err: exitErr, want: true},
+		{name: "iputils with reply", flavor: arpingIputils, out: "node-1 | CHANGED | rc=0 >>", want: false},
+		{name: "iputils on an unreachable node", flavor: arpingIputils, out: "node-1 | UNREACHABLE! => {", err: exitErr, failed: true},
+		{name: "iputils usage error", flavor: arpingIputils, out: "node-1 | FAILED | rc=2 >>\narping: unknown iface eth9", err: exitErr, failed: true},
+		{name: "habets without reply", flavor: arpingHabets, out: "node-1 | FAILED | rc=1 >>", err: exitErr, want: true},
+		{name: "habets with reply", flavor: arpingHabets, out: "node-1 | CHANGED | rc=0 >>", want: false},
+		{name: "habets not found", flavor: arpingHabets, out: "node-1 | FAILED | rc=127 >>\n/bin/sh: arping: not found", err: exitErr, failed: true},
+		{name: "busybox without reply", flavor: arpingBusybox, out: "node-1 | CHANGED | rc=0 >>\nSent 1 probe(s) (1 broadcast(s))\nReceived 0 response(s)", want: true},
+		{name: "busybox with reply", flavor: arpingBusybox, out: "node-1 | CHANGED | rc=0 >>\nSent 1 probe(s) (1 broadcast(s))\nReceived 1 response(s)", want: false},
+		{name: "busybox failure", flavor: arpingBusybox, out: "node-1 | FAILED | rc=1 >>\narping: bad interface", err: exitErr, failed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.flavor.noReply(tt.out, tt.err)
+			if got != tt.want || (err != nil) != tt.failed {
+				t.Errorf("noReply(%q, %v) = %t, %v, want %t, failed %t", tt.out, tt.err, got, err, tt.want, tt.failed)
+			}
+		})
+	}
+}
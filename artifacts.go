@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// artifactsDir is the per-run directory remote command output is saved to
+// with --debug-artifacts. It is empty when no artifacts were requested.
+var (
+	artifactsDir string
+	artifactSeq  int64
+)
+
+// setupDebugArtifacts creates a directory for this run's artifacts under dir
+func setupDebugArtifacts(dir string) (string, error) {
+	runDir := filepath.Join(dir, time.Now().Format("20060102-150405"))
+	if err := os.MkdirAll(runDir, 0700); err != nil {
+		return "", err
+	}
+	artifactsDir = runDir
+	return runDir, nil
+}
+
+// saveArtifact writes the command line, exit status, stdout and stderr of a
+// finished command to its own file. name identifies what the command was for,
+// such as node_ip for a probe; it defaults to the program name.
+func saveArtifact(name string, cmd *exec.Cmd, stdout, stderr []byte, err error) {
+	if name == "" {
+		name = filepath.Base(cmd.Path)
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == ':' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	status := "ok"
+	if err != nil {
+		status = err.Error()
+	}
+
+	path := filepath.Join(artifactsDir, fmt.Sprintf("%04d-%s.txt", atomic.AddInt64(&artifactSeq, 1), name))
+	content := fmt.Sprintf("command: %s\nstatus: %s\n\n--- stdout ---\n%s\n--- stderr ---\n%s", strings.Join(cmd.Args, " "), status, stdout, stderr)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		logf("error saving debug artifact %s: %v", path, err)
+	}
+}
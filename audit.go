@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditRecord is one line of the audit log
+type auditRecord struct {
+	Time    time.Time         `json:"time"`
+	Event   string            `json:"event"`
+	RunID   string            `json:"runId"`
+	User    string            `json:"user"`
+	Host    string            `json:"host"`
+	Cluster string            `json:"cluster"`
+	Command string            `json:"command"`
+	Flags   map[string]string `json:"flags,omitempty"`
+	Summary *auditSummary     `json:"summary,omitempty"`
+}
+
+// auditSummary is the outcome of a run or daemon cycle
+type auditSummary struct {
+	IPs         int `json:"ips"`
+	Hosted      int `json:"hosted"`
+	Unreachable int `json:"unreachable"`
+	Errors      int `json:"errors"`
+	ExitCode    int `json:"exitCode"`
+}
+
+// auditLog appends who ran the tool, against which cluster, with which flags
+// and with what result to --audit-log as JSON lines. The file is only ever
+// appended to. A nil auditLog records nothing.
+type auditLog struct {
+	mu      sync.Mutex
+	file    *os.File
+	base    auditRecord
+	summary *auditSummary
+}
+
+// openAuditLog opens the audit log at path and records the start of command.
+// Only the flags set on the command line are recorded. The finished record
+// is written on exit, so failed runs get one with their exit code too.
+func openAuditLog(path, username, cluster, command string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	flags := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	a := &auditLog{file: file, base: auditRecord{User: username, Host: host, Cluster: cluster, Command: command, Flags: flags}}
+	a.write("started", nil)
+	onExit(a.close)
+	return a, nil
+}
+
+// finish records the result of the run, for the finished record
+func (a *auditLog) finish(summary auditSummary) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.summary = &summary
+}
+
+// close writes the finished record with the exit code of the run. Runs that
+// end before finish, e.g. through fatal, are summarized by their errors.
+func (a *auditLog) close(code int) {
+	a.mu.Lock()
+	summary := auditSummary{Errors: len(collectedErrors())}
+	if a.summary != nil {
+		summary = *a.summary
+	}
+	a.mu.Unlock()
+	summary.ExitCode = code
+	a.write("finished", &summary)
+	a.file.Close()
+}
+
+// cycle records the result of one daemon cycle
+func (a *auditLog) cycle(summary auditSummary) {
+	a.write("cycle", &summary)
+}
+
+func (a *auditLog) write(event string, summary *auditSummary) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	record := a.base
+	record.Time, record.Event, record.Summary = time.Now().UTC(), event, summary
+	record.RunID = currentRun().RunID
+	// The flags are already on the started record
+	if event != "started" {
+		record.Flags = nil
+	}
+	line, _ := json.Marshal(record)
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		logf("error writing audit log: %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// noPool groups the IPs of no known pool in benchmark reports
+const noPool = "(none)"
+
+// benchPool summarizes the failovers measured for one pool. Durations are
+// rounded to the millisecond; they are empty when nothing failed over.
+type benchPool struct {
+	Pool      string `json:"pool"`
+	Samples   int    `json:"samples"`
+	Timeouts  int    `json:"timeouts,omitempty"`
+	Min       string `json:"min,omitempty"`
+	Median    string `json:"median,omitempty"`
+	P95       string `json:"p95,omitempty"`
+	Max       string `json:"max,omitempty"`
+	failovers []time.Duration
+}
+
+// benchReport is the result of bench: drill mode disrupts the announcing
+// node repeatedly, watch mode only observes failovers as they happen
+type benchReport struct {
+	Metadata runMetadata `json:"metadata"`
+	Mode     string      `json:"mode"`
+	Pools    []benchPool `json:"pools"`
+	Errors   []runError  `json:"errors,omitempty"`
+}
+
+// Modes of bench
+const (
+	benchDrill = "drill"
+	benchWatch = "watch"
+)
+
+// poolOf returns the pool of ip for grouping
+func poolOf(targets *ipSet, ip string) string {
+	if pool := targets.pools[ip]; pool != "" {
+		return pool
+	}
+	return noPool
+}
+
+// runBenchDrills runs drills failover drills against one IP of every pool
+// of targets, waiting settle between drills for the disrupted announcer to
+// come back
+func runBenchDrills(ctx context.Context, clientset kubernetes.Interface, opts probeOptions, nodes []string, arpInterface string, targets *ipSet, action string, drills int, interval, timeout, settle time.Duration) map[string]*benchPool {
+	pools := make(map[string]*benchPool)
+	var order []string
+	picked := make(map[string]string)
+	for _, ip := range targets.ips {
+		pool := poolOf(targets, ip)
+		if _, ok := picked[pool]; !ok {
+			picked[pool] = ip
+			order = append(order, pool)
+		}
+	}
+	sort.Strings(order)
+
+	drilled := false
+	for _, pool := range order {
+		ip := picked[pool]
+		bench := &benchPool{Pool: pool}
+		pools[pool] = bench
+		for i := 0; i < drills; i++ {
+			if drilled {
+				select {
+				case <-ctx.Done():
+					return pools
+				case <-time.After(settle):
+				}
+			}
+			drilled = true
+			logf("bench: drill %d/%d on %s (pool %s)", i+1, drills, ip, pool)
+			drill, err := runFailoverDrill(ctx, clientset, opts, nodes, arpInterface, strings.Join(targets.services[ip], ", "), ip, action, interval, timeout)
+			if err != nil {
+				recordError(fmt.Sprintf("drill %d on %s", i+1, ip), pool, err)
+				continue
+			}
+			bench.Samples++
+			if drill.Status != failoverOK {
+				bench.Timeouts++
+				continue
+			}
+			bench.failovers = append(bench.failovers, drill.failover)
+		}
+	}
+	return pools
+}
+
+// watchFailovers probes targets every interval for duration and records a
+// failover whenever an IP answers from another node than before. A failover
+// lasts from the last round the previous owner answered to the first round
+// another node did, so it is measured to within a probe round.
+func watchFailovers(ctx context.Context, clientset kubernetes.Interface, opts probeOptions, nodes []string, arpInterface string, targets *ipSet, interval, duration time.Duration) map[string]*benchPool {
+	opts.NoProgress, opts.StreamFormat, opts.OnResult, opts.Checkpoint = true, "", nil, nil
+	pools := make(map[string]*benchPool)
+	for _, ip := range targets.ips {
+		pool := poolOf(targets, ip)
+		if pools[pool] == nil {
+			pools[pool] = &benchPool{Pool: pool}
+		}
+	}
+
+	owners := make(map[string]string)
+	lastSeen := make(map[string]time.Time)
+	deadline := time.Now().Add(duration)
+	for time.Now().Before(deadline) {
+		roundStart := time.Now()
+		hostingNodes, _, _, err := probeTargets(ctx, clientset, opts, nodes, arpInterface, targets)
+		if err != nil {
+			recordError("probing", "", err)
+		}
+		roundEnd := time.Now()
+		current := make(map[string][]string)
+		for _, row := range hostingNodes {
+			current[row[1]] = append(current[row[1]], row[0])
+		}
+		for ip, nodes := range current {
+			sort.Strings(nodes)
+			owner := strings.Join(nodes, ",")
+			if previous, ok := owners[ip]; ok && previous != owner {
+				failover := roundEnd.Sub(lastSeen[ip])
+				logf("bench: %s failed over from %s to %s within %s", ip, previous, owner, failover.Round(time.Millisecond))
+				bench := pools[poolOf(targets, ip)]
+				bench.Samples++
+				bench.failovers = append(bench.failovers, failover)
+			}
+			owners[ip], lastSeen[ip] = owner, roundEnd
+		}
+		select {
+		case <-ctx.Done():
+			return pools
+		case <-time.After(time.Until(roundStart.Add(interval))):
+		}
+	}
+	return pools
+}
+
+// summarize fills in the statistics of the pool's failovers
+func (b *benchPool) summarize() {
+	if len(b.failovers) == 0 {
+		return
+	}
+	sorted := append([]time.Duration{}, b.failovers...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	format := func(d time.Duration) string { return d.Round(time.Millisecond).String() }
+	b.Min, b.Max = format(sorted[0]), format(sorted[len(sorted)-1])
+	b.Median, b.P95 = format(percentile(sorted, 0.5)), format(percentile(sorted, 0.95))
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// newBenchReport summarizes the pools in pool order
+func newBenchReport(mode string, pools map[string]*benchPool) benchReport {
+	r := benchReport{Metadata: currentRun(), Mode: mode, Pools: []benchPool{}, Errors: collectedErrors()}
+	for _, bench := range pools {
+		bench.summarize()
+		r.Pools = append(r.Pools, *bench)
+	}
+	sort.Slice(r.Pools, func(i, j int) bool { return r.Pools[i].Pool < r.Pools[j].Pool })
+	return r
+}
+
+// writeBench prints the failover statistics of every pool
+func writeBench(format string, r benchReport) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	case "csv":
+		if err := r.Metadata.writeCSVComments(os.Stdout); err != nil {
+			return err
+		}
+		writer := csv.NewWriter(os.Stdout)
+		if err := writer.Write([]string{"pool", "samples", "timeouts", "min", "median", "p95", "max"}); err != nil {
+			return err
+		}
+		for _, p := range r.Pools {
+			if err := writer.Write([]string{p.Pool, fmt.Sprint(p.Samples), fmt.Sprint(p.Timeouts), p.Min, p.Median, p.P95, p.Max}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+
+	if !quiet {
+		if r.Mode == benchWatch {
+			fmt.Println("\nObserved L2 failover times:")
+		} else {
+			fmt.Println("\nL2 failover times of the drills:")
+		}
+	}
+	table := newTable(os.Stdout)
+	table.SetHeader([]string{"Pool", "Samples", "Timeouts", "Min", "Median", "P95", "Max"})
+	for _, p := range r.Pools {
+		timeouts := fmt.Sprint(p.Timeouts)
+		if p.Timeouts > 0 {
+			timeouts = ColorRed + timeouts + ColorReset
+		}
+		table.Append([]string{p.Pool, fmt.Sprint(p.Samples), timeouts, p.Min, p.Median, p.P95, p.Max})
+	}
+	table.Render()
+	printErrors(r.Errors)
+	printRunFooter(r.Metadata)
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	var tenths []time.Duration
+	for i := 1; i <= 10; i++ {
+		tenths = append(tenths, time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		name   string
+		sorted []time.Duration
+		p      float64
+		want   time.Duration
+	}{
+		{name: "minimum", sorted: tenths, p: 0, want: time.Millisecond},
+		{name: "median", sorted: tenths, p: 0.5, want: 5 * time.Millisecond},
+		{name: "nearest rank rounds up", sorted: tenths, p: 0.55, want: 6 * time.Millisecond},
+		{name: "p95", sorted: tenths, p: 0.95, want: 10 * time.Millisecond},
+		{name: "maximum", sorted: tenths, p: 1, want: 10 * time.Millisecond},
+		{name: "single sample", sorted: []time.Duration{7 * time.Millisecond}, p: 0.95, want: 7 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentile(tt.sorted, tt.p); got != tt.want {
+				t.Errorf("percentile(%v, %v) = %v, want %v", tt.sorted, tt.p, got, tt.want)
+			}
+		})
+	}
+}
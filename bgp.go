@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	// bgpAdvertisementResource and l2AdvertisementResource select which
+	// MetalLB pools are announced over BGP and over ARP/NDP
+	bgpAdvertisementResource = schema.GroupVersionResource{Group: "metallb.io", Version: "v1beta1", Resource: "bgpadvertisements"}
+	l2AdvertisementResource  = schema.GroupVersionResource{Group: "metallb.io", Version: "v1beta1", Resource: "l2advertisements"}
+)
+
+// metallbAdvertisement is the part of a BGPAdvertisement or L2Advertisement
+// we use. With neither pools nor selectors it applies to every pool of its
+// namespace.
+type metallbAdvertisement struct {
+	Spec struct {
+		IPAddressPools         []string               `json:"ipAddressPools"`
+		IPAddressPoolSelectors []metav1.LabelSelector `json:"ipAddressPoolSelectors"`
+	} `json:"spec"`
+}
+
+// advertisedPools returns the namespace/name of every MetalLB pool the
+// advertisements of resource apply to
+func advertisedPools(dynamicClient dynamic.Interface, resource schema.GroupVersionResource, pools []addressPool) (map[string]bool, error) {
+	list, err := dynamicClient.Resource(resource).Namespace("").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	advertised := make(map[string]bool)
+	for _, item := range list.Items {
+		var ad metallbAdvertisement
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &ad); err != nil {
+			recordError("reading "+resource.Resource, item.GetNamespace()+"/"+item.GetName(), apiError{err})
+			continue
+		}
+		all := len(ad.Spec.IPAddressPools) == 0 && len(ad.Spec.IPAddressPoolSelectors) == 0
+		for _, pool := range pools {
+			namespace, name, ok := strings.Cut(pool.Name, "/")
+			if !ok || namespace != item.GetNamespace() {
+				continue
+			}
+			if all || containsString(ad.Spec.IPAddressPools, name) || matchesAnySelector(ad.Spec.IPAddressPoolSelectors, pool.Labels) {
+				advertised[pool.Name] = true
+			}
+		}
+	}
+	return advertised, nil
+}
+
+// matchesAnySelector reports whether set matches one of the label selectors
+func matchesAnySelector(selectors []metav1.LabelSelector, set map[string]string) bool {
+	for i := range selectors {
+		selector, err := metav1.LabelSelectorAsSelector(&selectors[i])
+		if err == nil && selector.Matches(labels.Set(set)) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// setAsideBGPAdvertised removes the targets of pools MetalLB advertises only
+// over BGP. Their routers learn the IP from BGP, so nothing answers ARP for
+// it and probing would wrongly report it unclaimed. Pools advertised over
+// both BGP and L2 are still probed. Clusters without MetalLB BGP are left
+// untouched.
+func setAsideBGPAdvertised(dynamicClient dynamic.Interface, targets *ipSet, pools []addressPool) {
+	bgp, err := advertisedPools(dynamicClient, bgpAdvertisementResource, pools)
+	if err != nil || len(bgp) == 0 {
+		return
+	}
+	l2, err := advertisedPools(dynamicClient, l2AdvertisementResource, pools)
+	if err != nil {
+		logf("no L2Advertisements read: %v", err)
+	}
+
+	var probed []string
+	for _, ip := range targets.ips {
+		if pool := targets.pools[ip]; bgp[pool] && !l2[pool] {
+			targets.bgpAdvertised = append(targets.bgpAdvertised, ip)
+			continue
+		}
+		probed = append(probed, ip)
+	}
+	targets.ips = probed
+}
+
+// bgpAdvertisedIP is an LB IP set aside because MetalLB announces it over BGP
+type bgpAdvertisedIP struct {
+	IP       string   `json:"ip"`
+	Pool     string   `json:"pool"`
+	Services []string `json:"services,omitempty"`
+}
+
+// bgpAdvertisedIPs lists the targets set aside by setAsideBGPAdvertised
+func bgpAdvertisedIPs(targets *ipSet) []bgpAdvertisedIP {
+	var ips []bgpAdvertisedIP
+	for _, ip := range targets.bgpAdvertised {
+		ips = append(ips, bgpAdvertisedIP{IP: ip, Pool: targets.pools[ip], Services: targets.services[ip]})
+	}
+	return ips
+}
+
+// printBGPAdvertised prints the BGP-advertised section of the table report
+func printBGPAdvertised(ips []bgpAdvertisedIP) {
+	if len(ips) == 0 {
+		return
+	}
+
+	if !quiet {
+		fmt.Printf("\n%sBGP-advertised LoadBalancer IPs (not probed):%s\n", ColorCyan, ColorReset)
+	}
+
+	table := newTable(os.Stdout)
+	table.SetHeader([]string{"LoadBalancer IP", "Pool", "Services"})
+	for _, ip := range ips {
+		table.Append([]string{ip.IP, ip.Pool, strings.Join(ip.Services, ", ")})
+	}
+	table.Render()
+}
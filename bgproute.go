@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"os/exec"
+	"strings"
+)
+
+// gobgpPath is the part of a path printed by `gobgp global rib -j` we use.
+// The next hop is in the NEXT_HOP attribute (type 3) for IPv4, and the peer
+// that sent the path is in neighbor-ip.
+type gobgpPath struct {
+	NLRI struct {
+		Prefix string `json:"prefix"`
+	} `json:"nlri"`
+	NeighborIP string `json:"neighbor-ip"`
+	Attrs      []struct {
+		Type    int    `json:"type"`
+		Nexthop string `json:"nexthop"`
+	} `json:"attrs"`
+}
+
+// runBGPRouteLookup dumps the RIB of a BGP router, usually the route
+// reflector the nodes peer with, through the gobgp CLI. The nodes hosting a
+// BGP-mode LB IP are the ones whose address is the next hop, or the peer, of
+// a path to the longest prefix containing it, which is the route traffic to
+// it takes. With ECMP several nodes host one IP.
+func runBGPRouteLookup(router string, nodes []string, nodeAddresses map[string]string, lbIPs []string) ([][]string, error) {
+	var hostingNodes [][]string
+
+	nodeNames := make(map[string]string)
+	for _, node := range nodes {
+		if address, ok := nodeAddresses[node]; ok {
+			nodeNames[address] = node
+		}
+	}
+	if len(nodeNames) == 0 {
+		return hostingNodes, fmt.Errorf("no node addresses to match BGP next hops against; check --node-address-type")
+	}
+
+	out, err := runCommand(exec.Command("gobgp", gobgpArgs(router)...))
+	if err != nil {
+		return hostingNodes, fmt.Errorf("reading the RIB of %s: %v: %s", router, err, strings.TrimSpace(string(out)))
+	}
+	var rib map[string][]gobgpPath
+	if err := json.Unmarshal(out, &rib); err != nil {
+		return hostingNodes, fmt.Errorf("decoding the RIB of %s: %v", router, err)
+	}
+
+	for _, ip := range lbIPs {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, path := range longestMatch(rib, addr) {
+			node, ok := nodeNames[bgpNextHop(path)]
+			if !ok {
+				node, ok = nodeNames[path.NeighborIP]
+			}
+			if ok && !seen[node] {
+				seen[node] = true
+				hostingNodes = append(hostingNodes, []string{node, ip})
+			}
+		}
+	}
+
+	return hostingNodes, nil
+}
+
+// longestMatch returns the paths of the longest prefix of rib containing addr
+func longestMatch(rib map[string][]gobgpPath, addr netip.Addr) []gobgpPath {
+	best := -1
+	var paths []gobgpPath
+	for destination, destinationPaths := range rib {
+		prefix, err := netip.ParsePrefix(destination)
+		if err != nil || !prefix.Contains(addr) || prefix.Bits() <= best {
+			continue
+		}
+		best, paths = prefix.Bits(), destinationPaths
+	}
+	return paths
+}
+
+// bgpNextHop returns the NEXT_HOP attribute of path, if any
+func bgpNextHop(path gobgpPath) string {
+	for _, attr := range path.Attrs {
+		if attr.Type == 3 {
+			return attr.Nexthop
+		}
+	}
+	return ""
+}
+
+// gobgpArgs returns the gobgp arguments that dump the IPv4 RIB of router,
+// given as host or host:port
+func gobgpArgs(router string) []string {
+	args := []string{"-u", router}
+	if host, port, err := net.SplitHostPort(router); err == nil {
+		args = []string{"-u", host, "-p", port}
+	}
+	return append(args, "global", "rib", "-a", "ipv4", "-j")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestLongestMatch(t *testing.T) {
+	path := func(neighbor string) gobgpPath {
+		var p gobgpPath
+		p.NeighborIP = neighbor
+		return p
+	}
+	rib := map[string][]gobgpPath{
+		"7.10.0.0/16":   {path("7.10.20.1")},
+		"7.10.20.0/24":  {path("7.10.20.2")},
+		"7.10.20.5/32":  {path("7.10.20.11"), path("7.10.20.12")},
+		"not-a-prefix":  {path("7.10.20.99")},
+		"10.0.0.0/8":    {path("10.0.0.1")},
+		"7.10.20.64/26": {path("7.10.20.3")},
+	}
+	tests := []struct {
+		addr string
+		want []string
+	}{
+		{addr: "7.10.20.5", want: []string{"7.10.20.11", "7.10.20.12"}},
+		{addr: "7.10.20.70", want: []string{"7.10.20.3"}},
+		{addr: "7.10.20.6", want: []string{"7.10.20.2"}},
+		{addr: "7.10.30.1", want: []string{"7.10.20.1"}},
+		{addr: "192.168.1.1"},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, p := range longestMatch(rib, netip.MustParseAddr(tt.addr)) {
+			got = append(got, p.NeighborIP)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("longestMatch(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Disruptions chaos-verify can cause on the node announcing an IP
+const (
+	chaosDeletePod = "delete-pod"
+	chaosCordon    = "cordon"
+)
+
+// announcerSelectors match the pods that announce LB IPs in layer 2 mode:
+// MetalLB speakers and the kube-vip DaemonSet. kube-vip running as a static
+// pod cannot be deleted through the API, so cordon that node instead.
+var announcerSelectors = append(append([]string{}, speakerSelectors...),
+	"app.kubernetes.io/name=kube-vip-ds",
+	"name=kube-vip-ds",
+)
+
+// failoverReport is the outcome of one chaos-verify drill. FailoverTime is
+// measured from the disruption to the end of the probe round that first saw
+// another node answer, so it overstates the failover by at most Resolution.
+type failoverReport struct {
+	Metadata     runMetadata `json:"metadata"`
+	Service      string      `json:"service"`
+	IP           string      `json:"ip"`
+	Action       string      `json:"action"`
+	Disrupted    string      `json:"disrupted"`
+	From         string      `json:"from"`
+	To           string      `json:"to,omitempty"`
+	Status       string      `json:"status"`
+	DisruptedAt  time.Time   `json:"disruptedAt"`
+	FailoverTime string      `json:"failoverTime,omitempty"`
+	Resolution   string      `json:"resolution,omitempty"`
+	Probes       int         `json:"probes"`
+	Errors       []runError  `json:"errors,omitempty"`
+
+	failover time.Duration
+}
+
+// Statuses of a failover drill
+const (
+	failoverOK      = "failed-over"
+	failoverTimeout = "timeout"
+)
+
+// serviceLBIPs returns the LB IPs of the service named namespace/name
+func serviceLBIPs(clientset kubernetes.Interface, service string) ([]string, error) {
+	namespace, name, ok := strings.Cut(service, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("invalid service %q (expected namespace/name)", service)
+	}
+	svc, err := clientset.CoreV1().Services(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var ips []string
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			ips = append(ips, ingress.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("service %s has no LoadBalancer IP", service)
+	}
+	return ips, nil
+}
+
+// noDrillTargets explains why no IP is left to fail over once BGP-advertised
+// IPs and those outside --pool are set aside
+func noDrillTargets(targets *ipSet, poolFilter string) error {
+	switch {
+	case len(targets.bgpAdvertised) > 0 && poolFilter != "":
+		return configError{fmt.Errorf("no L2-announced IP in --pool %s to fail over; %s are advertised over BGP", poolFilter, strings.Join(targets.bgpAdvertised, ", "))}
+	case len(targets.bgpAdvertised) > 0:
+		return configError{fmt.Errorf("%s are advertised over BGP, which has no L2 failover to drill", strings.Join(targets.bgpAdvertised, ", "))}
+	case poolFilter != "":
+		return configError{fmt.Errorf("no LB IP is in --pool %s", poolFilter)}
+	}
+	return configError{fmt.Errorf("no LB IP to fail over")}
+}
+
+// probeOwners probes ip once and returns the nodes hosting it
+func probeOwners(ctx context.Context, clientset kubernetes.Interface, opts probeOptions, nodes []string, arpInterface, ip string) ([]string, error) {
+	targets := newIPSet()
+	targets.add(ip, "Manual")
+	opts.NoProgress, opts.StreamFormat, opts.OnResult, opts.Checkpoint = true, "", nil, nil
+	hostingNodes, _, _, err := probeTargets(ctx, clientset, opts, nodes, arpInterface, targets)
+	var owners []string
+	for _, row := range hostingNodes {
+		owners = append(owners, row[0])
+	}
+	return owners, err
+}
+
+// disruptAnnouncer deletes the announcing pod on node, or cordons it, and
+// returns what was disrupted and how to undo it. Deleted pods are recreated
+// by their DaemonSet, so only a cordon needs undoing.
+func disruptAnnouncer(clientset kubernetes.Interface, action, node string) (string, func() error, error) {
+	ctx := context.TODO()
+	if action == chaosCordon {
+		patch := []byte(`{"spec":{"unschedulable":true}}`)
+		if _, err := clientset.CoreV1().Nodes().Patch(ctx, node, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return "", nil, err
+		}
+		uncordon := func() error {
+			_, err := clientset.CoreV1().Nodes().Patch(ctx, node, types.StrategicMergePatchType, []byte(`{"spec":{"unschedulable":false}}`), metav1.PatchOptions{})
+			return err
+		}
+		return "node/" + node, uncordon, nil
+	}
+
+	pod, err := findAnnouncer(clientset, node)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := clientset.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil {
+		return "", nil, err
+	}
+	return "pod/" + pod.Namespace + "/" + pod.Name, func() error { return nil }, nil
+}
+
+// findAnnouncer returns the MetalLB speaker or kube-vip pod running on node
+func findAnnouncer(clientset kubernetes.Interface, node string) (*corev1.Pod, error) {
+	for _, selector := range announcerSelectors {
+		pods, err := clientset.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{LabelSelector: selector, FieldSelector: "spec.nodeName=" + node})
+		if err != nil {
+			return nil, err
+		}
+		for i := range pods.Items {
+			if pods.Items[i].DeletionTimestamp == nil {
+				return &pods.Items[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no MetalLB speaker or kube-vip pod found on %s; use --chaos-action cordon", node)
+}
+
+// runFailoverDrill disrupts the node hosting ip with action and probes ip
+// every interval until another node answers for it or timeout passes. A
+// cordon is undone before returning.
+func runFailoverDrill(ctx context.Context, clientset kubernetes.Interface, opts probeOptions, nodes []string, arpInterface, service, ip, action string, interval, timeout time.Duration) (failoverReport, error) {
+	r := failoverReport{Service: service, IP: ip, Action: action}
+	owners, err := probeOwners(ctx, clientset, opts, nodes, arpInterface, ip)
+	if err != nil {
+		return r, err
+	}
+	switch len(owners) {
+	case 0:
+		return r, fmt.Errorf("no node hosts %s, so there is nothing to fail over", ip)
+	case 1:
+	default:
+		return r, fmt.Errorf("%s is hosted by %s at once; resolve the conflict before a drill", ip, strings.Join(owners, ", "))
+	}
+	r.From = owners[0]
+
+	disrupted, undo, err := disruptAnnouncer(clientset, action, r.From)
+	if err != nil {
+		return r, apiError{fmt.Errorf("disrupting %s: %v", r.From, err)}
+	}
+	r.Disrupted, r.DisruptedAt = disrupted, time.Now()
+	logf("chaos-verify: %s %s, which hosts %s", action, disrupted, ip)
+	defer func() {
+		if err := undo(); err != nil {
+			recordError("undoing "+action, r.From, apiError{err})
+		}
+	}()
+
+	r.Status = failoverTimeout
+	deadline := r.DisruptedAt.Add(timeout)
+	for time.Now().Before(deadline) {
+		roundStart := time.Now()
+		owners, err := probeOwners(ctx, clientset, opts, nodes, arpInterface, ip)
+		r.Probes++
+		if err != nil {
+			recordError("probing "+ip, "", err)
+		}
+		for _, owner := range owners {
+			if owner != r.From {
+				r.To, r.Status = owner, failoverOK
+				r.failover = time.Since(r.DisruptedAt)
+				r.FailoverTime = r.failover.Round(time.Millisecond).String()
+				r.Resolution = time.Since(roundStart).Round(time.Millisecond).String()
+				return r, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return r, ctx.Err()
+		case <-time.After(time.Until(roundStart.Add(interval))):
+		}
+	}
+	return r, nil
+}
+
+// writeFailover prints the result of a failover drill
+func writeFailover(format string, r failoverReport) error {
+	r.Metadata, r.Errors = currentRun(), collectedErrors()
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	case "csv":
+		if err := r.Metadata.writeCSVComments(os.Stdout); err != nil {
+			return err
+		}
+		writer := csv.NewWriter(os.Stdout)
+		writer.Write([]string{"service", "ip", "action", "disrupted", "from", "to", "status", "disruptedAt", "failoverTime", "resolution", "probes"})
+		writer.Write([]string{r.Service, r.IP, r.Action, r.Disrupted, r.From, r.To, r.Status, r.DisruptedAt.Format(time.RFC3339), r.FailoverTime, r.Resolution, fmt.Sprint(r.Probes)})
+		writer.Flush()
+		return writer.Error()
+	}
+
+	if !quiet {
+		fmt.Println("\nFailover drill:")
+	}
+	table := newTable(os.Stdout)
+	table.SetHeader([]string{"Service", "LoadBalancer IP", "Disrupted", "From", "To", "Failover Time"})
+	failover := r.FailoverTime
+	if r.Status == failoverOK {
+		failover = ColorGreen + failover + " (probe round " + r.Resolution + ")" + ColorReset
+	} else {
+		failover = ColorRed + "no failover within the timeout" + ColorReset
+	}
+	table.Append([]string{r.Service, r.IP, r.Disrupted, r.From, r.To, failover})
+	table.Render()
+	printErrors(r.Errors)
+	printRunFooter(r.Metadata)
+	return nil
+}
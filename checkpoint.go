@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// checkpointEntry is one completed probe, stored as a JSON line
+type checkpointEntry struct {
+	Node   string `json:"node"`
+	IP     string `json:"ip"`
+	Hosted bool   `json:"hosted"`
+}
+
+// checkpoint records every completed node/IP probe to --state-file as it
+// finishes, so an interrupted run can be continued with --resume. A nil
+// checkpoint records nothing.
+type checkpoint struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	probed map[[2]string]bool
+}
+
+// openCheckpoint opens the state file at path. With resume the probes it
+// already holds are kept and skipped; otherwise it starts empty.
+func openCheckpoint(path string, resume bool) (*checkpoint, error) {
+	c := &checkpoint{path: path, probed: make(map[[2]string]bool)}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		if file, err := os.Open(path); err == nil {
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				var entry checkpointEntry
+				// A line cut short by the interruption is probed again
+				if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+					c.probed[[2]string{entry.Node, entry.IP}] = entry.Hosted
+				}
+			}
+			file.Close()
+			logf("resuming from %s with %d completed probes", path, len(c.probed))
+		}
+	}
+
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	c.file = file
+	return c, nil
+}
+
+// lookup returns the result of an earlier probe of ip from node, if any
+func (c *checkpoint) lookup(node, ip string) (hosted, ok bool) {
+	if c == nil {
+		return false, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hosted, ok = c.probed[[2]string{node, ip}]
+	return hosted, ok
+}
+
+// record appends a completed probe to the state file
+func (c *checkpoint) record(node, ip string, hosted bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.probed[[2]string{node, ip}] = hosted
+	line, _ := json.Marshal(checkpointEntry{Node: node, IP: ip, Hosted: hosted})
+	if _, err := c.file.Write(append(line, '\n')); err != nil {
+		logf("error writing state file %s: %v", c.path, err)
+	}
+}
+
+// finish closes the state file and removes it, since the run completed
+func (c *checkpoint) finish() {
+	if c == nil {
+		return
+	}
+	c.file.Close()
+	if err := os.Remove(c.path); err != nil {
+		logf("error removing state file %s: %v", c.path, err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// cloudManagedLB is a LoadBalancer address provisioned by a cloud provider.
+// These are not announced by a cluster node, so they are reported but never probed.
+type cloudManagedLB struct {
+	Namespace string `json:"namespace"`
+	Service   string `json:"service"`
+	Provider  string `json:"provider"`
+	Address   string `json:"address"`
+}
+
+// cloudClassPrefixes maps spec.loadBalancerClass prefixes to their provider
+var cloudClassPrefixes = map[string]string{
+	"service.k8s.aws/":       "AWS",
+	"eks.amazonaws.com/":     "AWS",
+	"networking.gke.io/":     "GCP",
+	"gke.io/":                "GCP",
+	"azure":                  "Azure",
+	"octavia":                "OpenStack Octavia",
+	"openstack.org/":         "OpenStack Octavia",
+	"loadbalancer.openstack": "OpenStack Octavia",
+}
+
+// cloudAnnotationPrefixes maps service annotation prefixes to their provider
+var cloudAnnotationPrefixes = map[string]string{
+	"service.beta.kubernetes.io/aws-load-balancer-":               "AWS",
+	"service.kubernetes.io/aws-":                                  "AWS",
+	"cloud.google.com/":                                           "GCP",
+	"networking.gke.io/":                                          "GCP",
+	"service.beta.kubernetes.io/azure-":                           "Azure",
+	"loadbalancer.openstack.org/":                                 "OpenStack Octavia",
+	"service.beta.kubernetes.io/openstack-internal-load-balancer": "OpenStack Octavia",
+}
+
+// cloudHostnameSuffixes maps LB ingress hostname suffixes to their provider
+var cloudHostnameSuffixes = map[string]string{
+	".elb.amazonaws.com":  "AWS",
+	".cloudapp.azure.com": "Azure",
+}
+
+// getCloudProvider returns the cloud provider managing the service's load
+// balancer, or an empty string if it looks like an on-cluster L2 LoadBalancer.
+func getCloudProvider(service corev1.Service) string {
+	if service.Spec.LoadBalancerClass != nil {
+		for prefix, provider := range cloudClassPrefixes {
+			if strings.HasPrefix(*service.Spec.LoadBalancerClass, prefix) {
+				return provider
+			}
+		}
+	}
+	for annotation := range service.Annotations {
+		for prefix, provider := range cloudAnnotationPrefixes {
+			if strings.HasPrefix(annotation, prefix) {
+				return provider
+			}
+		}
+	}
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		for suffix, provider := range cloudHostnameSuffixes {
+			if strings.HasSuffix(ingress.Hostname, suffix) {
+				return provider
+			}
+		}
+	}
+	return ""
+}
+
+func printCloudManaged(cloudLBs []cloudManagedLB) {
+	if len(cloudLBs) == 0 {
+		return
+	}
+
+	if !quiet {
+		fmt.Printf("\n%sCloud-managed LoadBalancers (not probed):%s\n", ColorCyan, ColorReset)
+	}
+
+	table := newTable(os.Stdout)
+	table.SetHeader([]string{"Namespace", "Service", "Provider", "Address"})
+	for _, lb := range cloudLBs {
+		table.Append([]string{lb.Namespace, lb.Service, lb.Provider, lb.Address})
+	}
+	table.Render()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ipConflict is an LB IP claimed by more than one cluster. Each claim names
+// the context and whether the IP is assigned to a service or only in a pool.
+type ipConflict struct {
+	IP     string   `json:"ip"`
+	Claims []string `json:"claims"`
+}
+
+// clusterClaims maps every IP a cluster uses, in service status or in a
+// MetalLB IPAddressPool, to how it uses it, like "service ns/name" or
+// "pool metallb-system/default".
+type clusterClaims map[string][]string
+
+func (c clusterClaims) add(ip, claim string) {
+	for _, existing := range c[ip] {
+		if existing == claim {
+			return
+		}
+	}
+	c[ip] = append(c[ip], claim)
+}
+
+// collectClusterClaims lists the LoadBalancer service addresses and MetalLB
+// pools of a cluster. Clusters without MetalLB have no pools to report.
+func collectClusterClaims(clientset kubernetes.Interface, dynamicClient dynamic.Interface) (clusterClaims, error) {
+	claims := make(clusterClaims)
+
+	services, err := clientset.CoreV1().Services("").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("fetching services: %v", err)
+	}
+	for _, service := range services.Items {
+		if service.Spec.Type != "LoadBalancer" {
+			continue
+		}
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				claims.add(ingress.IP, "service "+service.Namespace+"/"+service.Name)
+			}
+		}
+	}
+
+	pools, err := dynamicClient.Resource(ipAddressPoolResource).Namespace("").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		logf("no MetalLB pools read: %v", err)
+		return claims, nil
+	}
+	for _, pool := range pools.Items {
+		addresses, _, _ := unstructured.NestedStringSlice(pool.Object, "spec", "addresses")
+		for _, entry := range addresses {
+			ips, err := expandIPEntry(entry)
+			if err != nil {
+				recordError("expanding pool", pool.GetNamespace()+"/"+pool.GetName(), err)
+				continue
+			}
+			for _, ip := range ips {
+				claims.add(ip, "pool "+pool.GetNamespace()+"/"+pool.GetName())
+			}
+		}
+	}
+	return claims, nil
+}
+
+// contextClients builds the clients of a kubeconfig context
+func contextClients(kubeconfig, contextName string) (kubernetes.Interface, dynamic.Interface, error) {
+	config, err := contextRESTConfig(kubeconfig, contextName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading context %s: %v", contextName, err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating Kubernetes client for %s: %v", contextName, err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating Kubernetes dynamic client for %s: %v", contextName, err)
+	}
+	return clientset, dynamicClient, nil
+}
+
+// findIPConflicts compares the claims of the current cluster with those of
+// the other contexts on the same segment, given as a comma-separated list. Only IPs the current cluster
+// assigns or pools are checked, so overlaps purely between the other
+// contexts are left to their own runs. A context that can't be read is
+// recorded as an error and skipped.
+func findIPConflicts(kubeconfig, currentName string, current clusterClaims, contexts string) []ipConflict {
+	byIP := make(map[string][]string)
+	for _, contextName := range strings.Split(contexts, ",") {
+		contextName = strings.TrimSpace(contextName)
+		if contextName == "" || contextName == currentName {
+			continue
+		}
+		clientset, dynamicClient, err := contextClients(kubeconfig, contextName)
+		if err != nil {
+			recordError("checking IP conflicts", contextName, apiError{err})
+			continue
+		}
+		claims, err := collectClusterClaims(clientset, dynamicClient)
+		if err != nil {
+			recordError("checking IP conflicts", contextName, apiError{err})
+			continue
+		}
+		for ip, uses := range claims {
+			if _, ok := current[ip]; !ok {
+				continue
+			}
+			for _, use := range uses {
+				byIP[ip] = append(byIP[ip], contextName+": "+use)
+			}
+		}
+	}
+
+	var conflicts []ipConflict
+	for ip, others := range byIP {
+		var claims []string
+		for _, use := range current[ip] {
+			claims = append(claims, currentName+": "+use)
+		}
+		conflicts = append(conflicts, ipConflict{IP: ip, Claims: append(claims, others...)})
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].IP < conflicts[j].IP })
+	return conflicts
+}
+
+// printIPConflicts prints a banner for every IP claimed by several clusters.
+// Two clusters announcing one IP on a segment flap traffic between them,
+// which is easy to cause during migrations.
+func printIPConflicts(conflicts []ipConflict) {
+	if len(conflicts) == 0 {
+		return
+	}
+	fmt.Printf("\n%s!!! %d LB IP(s) are claimed by more than one cluster !!!%s\n", ColorRed, len(conflicts), ColorReset)
+	for _, conflict := range conflicts {
+		fmt.Printf("%s  %s: %s%s\n", ColorRed, conflict.IP, strings.Join(conflict.Claims, "; "), ColorReset)
+	}
+}
+
+// currentContextName names the kubeconfig's current context for conflict
+// reports, falling back to "current" when the kubeconfig can't be read.
+func currentContextName(kubeconfig string) string {
+	rawConfig, err := loadKubeconfig(kubeconfig)
+	if err != nil || rawConfig.CurrentContext == "" {
+		return "current"
+	}
+	return rawConfig.CurrentContext
+}
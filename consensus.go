@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// consensusProber probes each IP several times from every node and takes
+// the majority answer, so a single lost ARP reply doesn't move an IP in the
+// report. Node/IP pairs whose answers differ between attempts are remembered
+// as flapping.
+type consensusProber struct {
+	prober   Prober
+	attempts int
+	spacing  time.Duration
+
+	mu       sync.Mutex
+	flapping map[string][]string
+}
+
+// newConsensusProber spreads attempts probes of each IP evenly over spread
+func newConsensusProber(prober Prober, attempts int, spread time.Duration) *consensusProber {
+	c := &consensusProber{prober: prober, attempts: attempts, flapping: make(map[string][]string)}
+	if attempts > 1 {
+		c.spacing = spread / time.Duration(attempts-1)
+	}
+	return c
+}
+
+func (c *consensusProber) Probe(ctx context.Context, node, iface, ip string) ProbeResult {
+	var last ProbeResult
+	votes := 0
+	for attempt := 0; attempt < c.attempts; attempt++ {
+		if attempt > 0 && c.spacing > 0 {
+			select {
+			case <-ctx.Done():
+				return ProbeResult{Err: ctx.Err()}
+			case <-time.After(c.spacing):
+			}
+		}
+		last = c.prober.Probe(ctx, node, iface, ip)
+		if last.Unreachable || last.Err != nil {
+			return last
+		}
+		if last.Hosted {
+			votes++
+		}
+	}
+
+	if votes > 0 && votes < c.attempts {
+		c.mu.Lock()
+		c.flapping[ip] = append(c.flapping[ip], fmt.Sprintf("%s answered hosted in %d of %d probes", node, votes, c.attempts))
+		c.mu.Unlock()
+	}
+	last.Hosted = votes*2 > c.attempts
+	last.Detail = fmt.Sprintf("%d/%d", votes, c.attempts)
+	return last
+}
+
+// takeFlapping returns the flapping IPs seen since the last call, with what
+// each node answered, and forgets them
+func (c *consensusProber) takeFlapping() map[string][]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	flapping := c.flapping
+	c.flapping = make(map[string][]string)
+	return flapping
+}
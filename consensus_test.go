@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// scriptedProber answers each probe with the next of its results
+type scriptedProber struct {
+	results []ProbeResult
+	calls   int
+}
+
+func (p *scriptedProber) Probe(ctx context.Context, node, iface, ip string) ProbeResult {
+	result := p.results[p.calls%len(p.results)]
+	p.calls++
+	return result
+}
+
+func TestConsensusProber(t *testing.T) {
+	hosted, free := ProbeResult{Hosted: true}, ProbeResult{}
+	failed := ProbeResult{Err: errors.New("arping failed")}
+	tests := []struct {
+		name     string
+		results  []ProbeResult
+		want     ProbeResult
+		calls    int
+		flapping map[string][]string
+	}{
+		{name: "always hosted", results: []ProbeResult{hosted}, want: ProbeResult{Hosted: true, Detail: "3/3"}, calls: 3, flapping: map[string][]string{}},
+		{name: "never hosted", results: []ProbeResult{free}, want: ProbeResult{Detail: "0/3"}, calls: 3, flapping: map[string][]string{}},
+		{
+			name:     "majority hosted",
+			results:  []ProbeResult{hosted, free, hosted},
+			want:     ProbeResult{Hosted: true, Detail: "2/3"},
+			calls:    3,
+			flapping: map[string][]string{"7.10.20.5": {"node-1 answered hosted in 2 of 3 probes"}},
+		},
+		{
+			name:     "minority hosted",
+			results:  []ProbeResult{free, hosted, free},
+			want:     ProbeResult{Detail: "1/3"},
+			calls:    3,
+			flapping: map[string][]string{"7.10.20.5": {"node-1 answered hosted in 1 of 3 probes"}},
+		},
+		{name: "errors stop the attempts", results: []ProbeResult{hosted, failed}, want: failed, calls: 2, flapping: map[string][]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scripted := &scriptedProber{results: tt.results}
+			c := newConsensusProber(scripted, 3, 0)
+			if got := c.Probe(context.Background(), "node-1", "eth0", "7.10.20.5"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Probe() = %+v, want %+v", got, tt.want)
+			}
+			if scripted.calls != tt.calls {
+				t.Errorf("probed %d times, want %d", scripted.calls, tt.calls)
+			}
+			if got := c.takeFlapping(); !reflect.DeepEqual(got, tt.flapping) {
+				t.Errorf("takeFlapping() = %v, want %v", got, tt.flapping)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// cycleResult is the outcome of one daemon probe cycle
+type cycleResult struct {
+	Started  time.Time
+	Finished time.Time
+	Report   report
+	Err      error
+
+	// IPs are the IPs probed in the cycle, claimed or not, and Flaps how
+	// often each changed owner within the flap window
+	IPs   []string
+	Flaps map[string]int
+}
+
+// daemon runs a probe cycle every interval and serves HTTP endpoints while
+// it does. It remembers the owners of each IP between cycles so moves can be
+// reported.
+type daemon struct {
+	interval time.Duration
+	cycle    func(ctx context.Context) cycleResult
+	apiCheck func() error
+
+	// grpcAddr, when set, serves the gRPC Prober API using probe
+	grpcAddr string
+	probe    probeFunc
+
+	// triggerToken, when set, serves POST /v1/trigger to callers presenting
+	// it, probing with probe
+	triggerToken string
+
+	// leader, when set, limits probing to the replica holding the lease
+	leader *leaderElector
+
+	// alerts, when set, evaluates the alert rules after each cycle, and
+	// grafana annotates dashboards with every move
+	alerts  *alertEngine
+	grafana *grafanaAnnotator
+
+	// schedule, when set, runs cycles at its cron times instead of every
+	// interval
+	schedule *cronSchedule
+
+	mu     sync.RWMutex
+	last   *cycleResult
+	owners map[string]string
+}
+
+// newDaemon returns a daemon running cycle every interval. apiCheck is used
+// by /readyz to verify the Kubernetes API is reachable.
+func newDaemon(interval time.Duration, cycle func(ctx context.Context) cycleResult, apiCheck func() error) *daemon {
+	return &daemon{interval: interval, cycle: cycle, apiCheck: apiCheck, owners: make(map[string]string)}
+}
+
+// run serves HTTP on addr, unless addr is empty, and probes until ctx is
+// cancelled. The pprof endpoints are only registered when enablePprof is set.
+func (d *daemon) run(ctx context.Context, addr string, enablePprof bool) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", d.handleHealthz)
+	mux.HandleFunc("/readyz", d.handleReadyz)
+	if d.triggerToken != "" {
+		mux.HandleFunc("/v1/trigger", d.handleTrigger)
+	}
+	if enablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	serveErr := make(chan error, 2)
+	if addr != "" {
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- err
+			}
+		}()
+		logf("daemon listening on %s", addr)
+	}
+
+	if d.grpcAddr != "" {
+		go func() {
+			if err := serveGRPC(ctx, d.grpcAddr, d.probe); err != nil {
+				serveErr <- err
+			}
+		}()
+	}
+
+	var leaderStarted <-chan struct{}
+	if d.leader != nil {
+		go d.leader.run(ctx)
+		leaderStarted = d.leader.started
+	}
+
+	// Without a schedule, cycles run right away and then every interval.
+	// On a schedule they wait for the first scheduled time. Cycles run one
+	// at a time, so a long cycle never overlaps the next.
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	tick := ticker.C
+	var slot time.Time
+	if d.schedule != nil {
+		ticker.Stop()
+		slot = d.schedule.next(time.Now())
+		tick = time.After(time.Until(slot))
+		logf("daemon probing on schedule, first run at %s", slot.Format(time.RFC3339))
+	} else {
+		logf("daemon probing every %s", d.interval)
+	}
+	runNow, slotDone := d.schedule == nil, false
+	for {
+		if runNow && d.leader.isLeader() {
+			d.runCycle(ctx)
+		}
+		runNow = true
+		if d.schedule != nil && slotDone {
+			slot = d.followingSlot(slot)
+			tick = time.After(time.Until(slot))
+		}
+		slotDone = false
+		select {
+		case <-ctx.Done():
+			if addr == "" {
+				return nil
+			}
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			return server.Shutdown(shutdownCtx)
+		case err := <-serveErr:
+			return err
+		case <-tick:
+			slotDone = true
+		case <-leaderStarted:
+			// A new leader probes right away, unless it waits for the schedule
+			runNow = d.schedule == nil
+		}
+	}
+}
+
+// followingSlot returns the scheduled time after slot. When that time has
+// already passed, because the cycle overran or the host was asleep, the
+// latest missed time is returned so a single catch-up cycle runs right away
+// instead of one for every missed time.
+func (d *daemon) followingSlot(slot time.Time) time.Time {
+	now := time.Now()
+	next := d.schedule.next(slot)
+	if next.After(now) {
+		return next
+	}
+	missed := next
+	for n := next; !n.IsZero() && !n.After(now); n = d.schedule.next(n) {
+		missed = n
+	}
+	logf("missed the run scheduled at %s, catching up now", missed.Format(time.RFC3339))
+	return missed
+}
+
+// runCycle runs one probe cycle, reports IPs whose owner changed since the
+// previous cycle, evaluates the alert rules and stores the result.
+func (d *daemon) runCycle(ctx context.Context) {
+	cycleCtx, span := tracer.Start(ctx, "probe cycle", trace.WithNewRoot())
+	result := d.cycle(cycleCtx)
+	endSpan(span, result.Err)
+
+	// Collect the owners of each IP in this cycle
+	owners := make(map[string][]string)
+	for _, row := range result.Report.Results {
+		owners[row.IP] = append(owners[row.IP], row.Node)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	previous := make(map[string]string, len(d.owners))
+	for ip, current := range d.owners {
+		previous[ip] = current
+	}
+	for ip, nodes := range owners {
+		sort.Strings(nodes)
+		current := strings.Join(nodes, ",")
+		if previous, ok := d.owners[ip]; ok && previous != current {
+			logf("%s moved from %s to %s", ip, previous, current)
+			emitEvent(eventIPMoved, map[string]interface{}{"ip": ip, "from": previous, "to": current})
+			d.grafana.annotateMove(ip, previous, current, result.Finished)
+		}
+		d.owners[ip] = current
+	}
+	d.alerts.evaluate(result.IPs, owners, previous, result.Flaps, result.Report.Unreachable)
+	d.last = &result
+
+	if result.Err != nil {
+		fmt.Printf("%s%s cycle error: %v%s\n", ColorRed, result.Finished.Format(time.RFC3339), result.Err, ColorReset)
+	}
+}
+
+// handleHealthz reports liveness: the process is up and serving
+func (d *daemon) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz reports readiness: the Kubernetes API is reachable and the
+// last probe cycle completed recently without error.
+func (d *daemon) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if err := d.ready(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (d *daemon) ready() error {
+	if err := d.apiCheck(); err != nil {
+		return fmt.Errorf("kubernetes API unreachable: %v", err)
+	}
+	// Standby replicas do not probe, so there is no cycle to judge them by
+	if !d.leader.isLeader() {
+		return nil
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	switch {
+	case d.last == nil && d.schedule != nil:
+		// Scheduled daemons may wait hours for their first cycle
+		return nil
+	case d.last == nil:
+		return fmt.Errorf("no probe cycle has completed yet")
+	case d.last.Err != nil:
+		return fmt.Errorf("last probe cycle failed: %v", d.last.Err)
+	case time.Since(d.last.Finished) > 3*d.interval:
+		return fmt.Errorf("last probe cycle finished %s ago", time.Since(d.last.Finished).Round(time.Second))
+	}
+	return nil
+}
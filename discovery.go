@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// gatewayResource is the Gateway API resource holding announced addresses
+var gatewayResource = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+
+// collectIngressIPs adds the addresses published in Ingress status.loadBalancer
+func collectIngressIPs(clientset kubernetes.Interface, lbIPs *ipSet, opts discoveryOptions) error {
+	ingresses, err := listIngresses(clientset, opts.Cache)
+	if err != nil {
+		return err
+	}
+
+	for _, ingress := range ingresses {
+		if opts.excludesNamespace(ingress.Namespace) {
+			continue
+		}
+		for _, lb := range ingress.Status.LoadBalancer.Ingress {
+			if strings.HasPrefix(lb.IP, "7") {
+				lbIPs.add(lb.IP, "Ingress")
+			}
+			if lb.IP == "" && lb.Hostname != "" {
+				addResolvedHostname(lbIPs, opts.DNSServer, lb.Hostname, "Ingress")
+			}
+		}
+	}
+	return nil
+}
+
+// addResolvedHostname resolves a hostname-based ingress entry and adds its IPs,
+// recording the hostname alongside the source so the report shows where they came from.
+func addResolvedHostname(lbIPs *ipSet, dnsServer, hostname, source string) {
+	ips, err := lookupHostIPs(dnsServer, hostname)
+	if err != nil {
+		recordError("resolving hostname", hostname, err)
+		return
+	}
+	for _, ip := range ips {
+		if strings.HasPrefix(ip, "7") {
+			lbIPs.add(ip, fmt.Sprintf("%s (%s)", source, hostname))
+		}
+	}
+}
+
+// collectGatewayIPs adds the IP addresses published in Gateway status.addresses.
+// The Gateway API is read through the dynamic client so clusters without the
+// CRDs installed only produce an error instead of requiring extra clients.
+func collectGatewayIPs(dynamicClient dynamic.Interface, lbIPs *ipSet, opts discoveryOptions) error {
+	gateways, err := listGateways(dynamicClient, opts.Cache)
+	if err != nil {
+		return err
+	}
+
+	for _, gateway := range gateways {
+		if opts.excludesNamespace(gateway.GetNamespace()) {
+			continue
+		}
+		addresses, _, err := unstructured.NestedSlice(gateway.Object, "status", "addresses")
+		if err != nil {
+			return fmt.Errorf("reading addresses of gateway %s/%s: %v", gateway.GetNamespace(), gateway.GetName(), err)
+		}
+		for _, address := range addresses {
+			entry, ok := address.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			// Addresses without a type default to IPAddress
+			addrType, _ := entry["type"].(string)
+			value, _ := entry["value"].(string)
+			switch {
+			case (addrType == "" || addrType == "IPAddress") && strings.HasPrefix(value, "7"):
+				lbIPs.add(value, "Gateway")
+			case addrType == "Hostname" && value != "":
+				addResolvedHostname(lbIPs, opts.DNSServer, value, "Gateway")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// dnsTimeout bounds each hostname lookup so a dead DNS server can't hang the run
+const dnsTimeout = 5 * time.Second
+
+// newResolver returns a resolver that queries dnsServer (host or host:port),
+// or the system resolver when dnsServer is empty.
+func newResolver(dnsServer string) *net.Resolver {
+	if dnsServer == "" {
+		return net.DefaultResolver
+	}
+	if _, _, err := net.SplitHostPort(dnsServer); err != nil {
+		dnsServer = net.JoinHostPort(dnsServer, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, dnsServer)
+		},
+	}
+}
+
+// lookupHostIPs resolves hostname to its IPv4 addresses
+func lookupHostIPs(dnsServer, hostname string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	defer cancel()
+
+	addrs, err := newResolver(dnsServer).LookupIP(ctx, "ip4", hostname)
+	if err != nil {
+		return nil, err
+	}
+	var ips []string
+	for _, addr := range addrs {
+		ips = append(ips, addr.String())
+	}
+	return ips, nil
+}
+
+// lookupPTR returns the first reverse DNS name of ip, without the final dot
+func lookupPTR(dnsServer, ip string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	defer cancel()
+
+	names, err := newResolver(dnsServer).LookupAddr(ctx, ip)
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	return strings.TrimSuffix(names[0], "."), nil
+}
+
+// resolvePTRNames records the reverse DNS name of every target. IPs without
+// a PTR record are left blank rather than reported as errors.
+func resolvePTRNames(targets *ipSet, dnsServer string) {
+	for _, ip := range targets.ips {
+		name, err := lookupPTR(dnsServer, ip)
+		if err != nil {
+			logf("no PTR record for %s: %v", ip, err)
+			continue
+		}
+		targets.ptrNames[ip] = name
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// expectedState is the desired placement of each service, kept in Git for
+// check --expected-file, e.g.
+//
+//	placements:
+//	  ingress-nginx/ingress-nginx-controller:
+//	    nodes: ["edge-*"]
+//	  default/web:
+//	    nodeSelector:
+//	      topology.kubernetes.io/zone: dc1-a
+type expectedState struct {
+	Placements map[string]expectedPlacement `json:"placements"`
+}
+
+// expectedPlacement allows the nodes named by a glob in Nodes or carrying all
+// the labels of NodeSelector
+type expectedPlacement struct {
+	Nodes        []string          `json:"nodes,omitempty"`
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+}
+
+// Drift statuses of a service
+const (
+	driftOK       = "ok"
+	driftDrifted  = "drifted"
+	driftUnhosted = "unhosted"
+	driftMissing  = "missing"
+)
+
+// placementDrift compares where a service's IPs are hosted with where they
+// are expected
+type placementDrift struct {
+	Service  string   `json:"service"`
+	Status   string   `json:"status"`
+	IPs      []string `json:"ips,omitempty"`
+	Nodes    []string `json:"nodes,omitempty"`
+	Expected string   `json:"expected"`
+}
+
+// loadExpectedState reads and validates an expected-state file
+func loadExpectedState(path string) (*expectedState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state expectedState
+	if err := yaml.UnmarshalStrict(data, &state); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	for service, placement := range state.Placements {
+		if !strings.Contains(service, "/") {
+			return nil, fmt.Errorf("placement %q must name a service as namespace/name", service)
+		}
+		if len(placement.Nodes) == 0 && len(placement.NodeSelector) == 0 {
+			return nil, fmt.Errorf("placement %s allows no nodes: set nodes or nodeSelector", service)
+		}
+	}
+	return &state, nil
+}
+
+// describe names the allowed nodes in drift reports
+func (p expectedPlacement) describe() string {
+	var parts []string
+	if len(p.Nodes) > 0 {
+		parts = append(parts, "nodes "+strings.Join(p.Nodes, ", "))
+	}
+	if len(p.NodeSelector) > 0 {
+		var selectors []string
+		for key, value := range p.NodeSelector {
+			selectors = append(selectors, key+"="+value)
+		}
+		sort.Strings(selectors)
+		parts = append(parts, "labels "+strings.Join(selectors, ","))
+	}
+	return strings.Join(parts, " or ")
+}
+
+// checkDrift compares every service of the expected state with the probe
+// result, in service order. A service is drifted when any of its IPs is on a
+// node the placement does not allow, unhosted when no node hosts its IPs and
+// missing when it has no LB IP at all.
+func checkDrift(state *expectedState, hostingNodes [][]string, targets *ipSet, nodeLabels map[string]map[string]string) []placementDrift {
+	services := make([]string, 0, len(state.Placements))
+	for service := range state.Placements {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	var drifts []placementDrift
+	for _, service := range services {
+		placement := state.Placements[service]
+		rule := placementRule{Service: service, Nodes: placement.Nodes, NodeSelector: placement.NodeSelector}
+		drift := placementDrift{Service: service, Status: driftMissing, Expected: placement.describe()}
+		for _, ip := range targets.ips {
+			if rule.matches(ip, targets) {
+				drift.IPs = append(drift.IPs, ip)
+			}
+		}
+		if len(drift.IPs) > 0 {
+			drift.Status = driftUnhosted
+		}
+		seen := make(map[string]bool)
+		for _, row := range hostingNodes {
+			node, ip := row[0], row[1]
+			if !containsString(drift.IPs, ip) {
+				continue
+			}
+			if drift.Status == driftUnhosted {
+				drift.Status = driftOK
+			}
+			if !rule.allows(node, nodeLabels[node]) {
+				drift.Status = driftDrifted
+			}
+			if !seen[node] {
+				seen[node] = true
+				drift.Nodes = append(drift.Nodes, node)
+			}
+		}
+		sort.Strings(drift.Nodes)
+		drifts = append(drifts, drift)
+	}
+	return drifts
+}
+
+// writeDrift prints the drift report in the requested format. JSON and CSV
+// hold only the drift, so a drift-detection job can parse them directly.
+func writeDrift(format string, drifts []placementDrift) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(struct {
+			Metadata runMetadata      `json:"metadata"`
+			Drift    []placementDrift `json:"drift"`
+			Errors   []runError       `json:"errors,omitempty"`
+		}{currentRun(), drifts, collectedErrors()})
+	case "csv":
+		if err := currentRun().writeCSVComments(os.Stdout); err != nil {
+			return err
+		}
+		writer := csv.NewWriter(os.Stdout)
+		if err := writer.Write([]string{"service", "status", "ips", "nodes", "expected"}); err != nil {
+			return err
+		}
+		for _, d := range drifts {
+			if err := writer.Write([]string{d.Service, d.Status, strings.Join(d.IPs, " "), strings.Join(d.Nodes, " "), d.Expected}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+
+	if !quiet {
+		fmt.Println("\nPlacement drift:")
+	}
+	table := newTable(os.Stdout)
+	table.SetHeader([]string{"Service", "Status", "LoadBalancer IPs", "Hosted On", "Expected"})
+	for _, d := range drifts {
+		status := d.Status
+		if status != driftOK {
+			status = ColorRed + status + ColorReset
+		}
+		table.Append([]string{d.Service, status, strings.Join(d.IPs, ", "), strings.Join(d.Nodes, ", "), d.Expected})
+	}
+	table.Render()
+	printRunFooter(currentRun())
+	return nil
+}
+
+// driftCount returns how many services are not placed as expected
+func driftCount(drifts []placementDrift) int {
+	count := 0
+	for _, d := range drifts {
+		if d.Status != driftOK {
+			count++
+		}
+	}
+	return count
+}
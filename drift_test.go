@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadExpectedState(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]expectedPlacement
+		wantErr bool
+	}{
+		{
+			name:    "nodes and labels",
+			content: "placements:\n  ingress/nginx:\n    nodes: [\"edge-*\"]\n  default/web:\n    nodeSelector:\n      zone: a\n",
+			want: map[string]expectedPlacement{
+				"ingress/nginx": {Nodes: []string{"edge-*"}},
+				"default/web":   {NodeSelector: map[string]string{"zone": "a"}},
+			},
+		},
+		{name: "service without namespace", content: "placements:\n  nginx:\n    nodes: [\"edge-*\"]\n", wantErr: true},
+		{name: "placement allowing no nodes", content: "placements:\n  ingress/nginx: {}\n", wantErr: true},
+		{name: "unknown field", content: "placements:\n  ingress/nginx:\n    node: edge-1\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "expected.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			state, err := loadExpectedState(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadExpectedState() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(state.Placements, tt.want) {
+				t.Errorf("loadExpectedState() = %+v, want %+v", state.Placements, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	state := &expectedState{Placements: map[string]expectedPlacement{
+		"ingress/nginx": {Nodes: []string{"edge-*"}},
+		"default/web":   {NodeSelector: map[string]string{"zone": "a"}},
+		"default/db":    {Nodes: []string{"db-1"}},
+		"default/gone":  {Nodes: []string{"edge-*"}},
+	}}
+	targets := newIPSet()
+	targets.add("7.10.20.5", "LoadBalancer")
+	targets.addService("7.10.20.5", "ingress/nginx:443/TCP")
+	targets.add("7.10.20.6", "LoadBalancer")
+	targets.addService("7.10.20.6", "default/web:80/TCP")
+	targets.add("7.10.20.7", "LoadBalancer")
+	targets.addService("7.10.20.7", "default/db:5432/TCP")
+	nodeLabels := map[string]map[string]string{"node-a": {"zone": "a"}, "node-b": {"zone": "b"}}
+	hostingNodes := [][]string{{"edge-1", "7.10.20.5"}, {"node-a", "7.10.20.6"}, {"node-b", "7.10.20.6"}}
+
+	want := []placementDrift{
+		{Service: "default/db", Status: driftUnhosted, IPs: []string{"7.10.20.7"}, Expected: "nodes db-1"},
+		{Service: "default/gone", Status: driftMissing, Expected: "nodes edge-*"},
+		{Service: "default/web", Status: driftDrifted, IPs: []string{"7.10.20.6"}, Nodes: []string{"node-a", "node-b"}, Expected: "labels zone=a"},
+		{Service: "ingress/nginx", Status: driftOK, IPs: []string{"7.10.20.5"}, Nodes: []string{"edge-1"}, Expected: "nodes edge-*"},
+	}
+	if got := checkDrift(state, hostingNodes, targets, nodeLabels); !reflect.DeepEqual(got, want) {
+		t.Errorf("checkDrift() = %+v, want %+v", got, want)
+	}
+}
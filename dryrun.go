@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dryRunInterface stands in for the ARP interface, which is only known after
+// running the detection command on a node.
+const dryRunInterface = "<interface>"
+
+// printDryRun prints the nodes, interface, IPs, inventory content and the exact remote
+// commands a run would execute, without contacting any node.
+func printDryRun(nodes []string, arpInterface string, targets *ipSet, inventory string, opts probeOptions) {
+	fmt.Printf("%sDry run: no inventory is written and no commands are executed.%s\n\n", ColorYellow, ColorReset)
+
+	fmt.Printf("%sNodes (%d):%s\n", ColorBlue, len(nodes), ColorReset)
+	for _, node := range nodes {
+		fmt.Printf("  %s\n", node)
+	}
+
+	fmt.Printf("\n%sLoadBalancer IPs (%d):%s\n", ColorBlue, len(targets.ips), ColorReset)
+	for _, ip := range targets.ips {
+		fmt.Printf("  %s (%s)\n", ip, targets.source(ip))
+	}
+
+	fmt.Printf("\n%sInventory (%s):%s\n", ColorBlue, inventoryFile, ColorReset)
+	for _, line := range strings.Split(strings.TrimSpace(inventory), "\n") {
+		fmt.Printf("  %s\n", line)
+	}
+
+	fmt.Printf("\n%sInterface:%s ", ColorBlue, ColorReset)
+	if arpInterface == dryRunInterface {
+		fmt.Printf("detected with\n  %s\n", plannedInterfaceDetection(nodes, opts.Prober))
+	} else {
+		fmt.Printf("%s\n", arpInterface)
+	}
+
+	fmt.Printf("\n%sCommands:%s\n", ColorBlue, ColorReset)
+	for _, command := range plannedCommands(nodes, arpInterface, targets.ips, opts) {
+		fmt.Printf("  %s\n", command)
+	}
+}
+
+// plannedCommands lists the commands probeTargets would run for opts
+func plannedCommands(nodes []string, arpInterface string, lbIPs []string, opts probeOptions) []string {
+	var commands []string
+	switch {
+	case opts.Backend == "gateway":
+		gatewayUser, arpCommand := opts.GatewayUser, opts.GatewayARPCommand
+		if gatewayUser == "" {
+			gatewayUser = opts.AnsibleUsername
+		}
+		if opts.ProbeMethod == "neigh" {
+			arpCommand = "ip -json neigh show"
+		}
+		commands = append(commands,
+			shellJoin(ansiblePath, ansibleShellArgs("k8s", opts.AnsibleUsername, macAddressCommand(arpInterface))...),
+			shellJoin("ssh", gatewaySSHArgs(opts.GatewayHost, gatewayUser, arpCommand)...))
+
+	case opts.Backend == "talos":
+		var endpoints []string
+		for _, node := range nodes {
+			if address, ok := opts.NodeAddresses[node]; ok {
+				endpoints = append(endpoints, address)
+			}
+		}
+		commands = append(commands,
+			shellJoin("talosctl", talosArgs(opts.Talosconfig, endpoints, "get", "addresses", "-o", "json")...),
+			shellJoin("talosctl", talosArgs(opts.Talosconfig, endpoints, "get", "links", "-o", "json")...))
+		for _, endpoint := range endpoints {
+			commands = append(commands, shellJoin("talosctl", talosArgs(opts.Talosconfig, []string{endpoint}, "read", talosNeighborTable)...))
+		}
+
+	case opts.Backend == "bgp":
+		commands = append(commands, shellJoin("gobgp", gobgpArgs(opts.BGPRouter)...))
+
+	case opts.ProbeMethod == "neigh":
+		commands = append(commands,
+			shellJoin(ansiblePath, ansibleShellArgs("k8s", opts.AnsibleUsername, macAddressCommand(arpInterface))...),
+			shellJoin(ansiblePath, ansibleShellArgs("k8s", opts.AnsibleUsername, neighCommand(arpInterface))...))
+
+	default:
+		if opts.Backend == "servicelb" {
+			commands = append(commands, "read svclb pod placement from the Kubernetes API")
+		}
+		for _, node := range nodes {
+			for _, ip := range lbIPs {
+				commands = append(commands, plannedProbe(opts.Prober, opts.AnsibleUsername, node, arpInterface, ip))
+			}
+		}
+	}
+	return commands
+}
+
+// plannedInterfaceDetection returns the command that detects the interface
+func plannedInterfaceDetection(nodes []string, prober Prober) string {
+	if p, ok := prober.(remoteProber); ok {
+		return p.commandLine(detectionNode(nodes), interfaceDetectionCommand)
+	}
+	return shellJoin(ansiblePath, ansibleShellArgs("k8s[1]", "", interfaceDetectionCommand)...)
+}
+
+// plannedProbe describes a single probe made by prober
+func plannedProbe(prober Prober, ansibleUsername, node, iface, ip string) string {
+	switch p := prober.(type) {
+	case nil:
+		return shellJoin(ansiblePath, ansibleShellArgs(node, ansibleUsername, arpingCommand(iface, ip))...)
+	case arpingProber:
+		return shellJoin(ansiblePath, ansibleShellArgs(node, ansibleUsername, p.flavors[node].command(iface, ip))...)
+	case execProber:
+		return fmt.Sprintf("%s < %s", shellJoin(p.path), shellQuote(fmt.Sprintf(`{"node":%q,"interface":%q,"ip":%q}`, node, iface, ip)))
+	case teleportProber:
+		return p.commandLine(node, teleportArpingCommand(iface, ip))
+	case remoteProber:
+		return p.commandLine(node, arpingCommand(iface, ip))
+	case mockProber:
+		return fmt.Sprintf("mock probe of %s on %s", ip, node)
+	}
+	return fmt.Sprintf("plugin Probe(%q, %q, %q)", node, iface, ip)
+}
+
+// shellJoin renders a command line that can be pasted into a shell
+func shellJoin(name string, args ...string) string {
+	quoted := []string{shellQuote(name)}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote single-quotes s if it contains anything a shell would interpret
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@,+%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// inventoryGroup is a group of the Ansible dynamic inventory JSON
+type inventoryGroup struct {
+	Hosts    []string `json:"hosts,omitempty"`
+	Children []string `json:"children,omitempty"`
+}
+
+// inventoryHostVars returns the variables of node, the same ones the
+// generated static inventory sets
+func inventoryHostVars(node string, addresses map[string]string, ansibleUsername string) map[string]string {
+	vars := make(map[string]string)
+	if ansibleUsername != "" {
+		vars["ansible_user"] = ansibleUsername
+	}
+	if address, ok := addresses[node]; ok {
+		vars["ansible_host"] = address
+	}
+	return vars
+}
+
+// writeDynamicInventory answers an Ansible inventory script call: --list
+// prints every group with the host variables under _meta, so Ansible never
+// needs to call --host, and --host prints the variables of one node. The
+// groups are those of the static inventory: k8s, with control_plane and
+// workers as children.
+func writeDynamicInventory(w io.Writer, host string, nodes []string, addresses, roles map[string]string, ansibleUsername string) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if host != "" {
+		if !containsString(nodes, host) {
+			return encoder.Encode(map[string]string{})
+		}
+		return encoder.Encode(inventoryHostVars(host, addresses, ansibleUsername))
+	}
+
+	inventory := map[string]interface{}{}
+	k8s := inventoryGroup{Hosts: nodes}
+	hostvars := make(map[string]map[string]string)
+	for _, group := range []string{roleControlPlane, roleWorkers} {
+		var members []string
+		for _, node := range nodes {
+			if roles[node] == group {
+				members = append(members, node)
+			}
+		}
+		if len(members) > 0 {
+			inventory[group] = inventoryGroup{Hosts: members}
+			k8s.Children = append(k8s.Children, group)
+		}
+	}
+	for _, node := range nodes {
+		hostvars[node] = inventoryHostVars(node, addresses, ansibleUsername)
+	}
+	inventory["k8s"] = k8s
+	inventory["_meta"] = map[string]interface{}{"hostvars": hostvars}
+	return encoder.Encode(inventory)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// runError is a non-fatal error met during a run, such as a failed API call,
+// SSH connection or probe. They are collected and reported together at the
+// end instead of interleaving with the progress bar.
+type runError struct {
+	Phase   string `json:"phase"`
+	Subject string `json:"subject,omitempty"`
+	Error   string `json:"error"`
+	// Class is config, api, backend or probe when the error has one
+	Class string `json:"class,omitempty"`
+}
+
+// Exit codes. A run that completes but finds a problem, such as a policy
+// violation or drift, or fails with an unclassified error exits 1; failures
+// of a known class exit with that class's code.
+const (
+	exitFailure = 1
+	exitConfig  = 2
+	exitAPI     = 3
+	exitBackend = 4
+	exitProbe   = 5
+)
+
+// configError is an invalid flag, config file or kubeconfig
+type configError struct{ error }
+
+// apiError is a failed call to the Kubernetes API or another API the run
+// depends on, such as NetBox
+type apiError struct{ error }
+
+// backendError is a failure of the probe backend itself: Ansible, SSH, SSM,
+// Teleport or a debug pod could not run the probe
+type backendError struct{ error }
+
+// probeError is a probe that ran but failed or gave no usable answer
+type probeError struct{ error }
+
+func (e configError) Unwrap() error  { return e.error }
+func (e apiError) Unwrap() error     { return e.error }
+func (e backendError) Unwrap() error { return e.error }
+func (e probeError) Unwrap() error   { return e.error }
+
+// errorClass returns the class of err, or "" if it has none
+func errorClass(err error) string {
+	var (
+		config  configError
+		api     apiError
+		backend backendError
+		probe   probeError
+	)
+	switch {
+	case errors.As(err, &config):
+		return "config"
+	case errors.As(err, &api):
+		return "api"
+	case errors.As(err, &backend):
+		return "backend"
+	case errors.As(err, &probe):
+		return "probe"
+	}
+	return ""
+}
+
+// exitCode returns the exit code for a run failed by err
+func exitCode(err error) int {
+	switch errorClass(err) {
+	case "config":
+		return exitConfig
+	case "api":
+		return exitAPI
+	case "backend":
+		return exitBackend
+	case "probe":
+		return exitProbe
+	}
+	return exitFailure
+}
+
+// jsonFatal makes fatal print errors as JSON, set for --output json
+var jsonFatal bool
+
+// fatalError is the JSON form of the error that ended a run
+type fatalError struct {
+	Phase    string `json:"phase"`
+	Error    string `json:"error"`
+	Class    string `json:"class,omitempty"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// fatal reports the error that ends the run, while doing what, and exits
+// with the code of its class. With --output json the error is printed as a
+// JSON document with its class and exit code instead.
+func fatal(what string, err error) {
+	logf("error %s: %v", what, err)
+	code := exitCode(err)
+	if jsonFatal {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(struct {
+			Metadata runMetadata `json:"metadata"`
+			Error    fatalError  `json:"error"`
+		}{currentRun(), fatalError{Phase: what, Error: err.Error(), Class: errorClass(err), ExitCode: code}})
+	} else {
+		fmt.Printf("%sError %s: %v%s\n", ColorRed, what, err, ColorReset)
+	}
+	exitRun(code)
+}
+
+var (
+	runErrorsMu sync.Mutex
+	runErrors   []runError
+)
+
+// recordError logs err to the run log and keeps it for the Errors section.
+// phase says what was being done and subject what it was done to.
+func recordError(phase, subject string, err error) {
+	if subject != "" {
+		logf("error %s %s: %v", phase, subject, err)
+	} else {
+		logf("error %s: %v", phase, err)
+	}
+	runErrorsMu.Lock()
+	defer runErrorsMu.Unlock()
+	runErrors = append(runErrors, runError{Phase: phase, Subject: subject, Error: err.Error(), Class: errorClass(err)})
+}
+
+// collectedErrors returns the errors recorded so far
+func collectedErrors() []runError {
+	runErrorsMu.Lock()
+	defer runErrorsMu.Unlock()
+	return append([]runError(nil), runErrors...)
+}
+
+// resetErrors forgets the recorded errors, at the start of a daemon cycle
+func resetErrors() {
+	runErrorsMu.Lock()
+	defer runErrorsMu.Unlock()
+	runErrors = nil
+}
+
+// printErrors prints the Errors section of the table report
+func printErrors(errors []runError) {
+	if len(errors) == 0 {
+		return
+	}
+	fmt.Printf("\n%sErrors:%s\n", ColorRed, ColorReset)
+	table := newTable(os.Stdout)
+	table.SetHeader([]string{"Phase", "Subject", "Error"})
+	for _, e := range errors {
+		table.Append([]string{e.Phase, e.Subject, e.Error})
+	}
+	table.Render()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net/url"
+)
+
+// Run events sent to syslog
+const (
+	eventProbeStarted  = "probe_started"
+	eventProbeFinished = "probe_finished"
+	eventIPUnclaimed   = "ip_unclaimed"
+	eventIPMoved       = "ip_moved"
+)
+
+// syslogWriter receives structured run events when --log-syslog is set
+var syslogWriter *syslog.Writer
+
+// setupSyslog connects to the local syslog daemon ("local") or a remote one
+// given as udp://host:port or tcp://host:port.
+func setupSyslog(target string) error {
+	network, address := "", ""
+	if target != "local" {
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			return fmt.Errorf("invalid syslog target %q (expected local, udp://host:port or tcp://host:port)", target)
+		}
+		network, address = u.Scheme, u.Host
+	}
+
+	writer, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, "get_loadBalancerIP")
+	if err != nil {
+		return err
+	}
+	syslogWriter = writer
+	return nil
+}
+
+// emitEvent sends a structured run event as a JSON message to syslog and the
+// run log. Unclaimed and moved IPs are sent at warning severity.
+func emitEvent(event string, fields map[string]interface{}) {
+	payload := map[string]interface{}{"event": event}
+	for k, v := range fields {
+		payload[k] = v
+	}
+	message, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	logf("event %s", message)
+	if syslogWriter == nil {
+		return
+	}
+	if event == eventIPUnclaimed || event == eventIPMoved {
+		syslogWriter.Warning(string(message))
+	} else {
+		syslogWriter.Info(string(message))
+	}
+}
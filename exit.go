@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Teardowns such as deleting probe pods, removing decrypted keys and
+// flushing spans must run however the run ends, and os.Exit skips deferred
+// calls. They are registered with onExit instead and run by exitRun, by
+// main returning and by SIGINT or SIGTERM.
+var (
+	exitMu       sync.Mutex
+	exitHandlers []func(code int)
+	exitOnce     sync.Once
+)
+
+// onExit registers f to run with the exit code when the run ends. Handlers
+// run the latest registered first, like deferred calls.
+func onExit(f func(code int)) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	exitHandlers = append(exitHandlers, f)
+}
+
+// runExitHandlers runs the registered handlers once. A second caller, e.g.
+// a signal arriving during an exit, waits for the first to finish.
+func runExitHandlers(code int) {
+	exitOnce.Do(func() {
+		exitMu.Lock()
+		handlers := exitHandlers
+		exitHandlers = nil
+		exitMu.Unlock()
+		for i := len(handlers) - 1; i >= 0; i-- {
+			handlers[i](code)
+		}
+	})
+}
+
+// exitRun runs the exit handlers and exits with code. Use it instead of
+// os.Exit anywhere in the run.
+func exitRun(code int) {
+	runExitHandlers(code)
+	os.Exit(code)
+}
+
+// exitOnSignal runs the exit handlers and exits when SIGINT or SIGTERM
+// interrupts the run, with the shell's 128+signal code. The returned
+// function stops this, for daemon mode which shuts down on them itself.
+func exitOnSignal() (stop func()) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			logf("interrupted by %v", sig)
+			exitRun(128 + int(sig.(syscall.Signal)))
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// expectation is an IP and the node, by name or glob, that must host it
+type expectation struct {
+	IP   string
+	Node string
+}
+
+// expectations collects --expect ip=node flags; the flag may be repeated
+type expectations []expectation
+
+func (e *expectations) String() string {
+	var entries []string
+	for _, expected := range *e {
+		entries = append(entries, expected.IP+"="+expected.Node)
+	}
+	return strings.Join(entries, ",")
+}
+
+func (e *expectations) Set(value string) error {
+	expected, err := parseExpectation(value)
+	if err != nil {
+		return err
+	}
+	*e = append(*e, expected)
+	return nil
+}
+
+// parseExpectation parses ip=node
+func parseExpectation(value string) (expectation, error) {
+	ip, node, ok := strings.Cut(strings.TrimSpace(value), "=")
+	ip, node = strings.TrimSpace(ip), strings.TrimSpace(node)
+	if !ok || node == "" {
+		return expectation{}, fmt.Errorf("invalid expectation %q (expected ip=node)", value)
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return expectation{}, fmt.Errorf("invalid expectation %q: %v", value, err)
+	}
+	if _, err := path.Match(node, ""); err != nil {
+		return expectation{}, fmt.Errorf("invalid expectation %q: %v", value, err)
+	}
+	return expectation{IP: addr.String(), Node: node}, nil
+}
+
+// loadExpectations reads ip=node lines from path. Blank lines and lines
+// starting with # are skipped.
+func loadExpectations(path string) (expectations, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var loaded expectations
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		expected, err := parseExpectation(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, line, err)
+		}
+		loaded = append(loaded, expected)
+	}
+	return loaded, scanner.Err()
+}
+
+// unmetExpectation is an expectation the probed owners don't meet
+type unmetExpectation struct {
+	IP      string
+	Problem string
+}
+
+// checkExpectations returns every expectation whose IP is hosted by no node,
+// by another node, or by more than one
+func checkExpectations(expected expectations, hostingNodes [][]string) []unmetExpectation {
+	owners := make(map[string][]string)
+	for _, row := range hostingNodes {
+		owners[row[1]] = append(owners[row[1]], row[0])
+	}
+
+	var unmet []unmetExpectation
+	for _, e := range expected {
+		nodes := owners[e.IP]
+		sort.Strings(nodes)
+		switch {
+		case len(nodes) == 0:
+			unmet = append(unmet, unmetExpectation{IP: e.IP, Problem: fmt.Sprintf("expected on %s, but no node hosts it", e.Node)})
+		case len(nodes) > 1:
+			unmet = append(unmet, unmetExpectation{IP: e.IP, Problem: fmt.Sprintf("expected on %s, but it is hosted by %s", e.Node, strings.Join(nodes, ", "))})
+		default:
+			if matched, _ := path.Match(e.Node, nodes[0]); !matched {
+				unmet = append(unmet, unmetExpectation{IP: e.IP, Problem: fmt.Sprintf("expected on %s, but it is hosted by %s", e.Node, nodes[0])})
+			}
+		}
+	}
+	return unmet
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckExpectations(t *testing.T) {
+	expected := expectations{
+		{IP: "7.10.20.1", Node: "node-1"},
+		{IP: "7.10.20.2", Node: "edge-*"},
+		{IP: "7.10.20.3", Node: "node-1"},
+		{IP: "7.10.20.4", Node: "node-1"},
+		{IP: "7.10.20.5", Node: "edge-*"},
+	}
+	tests := []struct {
+		name string
+		rows [][]string
+		want []unmetExpectation
+	}{
+		{
+			name: "IPs no node hosts",
+			rows: [][]string{{"node-1", "7.10.20.1"}, {"edge-2", "7.10.20.2"}},
+			want: []unmetExpectation{
+				{IP: "7.10.20.3", Problem: "expected on node-1, but no node hosts it"},
+				{IP: "7.10.20.4", Problem: "expected on node-1, but no node hosts it"},
+				{IP: "7.10.20.5", Problem: "expected on edge-*, but no node hosts it"},
+			},
+		},
+		{
+			name: "wrong, shared and missing owners",
+			rows: [][]string{
+				{"node-1", "7.10.20.1"},
+				{"core-1", "7.10.20.2"},
+				{"node-2", "7.10.20.3"},
+				{"node-2", "7.10.20.4"},
+				{"node-1", "7.10.20.4"},
+				{"edge-1", "7.10.20.5"},
+			},
+			want: []unmetExpectation{
+				{IP: "7.10.20.2", Problem: "expected on edge-*, but it is hosted by core-1"},
+				{IP: "7.10.20.3", Problem: "expected on node-1, but it is hosted by node-2"},
+				{IP: "7.10.20.4", Problem: "expected on node-1, but it is hosted by node-1, node-2"},
+			},
+		},
+		{
+			name: "IPs nobody expects are ignored",
+			rows: [][]string{
+				{"node-1", "7.10.20.1"},
+				{"edge-1", "7.10.20.2"},
+				{"node-1", "7.10.20.3"},
+				{"node-1", "7.10.20.4"},
+				{"edge-1", "7.10.20.5"},
+				{"node-9", "7.10.20.99"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkExpectations(expected, tt.rows); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkExpectations() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
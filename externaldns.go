@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// externalDNSHostnameAnnotation lists the DNS names external-dns manages for a service
+	externalDNSHostnameAnnotation = "external-dns.alpha.kubernetes.io/hostname"
+	// externalDNSTargetAnnotation overrides the addresses those names point at
+	externalDNSTargetAnnotation = "external-dns.alpha.kubernetes.io/target"
+)
+
+// dnsCheck is the outcome of resolving one external-dns name of a service.
+// Status is ok, missing (the name doesn't resolve) or stale (it resolves to
+// addresses other than the service's).
+type dnsCheck struct {
+	Service  string
+	Hostname string
+	Expected []string
+	Resolved []string
+	Status   string
+}
+
+// checkExternalDNS resolves the names external-dns manages for every
+// LoadBalancer service and compares them with the service's LB IPs, or with
+// its target annotation when set. Wildcard names can't be resolved and are
+// skipped. Services whose LB has no IP yet are not checked.
+func checkExternalDNS(clientset kubernetes.Interface, dnsServer string) ([]dnsCheck, error) {
+	services, err := clientset.CoreV1().Services("").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var checks []dnsCheck
+	for _, service := range services.Items {
+		hostnames := service.Annotations[externalDNSHostnameAnnotation]
+		if service.Spec.Type != "LoadBalancer" || hostnames == "" {
+			continue
+		}
+		var expected []string
+		if target := service.Annotations[externalDNSTargetAnnotation]; target != "" {
+			for _, ip := range strings.Split(target, ",") {
+				if ip = strings.TrimSpace(ip); net.ParseIP(ip) != nil {
+					expected = append(expected, ip)
+				}
+			}
+		} else {
+			for _, ingress := range service.Status.LoadBalancer.Ingress {
+				if ingress.IP != "" {
+					expected = append(expected, ingress.IP)
+				}
+			}
+		}
+		if len(expected) == 0 {
+			continue
+		}
+
+		for _, hostname := range strings.Split(hostnames, ",") {
+			hostname = strings.TrimSuffix(strings.TrimSpace(hostname), ".")
+			if hostname == "" || strings.Contains(hostname, "*") {
+				continue
+			}
+			check := dnsCheck{Service: service.Namespace + "/" + service.Name, Hostname: hostname, Expected: expected}
+			resolved, err := lookupHostIPs(dnsServer, hostname)
+			var dnsErr *net.DNSError
+			switch {
+			case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+				check.Status = "missing"
+			case err != nil:
+				recordError("resolving external-dns name", hostname, err)
+				continue
+			case sameAddresses(resolved, expected):
+				check.Status = "ok"
+			default:
+				check.Status = "stale"
+			}
+			check.Resolved = resolved
+			checks = append(checks, check)
+		}
+	}
+	return checks, nil
+}
+
+// sameAddresses reports whether a and b hold the same IPv4 addresses in any
+// order. IPv6 expectations are ignored since only A records are resolved.
+func sameAddresses(a, b []string) bool {
+	var want []string
+	for _, ip := range b {
+		if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() != nil {
+			want = append(want, ip)
+		}
+	}
+	got := append([]string(nil), a...)
+	sort.Strings(got)
+	sort.Strings(want)
+	return strings.Join(got, ",") == strings.Join(want, ",")
+}
+
+// printDNSChecks prints the external-dns cross-check of the table report
+func printDNSChecks(checks []dnsCheck) {
+	if len(checks) == 0 {
+		return
+	}
+	fmt.Println("\nexternal-dns records:")
+	table := newTable(os.Stdout)
+	table.SetHeader([]string{"Service", "Hostname", "LB IP", "Resolves To", "Status"})
+	for _, check := range checks {
+		status := check.Status
+		if status != "ok" {
+			status = ColorRed + status + ColorReset
+		}
+		table.Append([]string{check.Service, check.Hostname, strings.Join(check.Expected, ", "), strings.Join(check.Resolved, ", "), status})
+	}
+	table.Render()
+}
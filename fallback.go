@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// fallbackProber probes through the selected backend and moves a node over
+// to an nsenter debug pod once the backend fails for it, e.g. because of a
+// broken SSH key, so that node is still part of the report. Probes cut off
+// by --node-timeout can't fall back, since their deadline has passed.
+type fallbackProber struct {
+	primary  Prober
+	fallback *nsenterProber
+
+	mu       sync.Mutex
+	fellBack map[string]bool
+}
+
+func newFallbackProber(primary Prober, fallback *nsenterProber) *fallbackProber {
+	return &fallbackProber{primary: primary, fallback: fallback, fellBack: make(map[string]bool)}
+}
+
+func (p *fallbackProber) Probe(ctx context.Context, node, iface, ip string) ProbeResult {
+	p.mu.Lock()
+	fellBack := p.fellBack[node]
+	p.mu.Unlock()
+
+	if !fellBack {
+		result := p.primary.Probe(ctx, node, iface, ip)
+		if (!result.Unreachable && result.Err == nil) || ctx.Err() != nil {
+			return result
+		}
+		p.mu.Lock()
+		if !p.fellBack[node] {
+			p.fellBack[node] = true
+			logf("probing %s failed (%v), falling back to a debug pod", node, result.Err)
+		}
+		p.mu.Unlock()
+	}
+
+	result := p.fallback.Probe(ctx, node, iface, ip)
+	if result.Err != nil {
+		// Without a working pod either, the node is unreachable
+		result.Unreachable = true
+	}
+	result.Detail = "debug pod"
+	return result
+}
+
+// fallbackNodes returns the nodes that were probed through a debug pod
+func (p *fallbackProber) fallbackNodes() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var nodes []string
+	for node := range p.fellBack {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// resultField is a result column that --fields can select. Name is both
+// the --fields name and the JSON key.
+type resultField struct {
+	Name   string
+	Header string
+	value  func(row reportRow) interface{}
+}
+
+// resultFields are the selectable fields, in the default column order
+var resultFields = []resultField{
+	{"node", "Node Name", func(r reportRow) interface{} { return r.Node }},
+	{"ip", "LoadBalancer IP", func(r reportRow) interface{} { return r.IP }},
+	{"source", "Source", func(r reportRow) interface{} { return r.Source }},
+	{"services", "Services", func(r reportRow) interface{} { return r.Services }},
+	{"ports", "Ports", func(r reportRow) interface{} { return r.Ports }},
+	{"pool", "Pool", func(r reportRow) interface{} { return r.Pool }},
+	{"speaker", "Speaker Pod", func(r reportRow) interface{} { return r.Speaker }},
+	{"protocol", "Protocol", func(r reportRow) interface{} { return r.Protocol }},
+	{"ptr", "Reverse DNS", func(r reportRow) interface{} { return r.PTR }},
+	{"mac", "Responder MAC", func(r reportRow) interface{} { return r.MAC }},
+	{"vendor", "Vendor", func(r reportRow) interface{} { return r.Vendor }},
+	{"udpProbe", "UDP Probe", func(r reportRow) interface{} { return r.UDPProbe }},
+	{"flapping", "Flapping", func(r reportRow) interface{} { return r.Flapping }},
+	{"flaps", "Flaps", func(r reportRow) interface{} { return r.Flaps }},
+}
+
+// fieldAliases accepts the singular of the list fields
+var fieldAliases = map[string]string{"service": "services", "port": "ports"}
+
+// selectedFields are the fields chosen with --fields, in order. When empty
+// every output keeps its default columns.
+var selectedFields []resultField
+
+// parseFields parses a comma-separated --fields list
+func parseFields(value string) ([]resultField, error) {
+	var fields []resultField
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if alias, ok := fieldAliases[name]; ok {
+			name = alias
+		}
+		found := false
+		for _, field := range resultFields {
+			if field.Name == name {
+				fields, found = append(fields, field), true
+				break
+			}
+		}
+		if !found {
+			var names []string
+			for _, field := range resultFields {
+				names = append(names, field.Name)
+			}
+			return nil, fmt.Errorf("unknown field %q; choose from %s", name, strings.Join(names, ", "))
+		}
+	}
+	return fields, nil
+}
+
+// fieldHeaders returns the table headers of fields
+func fieldHeaders(fields []resultField) []string {
+	headers := make([]string, len(fields))
+	for i, field := range fields {
+		headers[i] = field.Header
+	}
+	return headers
+}
+
+// fieldCells returns the fields of row as table or CSV cells, joining lists
+// with sep
+func fieldCells(fields []resultField, row reportRow, sep string) []string {
+	cells := make([]string, len(fields))
+	for i, field := range fields {
+		switch v := field.value(row).(type) {
+		case string:
+			cells[i] = v
+		case []string:
+			cells[i] = strings.Join(v, sep)
+		case bool:
+			cells[i] = strconv.FormatBool(v)
+		case int:
+			cells[i] = strconv.Itoa(v)
+		}
+	}
+	return cells
+}
+
+// fieldObject is a result row holding only the selected fields, marshaled
+// with its keys in the order they were selected
+type fieldObject struct {
+	fields []resultField
+	row    reportRow
+}
+
+func (o fieldObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, field := range o.fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value, err := json.Marshal(field.value(o.row))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "%q:%s", field.Name, value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// fieldReport is a report whose results hold only the selected fields
+type fieldReport struct {
+	report
+	Results []fieldObject `json:"results"`
+}
+
+func newFieldReport(r report, fields []resultField) fieldReport {
+	results := make([]fieldObject, len(r.Results))
+	for i, row := range r.Results {
+		results[i] = fieldObject{fields: fields, row: row}
+	}
+	return fieldReport{report: r, Results: results}
+}
+
+// fieldSelected reports whether --fields selects the named field, for data
+// only gathered on demand such as reverse DNS
+func fieldSelected(name string) bool {
+	for _, field := range selectedFields {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
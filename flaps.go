@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// flapTracker counts how often each IP changed owner within a sliding
+// window across daemon cycles
+type flapTracker struct {
+	window time.Duration
+	owners map[string]string
+	moves  map[string][]time.Time
+}
+
+func newFlapTracker(window time.Duration) *flapTracker {
+	return &flapTracker{window: window, owners: make(map[string]string), moves: make(map[string][]time.Time)}
+}
+
+// observe records the owners found by a cycle finished at and returns the
+// number of owner changes of each IP within the window, leaving out IPs
+// that didn't change. Like the daemon's move reports, an IP hosted by no
+// node keeps its last owner.
+func (t *flapTracker) observe(hostingNodes [][]string, at time.Time) map[string]int {
+	owners := make(map[string][]string)
+	for _, row := range hostingNodes {
+		owners[row[1]] = append(owners[row[1]], row[0])
+	}
+	for ip, nodes := range owners {
+		sort.Strings(nodes)
+		current := strings.Join(nodes, ",")
+		if previous, ok := t.owners[ip]; ok && previous != current {
+			t.moves[ip] = append(t.moves[ip], at)
+		}
+		t.owners[ip] = current
+	}
+
+	counts := make(map[string]int)
+	cutoff := at.Add(-t.window)
+	for ip, moves := range t.moves {
+		kept := moves[:0]
+		for _, move := range moves {
+			if move.After(cutoff) {
+				kept = append(kept, move)
+			}
+		}
+		if len(kept) == 0 {
+			delete(t.moves, ip)
+			continue
+		}
+		t.moves[ip] = kept
+		counts[ip] = len(kept)
+	}
+	return counts
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFlapTrackerObserve(t *testing.T) {
+	start := time.Date(2026, time.October, 14, 12, 0, 0, 0, time.UTC)
+	tracker := newFlapTracker(10 * time.Minute)
+
+	// Each step is one daemon cycle, observed in order
+	steps := []struct {
+		name  string
+		after time.Duration
+		rows  [][]string
+		want  map[string]int
+	}{
+		{name: "first owner is no move", after: 0, rows: [][]string{{"node-a", "7.10.20.1"}, {"node-b", "7.10.20.2"}}, want: map[string]int{}},
+		{name: "owner changes", after: time.Minute, rows: [][]string{{"node-b", "7.10.20.1"}, {"node-b", "7.10.20.2"}}, want: map[string]int{"7.10.20.1": 1}},
+		{name: "unhosted keeps the last owner", after: 2 * time.Minute, rows: nil, want: map[string]int{"7.10.20.1": 1}},
+		{name: "back on the same owner after a gap", after: 3 * time.Minute, rows: [][]string{{"node-b", "7.10.20.1"}}, want: map[string]int{"7.10.20.1": 1}},
+		{name: "shared owners in any order", after: 4 * time.Minute, rows: [][]string{{"node-b", "7.10.20.1"}, {"node-a", "7.10.20.1"}}, want: map[string]int{"7.10.20.1": 2}},
+		{name: "same shared owners", after: 5 * time.Minute, rows: [][]string{{"node-a", "7.10.20.1"}, {"node-b", "7.10.20.1"}}, want: map[string]int{"7.10.20.1": 2}},
+		{name: "old moves leave the window", after: 12 * time.Minute, rows: [][]string{{"node-a", "7.10.20.1"}, {"node-b", "7.10.20.1"}}, want: map[string]int{"7.10.20.1": 1}},
+		{name: "all moves left the window", after: 15 * time.Minute, rows: [][]string{{"node-a", "7.10.20.1"}, {"node-b", "7.10.20.1"}}, want: map[string]int{}},
+	}
+	for _, step := range steps {
+		if got := tracker.observe(step.rows, start.Add(step.after)); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: observe() = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
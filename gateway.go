@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// runGatewayARPLookup reads the ARP table of the gateway and maps the MAC
+// address answering for each LB IP back to the node whose interface owns it.
+// It also returns the responder MAC of every LB IP in the table, including
+// those no node owns.
+func runGatewayARPLookup(gatewayHost, gatewayUser, arpCommand, arpInterface string, lbIPs []string, ansibleUsername string) ([][]string, map[string]string, error) {
+	var hostingNodes [][]string
+	responders := make(map[string]string)
+
+	// Learn the MAC address of the ARP interface on every node
+	nodeMACs, err := getNodeMACAddresses(arpInterface, ansibleUsername)
+	if err != nil {
+		return hostingNodes, responders, err
+	}
+
+	// Dump the gateway's ARP table over SSH
+	cmd := exec.Command("ssh", gatewaySSHArgs(gatewayHost, gatewayUser, arpCommand)...)
+	out, err := runCommand(cmd)
+	if err != nil {
+		return hostingNodes, responders, fmt.Errorf("running %q on %s: %v: %s", arpCommand, gatewayHost, err, strings.TrimSpace(string(out)))
+	}
+	arpTable := parseARPTable(string(out))
+
+	// Match each LB IP to the node that owns the MAC the gateway has learned
+	for _, ip := range lbIPs {
+		mac, ok := arpTable[ip]
+		if !ok {
+			continue
+		}
+		responders[ip] = mac
+		if node, ok := nodeMACs[mac]; ok {
+			hostingNodes = append(hostingNodes, []string{node, ip})
+		}
+	}
+
+	return hostingNodes, responders, nil
+}
+
+// gatewaySSHArgs returns the ssh arguments that run command on the gateway
+func gatewaySSHArgs(gatewayHost, gatewayUser, command string) []string {
+	args := append([]string{"-o", "BatchMode=yes"}, sshOptions...)
+	return append(args, fmt.Sprintf("%s@%s", gatewayUser, gatewayHost), command)
+}
+
+// getNodeMACAddresses returns a map of MAC address to node name for the given
+// interface on every node in the inventory.
+func getNodeMACAddresses(arpInterface, ansibleUsername string) (map[string]string, error) {
+	cmd := exec.Command(ansiblePath, ansibleShellArgs("k8s", ansibleUsername, macAddressCommand(arpInterface))...)
+	// A failure on some nodes still leaves usable output for the others
+	out, _ := runCommand(cmd)
+
+	nodeMACs := make(map[string]string)
+	for node, output := range parseAnsibleOutput(string(out)) {
+		if mac := normalizeMAC(output); mac != "" {
+			nodeMACs[mac] = node
+		}
+	}
+	if len(nodeMACs) == 0 {
+		return nil, fmt.Errorf("could not read the MAC address of %s on any node", arpInterface)
+	}
+	return nodeMACs, nil
+}
+
+// parseARPTable extracts IP to MAC entries from ARP table output. It accepts
+// the common formats of `ip neigh`, `arp -an` and Cisco-style `show ip arp`,
+// picking the first IPv4 address and the first MAC address on each line.
+// Output of `ip -json neigh` is recognized and parsed as JSON.
+func parseARPTable(out string) map[string]string {
+	if strings.HasPrefix(strings.TrimSpace(out), "[") {
+		if table, err := parseNeighJSON(out); err == nil {
+			return table
+		}
+	}
+
+	table := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		var ip, mac string
+		for _, field := range strings.Fields(line) {
+			field = strings.Trim(field, "()")
+			if ip == "" {
+				if parsed := net.ParseIP(field); parsed != nil && parsed.To4() != nil {
+					ip = field
+					continue
+				}
+			}
+			if mac == "" {
+				mac = normalizeMAC(field)
+			}
+		}
+		if ip != "" && mac != "" {
+			table[ip] = mac
+		}
+	}
+	return table
+}
+
+// normalizeMAC returns the MAC address in lowercase colon-separated form, or
+// an empty string if s is not a MAC address.
+func normalizeMAC(s string) string {
+	hw, err := net.ParseMAC(strings.TrimSpace(s))
+	if err != nil || len(hw) != 6 {
+		return ""
+	}
+	return hw.String()
+}
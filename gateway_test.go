@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseARPTable(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want map[string]string
+	}{
+		{
+			name: "ip neigh",
+			out:  "7.10.20.5 dev eth0 lladdr 52:54:00:AA:BB:01 REACHABLE\n7.10.20.6 dev eth0 lladdr 52:54:00:aa:bb:02 STALE\n7.10.20.7 dev eth0  FAILED",
+			want: map[string]string{"7.10.20.5": "52:54:00:aa:bb:01", "7.10.20.6": "52:54:00:aa:bb:02"},
+		},
+		{
+			name: "arp -an",
+			out:  "? (7.10.20.5) at 52:54:00:aa:bb:01 [ether] on eth0\n? (7.10.20.9) at <incomplete> on eth0",
+			want: map[string]string{"7.10.20.5": "52:54:00:aa:bb:01"},
+		},
+		{
+			name: "cisco show ip arp",
+			out:  "Protocol  Address          Age (min)  Hardware Addr   Type   Interface\nInternet  7.10.20.5               3   5254.00aa.bb01  ARPA   Vlan20",
+			want: map[string]string{"7.10.20.5": "52:54:00:aa:bb:01"},
+		},
+		{
+			name: "ip -json neigh",
+			out:  `[{"dst":"7.10.20.5","dev":"eth0","lladdr":"52:54:00:aa:bb:01","state":["REACHABLE"]}]`,
+			want: map[string]string{"7.10.20.5": "52:54:00:aa:bb:01"},
+		},
+		{name: "empty", out: "", want: map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseARPTable(tt.out); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseARPTable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
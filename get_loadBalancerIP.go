@@ -7,19 +7,27 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"os/user"
-	"path/filepath"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/olekukonko/tablewriter"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
-// ANSI color codes for terminal output
-const (
+// ANSI color codes for terminal output. They are variables so --quiet can
+// blank them out.
+var (
 	ColorReset  = "\033[0m"
 	ColorRed    = "\033[31m"
 	ColorGreen  = "\033[32m"
@@ -31,98 +39,1585 @@ const (
 	Bold        = "\033[1m"
 )
 
-// Spinner animation characters
-var (
-	chars = []string{"|", "/", "-", "\\"}
-)
+// quiet suppresses the banner, prompts, colors, progress and separators so only
+// the structured result is printed
+var quiet bool
+
+// disableColors blanks every ANSI color code
+func disableColors() {
+	ColorReset, ColorRed, ColorGreen, ColorYellow, ColorBlue = "", "", "", "", ""
+	ColorPurple, ColorCyan, ColorWhite, Bold = "", "", "", ""
+}
 
 func main() {
+	// Teardowns are registered with onExit, since the run exits through
+	// exitRun in many places
+	defer runExitHandlers(0)
+	stopSignals := exitOnSignal()
+
 	// Get current user
 	currentUser, err := user.Current()
 	if err != nil {
 		fmt.Printf("%sError getting current user: %v%s\n", ColorRed, err, ColorReset)
-		os.Exit(1)
+		exitRun(1)
 	}
 
 	// Path to the kubeconfig file
 	var kubeconfig string
-	flag.StringVar(&kubeconfig, "kubeconfig", filepath.Join(currentUser.HomeDir, ".kube", "config"), "path to the kubeconfig file")
+	flag.StringVar(&kubeconfig, "kubeconfig", "", "path to the kubeconfig file (default: the files listed in $KUBECONFIG, merged, or ~/.kube/config)")
+	var tuiMode bool
+	var mockDir string
+	var dryRun bool
+	var playbookPath string
+	flag.StringVar(&playbookPath, "emit-playbook", "", "write an Ansible playbook that probes the selected IPs to this path instead of probing")
+	flag.BoolVar(&dryRun, "dry-run", false, "print the nodes, interface, IPs, inventory and remote commands that would be used, without executing them")
+	flag.StringVar(&mockDir, "mock", "", "run offline against nodes, services and canned probe answers from this fixtures directory")
+	flag.BoolVar(&tuiMode, "tui", false, "run the interactive terminal UI (ansible arping backend only)")
+	var streamFormat, outputFormat, groupBy string
+	flag.StringVar(&streamFormat, "stream", "", "print each result as soon as it is confirmed: table, jsonl or log, or live to redraw a result table in place")
+	flag.StringVar(&outputFormat, "output", "table", "format of the final result: table, wide (table plus protocol and reverse DNS columns), json, csv or html")
+	flag.StringVar(&tables.Border, "table-border", tables.Border, "table borders: box, markdown or none (plain columns, for terminals that render box borders poorly)")
+	flag.StringVar(&tables.Align, "table-align", tables.Align, "alignment of table cells: auto (numbers right, text left), left, center or right")
+	flag.BoolVar(&tables.AutoWrap, "table-wrap", tables.AutoWrap, "wrap table cells longer than --table-max-width; set --table-wrap=false to keep long service names on one line")
+	flag.IntVar(&tables.MaxWidth, "table-max-width", tables.MaxWidth, "column width in characters above which table cells wrap")
+	flag.BoolVar(&tables.RowLines, "table-row-lines", false, "draw a separator line between table rows")
+	var fieldsFlag string
+	flag.StringVar(&fieldsFlag, "fields", "", "comma-separated fields to show, in order, in table, CSV and JSON output (e.g. node,ip,service,mac): node, ip, source, services, ports, pool, speaker, protocol, ptr, mac, vendor, udpProbe, flapping or flaps")
+	var openReport bool
+	flag.BoolVar(&openReport, "open", false, "also write the result as an HTML page to a temporary file and open it in the default browser")
+	var outputFile string
+	flag.StringVar(&outputFile, "output-file", "", "write the final result to this file instead of stdout, atomically and creating its directories; the format follows the extension (.json, .csv, .html or .txt) unless --output is given")
+	var noPager bool
+	flag.BoolVar(&noPager, "no-pager", false, "print a table report taller than the terminal directly instead of through $PAGER (default less -R)")
+	var logFile string
+	var logMaxSize, logMaxBackups int
+	flag.StringVar(&groupBy, "group-by", "", "group the result table by: pool (the MetalLB or Cilium pool of each IP)")
+	var reportByNamespace bool
+	flag.BoolVar(&reportByNamespace, "report-by-namespace", false, "print one result section per namespace of the services using each IP, so each tenant can be handed only its part")
+	var tenantLabel string
+	flag.StringVar(&tenantLabel, "tenant-label", "", "with --report-by-namespace, group namespaces into sections by the value of this namespace label (e.g. tenant)")
+	flag.StringVar(&logFile, "log-file", "", "append a log of probes, remote command output and errors to this file")
+	flag.IntVar(&logMaxSize, "log-max-size", 10, "rotate the log file once it exceeds this many megabytes")
+	flag.IntVar(&logMaxBackups, "log-max-backups", 3, "number of rotated log files to keep")
+	var auditLogPath string
+	flag.StringVar(&auditLogPath, "audit-log", "", "append a JSON line recording who ran the tool, against which cluster, with which flags and with what result to this file")
+	var logSyslog string
+	flag.StringVar(&logSyslog, "log-syslog", "", "send run events to syslog: local, udp://host:port or tcp://host:port")
+	var otelEndpoint string
+	var otelInsecure bool
+	flag.StringVar(&otelEndpoint, "otel-endpoint", "", "export OpenTelemetry traces of discovery and probe phases to this OTLP/gRPC endpoint (host:port)")
+	flag.BoolVar(&otelInsecure, "otel-insecure", false, "connect to the OTLP endpoint without TLS")
+	var serveAddr string
+	var interval time.Duration
+	var enablePprof bool
+	flag.StringVar(&serveAddr, "serve", "", "run as a daemon probing every --interval and serving HTTP on this address (e.g. :8080); requires --ansible-user and --all or --ips")
+	flag.DurationVar(&interval, "interval", 5*time.Minute, "time between probe cycles in daemon mode")
+	var archive reportArchive
+	flag.StringVar(&archive.dir, "archive-dir", "", "in daemon mode, keep each cycle's JSON report in a dated directory per day under this directory")
+	flag.BoolVar(&archive.compress, "archive-gzip", false, "gzip the reports kept in --archive-dir")
+	flag.DurationVar(&archive.retention, "retention", 7*24*time.Hour, "prune reports in --archive-dir older than this; 0 keeps them all")
+	var useCache bool
+	flag.BoolVar(&useCache, "use-cache", false, "in daemon mode, keep probing against the last known node and service lists while the Kubernetes API is unavailable, marking results as based on stale inventory")
+	var cacheTTL time.Duration
+	flag.DurationVar(&cacheTTL, "cache-ttl", 15*time.Minute, "with --use-cache, how long the last known inventory may stand in for the Kubernetes API")
+	var flapWindow time.Duration
+	flag.DurationVar(&flapWindow, "flap-window", time.Hour, "in daemon mode, count how often each IP changed owner within this sliding window")
+	var schedule string
+	flag.StringVar(&schedule, "schedule", "", "run as a daemon probing at the times of this cron expression (e.g. \"0 */6 * * *\" or @hourly) instead of every --interval; combine with --serve to also serve HTTP")
+	flag.BoolVar(&enablePprof, "pprof", false, "expose net/http/pprof endpoints under /debug/pprof/ in daemon mode")
+	var enableTrigger bool
+	flag.BoolVar(&enableTrigger, "trigger", false, "with --serve, accept POST /v1/trigger to probe the IPs it names right away and answer with the result; callers authenticate with the bearer token from LBIP_TRIGGER_TOKEN")
+	var grpcAddr string
+	flag.StringVar(&grpcAddr, "grpc-addr", "", "also serve the gRPC Prober API with streaming results on this address in daemon mode (e.g. :9090)")
+	var progressStyle string
+	flag.StringVar(&progressStyle, "progress", "bar", "progress display: bar, redrawn in place, or plain, a timestamped line per node for CI logs")
+	flag.BoolVar(&quiet, "quiet", false, "print only the result: no banner, prompts, colors or progress (requires --ansible-user and --all or --ips)")
+
+	// Answers to the interactive prompts
+	var ansibleUserFlag, ipsFlag string
+	var allIPs bool
+	flag.StringVar(&ansibleUserFlag, "ansible-user", "", "Ansible username to run ARP command (skips the prompt)")
+	var sshStrictHostKeyChecking, sshKnownHosts string
+	flag.StringVar(&sshStrictHostKeyChecking, "ssh-strict-host-key-checking", "", "SSH host key policy for the ansible and gateway backends: yes, no or accept-new (default: inherit the environment)")
+	flag.StringVar(&sshKnownHosts, "ssh-known-hosts", "", "known_hosts file used to verify node and gateway host keys")
+	var ssmRegion, teleportProxy, teleportLogin, talosconfig, bgpRouter string
+	var nsenterNamespace, nsenterImage, nsenterBinary string
+	flag.StringVar(&nsenterNamespace, "nsenter-namespace", "default", "namespace the nsenter backend starts its privileged probe pods in")
+	flag.StringVar(&nsenterImage, "nsenter-image", "busybox:stable", "image of the nsenter backend's probe pods; must provide nsenter, sh and tar")
+	flag.StringVar(&nsenterBinary, "nsenter-prober", "", "statically linked arping-compatible binary copied into the nsenter backend's probe pods")
+	var consensus int
+	var consensusSpread time.Duration
+	flag.IntVar(&consensus, "consensus", 1, "probe each IP this many times from every node and report the majority answer, flagging IPs whose answers differ as FLAPPING")
+	flag.DurationVar(&consensusSpread, "consensus-spread", 0, "with --consensus, spread each IP's probes evenly over this long (e.g. 3s)")
+	var precheck string
+	flag.StringVar(&precheck, "precheck", "", "check every node at once before probing and exclude those that don't answer: tcp (connect to SSH port 22) or ping (Ansible ping)")
+	var fallbackDebugPod bool
+	flag.BoolVar(&fallbackDebugPod, "fallback-debug-pod", false, "probe a node from an nsenter debug pod when the ansible, ssm or teleport backend fails for it; uses the --nsenter-* flags and requires --nsenter-prober")
+	flag.StringVar(&bgpRouter, "bgp-router", "", "gobgp API (host[:port]) of the route reflector whose RIB the bgp backend reads")
+	flag.StringVar(&talosconfig, "talosconfig", "", "talosconfig file for the talos backend (default: the talosctl default)")
+	flag.StringVar(&ssmRegion, "ssm-region", "", "AWS region for the ssm backend (default: the aws CLI configuration)")
+	flag.StringVar(&teleportProxy, "teleport-proxy", "", "Teleport proxy for the teleport backend (default: the current tsh profile)")
+	flag.StringVar(&teleportLogin, "teleport-login", "", "node login for the teleport backend (default: the tsh default)")
+	var vaultAddr, vaultPath string
+	flag.StringVar(&vaultAddr, "vault-addr", os.Getenv("VAULT_ADDR"), "Vault server address used with --vault-path")
+	flag.StringVar(&vaultPath, "vault-path", "", "Vault secret path holding the SSH private_key (and optional certificate) for the ansible and gateway backends")
+	var ansibleExtraArgsFlag, inventoryOut, inventoryIn, nodeAddressType string
+	flag.StringVar(&nodeAddressType, "node-address-type", "InternalIP", "node address written as ansible_host in the inventory: InternalIP, ExternalIP or none")
+	flag.StringVar(&inventoryOut, "inventory-out", "", "write the generated inventory to this path and keep it")
+	flag.StringVar(&inventoryIn, "inventory-in", "", "use this existing inventory (its [k8s] group) instead of discovering nodes")
+	flag.StringVar(&ansiblePath, "ansible-path", "ansible", "path to the ansible binary")
+	flag.StringVar(&ansibleExtraArgsFlag, "ansible-extra-args", "", "extra arguments passed to every ansible command, e.g. \"-e ansible_ssh_common_args='-o StrictHostKeyChecking=no'\"")
+	flag.BoolVar(&allIPs, "all", false, "probe all LoadBalancer IPs (skips the prompt)")
+	var ipFile string
+	flag.StringVar(&ipFile, "ip-file", "", "file of LB IPs, CIDRs or ranges to probe, one or more per line; # starts a comment (skips the prompt)")
+	flag.StringVar(&ipsFlag, "ips", "", "comma-separated LB IPs, CIDRs or ranges to probe (skips the prompt), or - to read them from stdin separated by newlines or commas")
+	var terraformState, terraformOutputs string
+	flag.StringVar(&terraformState, "ips-from-terraform", "", "probe the IPs in the outputs of this Terraform state file or `terraform output -json` file, and fail unless a node announces each (skips the prompt)")
+	flag.StringVar(&terraformOutputs, "terraform-outputs", "", "with --ips-from-terraform, comma-separated names of the outputs to read (default: all)")
+
+	// Probe backend options
+	var backend, probeMethod, gatewayHost, gatewayUser, gatewayARPCommand string
+	flag.StringVar(&backend, "backend", "ansible", "probe backend to use: ansible (run on every node), gateway (read the gateway ARP table), servicelb (k3s svclb pod placement, cross-checked with ARP), ssm (arping through AWS SSM on EC2 nodes), teleport (arping through tsh ssh), talos (link addresses and neighbor tables of Talos nodes, via the Talos API), nsenter (privileged pod per node, for OSes without arping) or bgp (next hops of BGP-mode LB routes on a gobgp route reflector)")
+	var proberSpec string
+	flag.StringVar(&proberSpec, "prober", "arping", "prober used by the ansible backend's arping method: arping, plugin:<path.so> or exec:<path>")
+	flag.StringVar(&probeMethod, "probe-method", "arping", "how ownership is resolved: arping (active probe) or neigh (read existing neighbor entries)")
+	flag.StringVar(&gatewayHost, "gateway", "", "gateway/router host whose ARP table is read by the gateway backend")
+	flag.StringVar(&gatewayUser, "gateway-user", "", "SSH username for the gateway (defaults to the Ansible username)")
+	flag.StringVar(&gatewayARPCommand, "gateway-arp-command", "ip neigh show", "command run on the gateway to dump its ARP table (e.g. 'arp -an' or 'show ip arp')")
+
+	// Discovery options
+	var discovery discoveryOptions
+	flag.BoolVar(&discovery.IncludeExternalIPs, "include-external-ips", false, "also collect and probe service spec.externalIPs")
+	flag.BoolVar(&discovery.IncludeIngress, "include-ingress", false, "also collect and probe addresses from Ingress status.loadBalancer")
+	flag.BoolVar(&discovery.IncludeGateways, "include-gateways", false, "also collect and probe addresses from Gateway API status.addresses")
+	flag.BoolVar(&discovery.IncludeKeepalived, "include-keepalived", false, "also collect and probe the keepalived VRRP VIPs configured on the nodes (ansible backends only)")
+	flag.StringVar(&discovery.DNSServer, "dns-server", "", "DNS server (host[:port]) used to resolve hostname-based LoadBalancer ingress entries (defaults to the system resolver)")
+	flag.StringVar(&discovery.ExcludeNamespaces, "exclude-namespaces", "", "comma-separated namespaces, or globs, whose services, ingresses and gateways are left out of the report, e.g. kube-system,monitoring")
+	flag.BoolVar(&discovery.AnnotatedOnly, "annotated-only", false, "only probe services annotated "+probeAnnotation+"=true, for clusters where teams enroll selectively; ingresses and gateways are still added by their own flags")
+	var poolFilter string
+	flag.StringVar(&poolFilter, "pool", "", "only probe the LB IPs of these comma-separated MetalLB or Cilium pools, e.g. during a pool's maintenance; a service's MetalLB pool annotations take precedence over the pool ranges")
+	flag.StringVar(&discovery.LBClass, "lb-class", "", "only consider services whose spec.loadBalancerClass is in this comma-separated list, e.g. metallb or kube-vip.io/kube-vip-class")
+	var udpProbe bool
+	flag.BoolVar(&udpProbe, "udp-probe", false, "also send a UDP probe to the exposed UDP ports of each LB IP and report whether they answer")
+	var conflictContexts string
+	flag.StringVar(&conflictContexts, "conflict-contexts", "", "comma-separated kubeconfig contexts of other clusters on the same segment; warn about LB IPs also assigned or pooled there")
+	var probeRate, probeRatePerNode float64
+	flag.Float64Var(&probeRate, "probe-rate", 0, "maximum probes per second across all nodes, to stay under switch ARP rate limits (default: unlimited)")
+	flag.Float64Var(&probeRatePerNode, "probe-rate-per-node", 0, "maximum probes per second sent from a single node (default: unlimited)")
+	var alertRulesPath string
+	flag.StringVar(&alertRulesPath, "alert-rules", "", "with --serve, YAML file of alert rules (ip-unclaimed, ip-moved, duplicate-owner, node-unreachable, or ip-flapping for more owner changes within --flap-window than the rule's threshold, default 3) and their notification targets")
+	var grafanaURL string
+	flag.StringVar(&grafanaURL, "grafana-url", "", "with --serve, add a Grafana annotation whenever an IP moves between nodes; the token comes from GRAFANA_TOKEN")
+	var leaderElect bool
+	var leaderElectNamespace string
+	flag.BoolVar(&leaderElect, "leader-elect", false, "with --serve, probe only on the replica holding the coordination.k8s.io Lease")
+	leaseNamespace := os.Getenv("POD_NAMESPACE")
+	if leaseNamespace == "" {
+		leaseNamespace = "default"
+	}
+	flag.StringVar(&leaderElectNamespace, "leader-elect-namespace", leaseNamespace, "namespace of the leader election Lease")
+	var debugArtifacts string
+	flag.StringVar(&debugArtifacts, "debug-artifacts", "", "save the stdout and stderr of every remote command to a per-run directory under this path")
+	var interfaceCacheTTL time.Duration
+	var refreshInterfaces bool
+	flag.DurationVar(&interfaceCacheTTL, "interface-cache-ttl", 24*time.Hour, "how long a detected interface is reused from the local cache (0 disables the cache)")
+	flag.BoolVar(&refreshInterfaces, "refresh-interfaces", false, "detect the interface again instead of using the cache")
+	var stateFile string
+	var resume bool
+	flag.StringVar(&stateFile, "state-file", "", "checkpoint every completed probe to this file, removed once the run completes")
+	flag.BoolVar(&resume, "resume", false, "continue an interrupted run from --state-file instead of starting over")
+	var nodeTimeout time.Duration
+	flag.DurationVar(&nodeTimeout, "node-timeout", 0, "mark a node UNREACHABLE and skip it when a probe gets no answer within this time (default: no limit)")
+	var includeNodes, excludeNodes string
+	flag.StringVar(&includeNodes, "include-nodes", "", "comma-separated node names or glob patterns to probe from (default: all nodes)")
+	flag.StringVar(&excludeNodes, "exclude-nodes", "", "comma-separated node names or glob patterns to skip, e.g. nodes in maintenance")
+	var skipTaints string
+	flag.StringVar(&skipTaints, "skip-taints", defaultSkipTaints, "comma-separated taints, as key or key=value, of nodes under maintenance: they are not probed and are listed in the report instead; empty probes every node (ignored with --inventory-in)")
+	var excludeControlPlane bool
+	flag.BoolVar(&excludeControlPlane, "exclude-control-plane", false, "skip nodes with the control-plane or master role label")
+	var installArpingFlag, confirmInstall bool
+	flag.BoolVar(&installArpingFlag, "install-arping", false, "with check-env, install arping on nodes that lack it via apt, yum or zypper")
+	flag.BoolVar(&confirmInstall, "confirm-install", false, "confirm that --install-arping may install packages on nodes")
+
+	var netboxURL, netboxCluster string
+	var netboxPush bool
+	flag.StringVar(&netboxURL, "netbox-url", "", "NetBox server to confirm every LB IP is registered in IPAM; the token comes from NETBOX_TOKEN")
+	flag.StringVar(&netboxCluster, "netbox-cluster", "", "cluster name every LB IP must carry in its NetBox k8s_cluster custom field")
+	flag.BoolVar(&netboxPush, "netbox-push", false, "write the hosting node of each LB IP to its NetBox k8s_node custom field")
+	var ouiFile string
+	flag.StringVar(&ouiFile, "oui-file", "", "IEEE oui.txt registry used to name the vendor of responder MACs (default: a short built-in list)")
+	var checkDNS bool
+	flag.BoolVar(&checkDNS, "check-dns", false, "verify that the DNS names external-dns manages for each service resolve to its LB IP, reporting stale or missing records")
+	var poolWarnPercent float64
+	flag.Float64Var(&poolWarnPercent, "pool-warn-percent", 80, "with pools, highlight pools utilized at or above this percentage")
+	var sweepCIDR string
+	flag.StringVar(&sweepCIDR, "cidr", "", "with sweep, the LB pool to probe address by address, as a CIDR or range")
+	var policyPath string
+	flag.StringVar(&policyPath, "policy", "", "with check, YAML policy mapping IPs or services to the nodes allowed to host them")
+	var expectedFile string
+	flag.StringVar(&expectedFile, "expected-file", "", "with check, YAML desired placement of services (e.g. from Git) to report drift from; with --output json or csv only the drift is written")
+	var expected expectations
+	flag.Var(&expected, "expect", "fail the run unless the IP is hosted by exactly the node, given as ip=node with the node as a name or glob; may be repeated")
+	var expectFile string
+	flag.StringVar(&expectFile, "expect-file", "", "read --expect entries from this file, one ip=node per line")
+
+	var chaosService, chaosAction string
+	var chaosInterval, chaosTimeout time.Duration
+	var confirmChaos bool
+	flag.StringVar(&chaosService, "service", "", "with chaos-verify, the service, as namespace/name, whose LB IP to fail over")
+	flag.StringVar(&chaosAction, "chaos-action", chaosDeletePod, "with chaos-verify, how to disrupt the node announcing the IP: delete-pod deletes its MetalLB speaker or kube-vip pod, cordon cordons the node until the drill ends")
+	flag.DurationVar(&chaosInterval, "chaos-interval", time.Second, "with chaos-verify, how often to probe the IP after the disruption")
+	flag.DurationVar(&chaosTimeout, "chaos-timeout", 2*time.Minute, "with chaos-verify, how long to wait for another node to answer for the IP")
+	flag.BoolVar(&confirmChaos, "confirm-chaos", false, "confirm that chaos-verify and bench may disrupt the announcing node without asking")
+	var benchDrills int
+	var benchSettle, benchWatchFor time.Duration
+	flag.IntVar(&benchDrills, "bench-drills", 5, "with bench, how many failover drills to run on one IP of every pool")
+	flag.DurationVar(&benchSettle, "bench-settle", 30*time.Second, "with bench, how long to wait between drills for the disrupted announcer to come back")
+	flag.DurationVar(&benchWatchFor, "bench-watch", 0, "with bench, disrupt nothing and only observe the failovers that happen within this time, probing every --chaos-interval")
+
+	var emitInventory, inventoryList bool
+	var inventoryHost string
+	flag.BoolVar(&emitInventory, "emit-dynamic-inventory", false, "act as an Ansible inventory script: print the cluster nodes, after --include-nodes, --exclude-nodes and --exclude-control-plane, as JSON for --list or --host and exit")
+	flag.BoolVar(&inventoryList, "list", false, "with --emit-dynamic-inventory, print every group and host")
+	flag.StringVar(&inventoryHost, "host", "", "with --emit-dynamic-inventory, print the variables of this node")
+
+	// schema prints the JSON Schema of the JSON report and nothing else
+	if len(os.Args) > 1 && os.Args[1] == "schema" {
+		printSchema()
+		return
+	}
+
+	// check-env runs the preflight checks instead of probing, check probes
+	// and then enforces a placement policy, sweep probes a whole pool and
+	// pools reports MetalLB pool utilization without probing. chaos-verify
+	// disrupts the node announcing a service's IP and times the failover,
+	// and bench collects failover time statistics per pool.
+	checkEnv := len(os.Args) > 1 && os.Args[1] == "check-env"
+	checkPolicy := len(os.Args) > 1 && os.Args[1] == "check"
+	sweepMode := len(os.Args) > 1 && os.Args[1] == "sweep"
+	poolsMode := len(os.Args) > 1 && os.Args[1] == "pools"
+	chaosMode := len(os.Args) > 1 && os.Args[1] == "chaos-verify"
+	benchMode := len(os.Args) > 1 && os.Args[1] == "bench"
+	if checkEnv || checkPolicy || sweepMode || poolsMode || chaosMode || benchMode {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
 	flag.Parse()
+	daemonMode := serveAddr != "" || schedule != ""
 
-	// Load kubeconfig file
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	// An inventory script must print nothing but the inventory
+	if emitInventory {
+		quiet = true
+	}
+	if quiet {
+		disableColors()
+	}
+	if logFile != "" {
+		closer, err := setupLogFile(logFile, logMaxSize, logMaxBackups)
+		if err != nil {
+			fmt.Printf("%sError opening log file: %v%s\n", ColorRed, err, ColorReset)
+			exitRun(exitConfig)
+		}
+		onExit(func(int) { closer.Close() })
+		logf("run started by %s: %s", currentUser.Username, strings.Join(os.Args, " "))
+	}
+	if logSyslog != "" {
+		if err := setupSyslog(logSyslog); err != nil {
+			fmt.Printf("%sError connecting to syslog: %v%s\n", ColorRed, err, ColorReset)
+			exitRun(exitConfig)
+		}
+		onExit(func(int) { syslogWriter.Close() })
+	}
+	if debugArtifacts != "" {
+		runDir, err := setupDebugArtifacts(debugArtifacts)
+		if err != nil {
+			fmt.Printf("%sError creating debug artifacts directory: %v%s\n", ColorRed, err, ColorReset)
+			exitRun(exitConfig)
+		}
+		logf("saving debug artifacts to %s", runDir)
+	}
+	if otelEndpoint != "" {
+		shutdown, err := setupTracing(otelEndpoint, otelInsecure)
+		if err != nil {
+			fmt.Printf("%sError setting up tracing: %v%s\n", ColorRed, err, ColorReset)
+			exitRun(exitConfig)
+		}
+		onExit(func(int) { shutdown(context.Background()) })
+	}
+	ctx, runSpan := startSpan(context.Background(), "run", attribute.String("backend", backend), attribute.String("probe.method", probeMethod))
+	onExit(func(code int) {
+		runSpan.SetAttributes(attribute.Int("exit.code", code))
+		runSpan.End()
+	})
+	if backend != "ansible" && backend != "gateway" && backend != "servicelb" && backend != "ssm" && backend != "teleport" && backend != "talos" && backend != "nsenter" && backend != "bgp" {
+		fmt.Printf("%sInvalid backend %q. Please choose 'ansible', 'gateway', 'servicelb', 'ssm', 'teleport', 'talos', 'nsenter' or 'bgp'.%s\n", ColorRed, backend, ColorReset)
+		exitRun(exitConfig)
+	}
+	// The ssm, teleport, talos, nsenter and bgp backends reach nodes without Ansible
+	usesAnsible := backend != "ssm" && backend != "teleport" && backend != "talos" && backend != "nsenter" && backend != "bgp"
+	if !usesAnsible && (probeMethod != "arping" || proberSpec != "arping" || mockDir != "" || tuiMode) {
+		fmt.Printf("%sThe %s backend supports only the arping probe method and prober, without --mock or --tui.%s\n", ColorRed, backend, ColorReset)
+		exitRun(exitConfig)
+	}
+	if probeMethod != "arping" && probeMethod != "neigh" {
+		fmt.Printf("%sInvalid probe method %q. Please choose 'arping' or 'neigh'.%s\n", ColorRed, probeMethod, ColorReset)
+		exitRun(exitConfig)
+	}
+	if probeMethod == "neigh" && backend == "gateway" {
+		arpCommandSet := false
+		flag.Visit(func(f *flag.Flag) {
+			arpCommandSet = arpCommandSet || f.Name == "gateway-arp-command"
+		})
+		if arpCommandSet {
+			fmt.Printf("%s--gateway-arp-command cannot be used with --probe-method neigh, which reads the gateway with 'ip -json neigh show'.%s\n", ColorRed, ColorReset)
+			exitRun(exitConfig)
+		}
+	}
+	if streamFormat != "" && streamFormat != "table" && streamFormat != "live" && streamFormat != "jsonl" && streamFormat != "log" {
+		fmt.Printf("%sInvalid stream format %q. Please choose 'table', 'live', 'jsonl' or 'log'.%s\n", ColorRed, streamFormat, ColorReset)
+		exitRun(exitConfig)
+	}
+	if progressStyle != "bar" && progressStyle != "plain" {
+		fmt.Printf("%sInvalid --progress %q. Please choose 'bar' or 'plain'.%s\n", ColorRed, progressStyle, ColorReset)
+		exitRun(exitConfig)
+	}
+	plainProgress = progressStyle == "plain"
+	if streamFormat == "live" && plainProgress {
+		fmt.Printf("%s--stream live redraws in place and cannot be combined with --progress plain%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if archive.dir != "" && !daemonMode {
+		fmt.Printf("%s--archive-dir keeps daemon cycles and requires --serve or --schedule%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if useCache && !daemonMode {
+		fmt.Printf("%s--use-cache keeps daemon cycles going and requires --serve or --schedule%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if cacheTTL <= 0 {
+		fmt.Printf("%s--cache-ttl must be positive%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if archive.retention < 0 {
+		fmt.Printf("%s--retention must not be negative%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if archive.compress && archive.dir == "" {
+		fmt.Printf("%s--archive-gzip requires --archive-dir%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if openReport && daemonMode {
+		fmt.Printf("%s--open cannot be used with --serve or --schedule%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if streamFormat == "live" && (quiet || daemonMode) {
+		fmt.Printf("%s--stream live redraws above the progress bar and cannot be combined with --quiet, --serve or --schedule%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if outputFile != "" {
+		outputSet := false
+		flag.Visit(func(f *flag.Flag) {
+			outputSet = outputSet || f.Name == "output"
+		})
+		if format := formatForFile(outputFile); format != "" && !outputSet {
+			outputFormat = format
+		}
+	}
+	if outputFormat != "table" && outputFormat != "wide" && outputFormat != "json" && outputFormat != "csv" && outputFormat != "html" {
+		fmt.Printf("%sInvalid output format %q. Please choose 'table', 'wide', 'json', 'csv' or 'html'.%s\n", ColorRed, outputFormat, ColorReset)
+		exitRun(exitConfig)
+	}
+	if outputFormat == "html" && (sweepMode || poolsMode || chaosMode || benchMode || expectedFile != "") {
+		fmt.Printf("%sThe html output is only available for the placement report, not for sweep, pools, chaos-verify, bench or --expected-file.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if outputFile != "" && (daemonMode || tuiMode || checkEnv) {
+		fmt.Printf("%s--output-file writes the report of a single run and cannot be used with --serve, --schedule, --tui or check-env%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	for _, pattern := range strings.Split(discovery.ExcludeNamespaces, ",") {
+		if _, err := path.Match(strings.TrimSpace(pattern), ""); err != nil {
+			fmt.Printf("%sInvalid --exclude-namespaces pattern %q: %v%s\n", ColorRed, pattern, err, ColorReset)
+			exitRun(exitConfig)
+		}
+	}
+	if fieldsFlag != "" {
+		selectedFields, err = parseFields(fieldsFlag)
+		if err != nil {
+			fmt.Printf("%sInvalid --fields: %v%s\n", ColorRed, err, ColorReset)
+			exitRun(exitConfig)
+		}
+	}
+	if tables.Border != "box" && tables.Border != "markdown" && tables.Border != "none" {
+		fmt.Printf("%sInvalid --table-border %q. Please choose 'box', 'markdown' or 'none'.%s\n", ColorRed, tables.Border, ColorReset)
+		exitRun(exitConfig)
+	}
+	if _, ok := tableAlignments[tables.Align]; !ok {
+		fmt.Printf("%sInvalid --table-align %q. Please choose 'auto', 'left', 'center' or 'right'.%s\n", ColorRed, tables.Align, ColorReset)
+		exitRun(exitConfig)
+	}
+	if tables.MaxWidth < 1 {
+		fmt.Printf("%s--table-max-width must be at least 1%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	tableOutput := outputFormat == "table" || outputFormat == "wide"
+	jsonFatal = outputFormat == "json"
+	if groupBy != "" && groupBy != "pool" {
+		fmt.Printf("%sInvalid --group-by %q. The only grouping is 'pool'.%s\n", ColorRed, groupBy, ColorReset)
+		exitRun(exitConfig)
+	}
+	if reportByNamespace && groupBy != "" {
+		fmt.Printf("%s--report-by-namespace cannot be used with --group-by.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if tenantLabel != "" && !reportByNamespace {
+		fmt.Printf("%s--tenant-label requires --report-by-namespace.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if reportByNamespace {
+		groupBy = "namespace"
+		if tenantLabel != "" {
+			groupBy = "tenant"
+		}
+	}
+	if allIPs && (ipsFlag != "" || ipFile != "" || terraformState != "") {
+		fmt.Printf("%s--all cannot be used together with --ips, --ip-file or --ips-from-terraform.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if ipsFlag != "" && ipFile != "" {
+		fmt.Printf("%s--ips and --ip-file cannot be used together.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if terraformOutputs != "" && terraformState == "" {
+		fmt.Printf("%s--terraform-outputs requires --ips-from-terraform.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	var terraformIPs []string
+	if terraformState != "" {
+		var names []string
+		for _, name := range strings.Split(terraformOutputs, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		terraformIPs, err = readTerraformIPs(terraformState, names)
+		if err != nil {
+			fatal("reading Terraform outputs", configError{err})
+		}
+	}
+	if quiet && !emitInventory && ((ansibleUserFlag == "" && usesAnsible) || (!allIPs && ipsFlag == "" && ipFile == "" && terraformState == "" && !chaosMode) || ((chaosMode || (benchMode && benchWatchFor == 0)) && !confirmChaos)) {
+		fmt.Printf("%s--quiet requires --ansible-user and either --all, --ips, --ip-file or --ips-from-terraform, or chaos-verify and bench drills with --confirm-chaos.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if daemonMode && ((ansibleUserFlag == "" && usesAnsible) || (!allIPs && ipsFlag == "" && ipFile == "" && terraformState == "")) {
+		fmt.Printf("%s--serve and --schedule require --ansible-user and either --all, --ips, --ip-file or --ips-from-terraform.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if ipsFlag == "-" && ansibleUserFlag == "" && usesAnsible && mockDir == "" {
+		fmt.Printf("%s--ips - reads stdin, so --ansible-user must be given instead of prompted for.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if mockDir != "" && (backend != "ansible" && backend != "servicelb" || probeMethod != "arping") {
+		fmt.Printf("%s--mock supports only the ansible and servicelb backends with the arping probe method.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if ansibleExtraArgsFlag != "" {
+		args, err := splitArgs(ansibleExtraArgsFlag)
+		if err != nil {
+			fmt.Printf("%sInvalid --ansible-extra-args: %v%s\n", ColorRed, err, ColorReset)
+			exitRun(exitConfig)
+		}
+		ansibleExtraArgs = args
+	}
+	if err := setupSSHOptions(sshStrictHostKeyChecking, sshKnownHosts); err != nil {
+		fmt.Printf("%sInvalid SSH options: %v%s\n", ColorRed, err, ColorReset)
+		exitRun(exitConfig)
+	}
+	if vaultPath != "" {
+		if vaultAddr == "" {
+			fmt.Printf("%s--vault-path requires --vault-addr or VAULT_ADDR to be set.%s\n", ColorRed, ColorReset)
+			exitRun(exitConfig)
+		}
+		cleanup, err := setupVaultSSHCredentials(vaultAddr, vaultPath)
+		if err != nil {
+			fatal("fetching SSH credentials from Vault", apiError{err})
+		}
+		onExit(func(int) { cleanup() })
+	}
+	if inventoryOut != "" && inventoryIn != "" {
+		fmt.Printf("%s--inventory-out and --inventory-in cannot be used together.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if nodeAddressType != "InternalIP" && nodeAddressType != "ExternalIP" && nodeAddressType != "none" {
+		fmt.Printf("%sInvalid node address type %q. Please choose 'InternalIP', 'ExternalIP' or 'none'.%s\n", ColorRed, nodeAddressType, ColorReset)
+		exitRun(exitConfig)
+	}
+	if backend == "nsenter" && nsenterBinary == "" {
+		fmt.Printf("%sThe nsenter backend requires --nsenter-prober to be set.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if consensus < 1 {
+		fmt.Printf("%s--consensus must be at least 1.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if consensus > 1 && (backend == "gateway" || backend == "talos" || backend == "bgp" || probeMethod != "arping") {
+		fmt.Printf("%s--consensus repeats per-node probes and cannot be used with the gateway, talos or bgp backends or the neigh probe method.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if consensusSpread < 0 || (consensusSpread > 0 && consensus == 1) {
+		fmt.Printf("%s--consensus-spread must be positive and requires --consensus above 1.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if nodeTimeout > 0 && consensusSpread >= nodeTimeout {
+		fmt.Printf("%s--consensus-spread must be shorter than --node-timeout, which bounds all of an IP's probes together.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if precheck != "" && precheck != "tcp" && precheck != "ping" {
+		fmt.Printf("%sInvalid --precheck %q. Please choose 'tcp' or 'ping'.%s\n", ColorRed, precheck, ColorReset)
+		exitRun(exitConfig)
+	}
+	if precheck != "" && (!usesAnsible || fallbackDebugPod || mockDir != "" || tuiMode) {
+		fmt.Printf("%s--precheck checks nodes reached through Ansible and cannot be used with this backend, --fallback-debug-pod, --mock or --tui.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if fallbackDebugPod && (nsenterBinary == "" || (backend != "ansible" && backend != "ssm" && backend != "teleport") || probeMethod != "arping" || mockDir != "" || tuiMode) {
+		fmt.Printf("%s--fallback-debug-pod requires --nsenter-prober and the ansible, ssm or teleport backend with the arping probe method, without --mock or --tui.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if (backend == "talos" || backend == "bgp") && (nodeAddressType == "none" || inventoryIn != "") {
+		fmt.Printf("%sThe %s backend needs node addresses; it cannot be used with --node-address-type=none or --inventory-in.%s\n", ColorRed, backend, ColorReset)
+		exitRun(exitConfig)
+	}
+	if backend == "bgp" && bgpRouter == "" {
+		fmt.Printf("%sThe bgp backend requires --bgp-router to be set.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if excludeControlPlane && inventoryIn != "" {
+		fmt.Printf("%s--exclude-control-plane reads node roles from the cluster and cannot be used with --inventory-in.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	nodeSelection, err := newNodeFilter(includeNodes, excludeNodes)
 	if err != nil {
-		fmt.Printf("%sError loading kubeconfig: %v%s\n", ColorRed, err, ColorReset)
-		os.Exit(1)
+		fmt.Printf("%sInvalid node pattern: %v%s\n", ColorRed, err, ColorReset)
+		exitRun(exitConfig)
+	}
+	if enableTrigger && serveAddr == "" {
+		fmt.Printf("%s--trigger serves POST /v1/trigger and requires --serve%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if enableTrigger && os.Getenv("LBIP_TRIGGER_TOKEN") == "" {
+		fmt.Printf("%s--trigger requires a token: set LBIP_TRIGGER_TOKEN%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if (alertRulesPath != "" || grafanaURL != "") && !daemonMode {
+		fmt.Printf("%s--alert-rules and --grafana-url require --serve or --schedule.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	var alerts *alertEngine
+	if alertRulesPath != "" {
+		alerts, err = loadAlertRules(alertRulesPath)
+		if err != nil {
+			fatal("loading alert rules", configError{err})
+		}
+	}
+	if leaderElect && !daemonMode {
+		fmt.Printf("%s--leader-elect requires --serve or --schedule.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	var cron *cronSchedule
+	if schedule != "" {
+		cron, err = parseCronSchedule(schedule)
+		if err != nil {
+			fatal("parsing schedule", configError{err})
+		}
+	}
+	if resume && stateFile == "" {
+		fmt.Printf("%s--resume requires --state-file to be set.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if stateFile != "" && daemonMode {
+		fmt.Printf("%s--state-file cannot be used with --serve or --schedule.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if installArpingFlag && !checkEnv {
+		fmt.Printf("%s--install-arping can only be used with check-env.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if checkPolicy != (policyPath != "" || expectedFile != "") {
+		fmt.Printf("%scheck requires --policy or --expected-file, and those can only be used with check.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if expectedFile != "" && !allIPs {
+		fmt.Printf("%scheck --expected-file requires --all, since it looks up the IPs of the listed services.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if expectFile != "" {
+		loaded, err := loadExpectations(expectFile)
+		if err != nil {
+			fatal("loading expectations", configError{err})
+		}
+		expected = append(expected, loaded...)
+	}
+	if len(expected) > 0 && (tuiMode || daemonMode || dryRun || playbookPath != "" || checkEnv || sweepMode || poolsMode) {
+		fmt.Printf("%s--expect cannot be used with --tui, --serve, --schedule, --dry-run, --emit-playbook, check-env, sweep or pools.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if checkPolicy && (tuiMode || daemonMode || dryRun || playbookPath != "") {
+		fmt.Printf("%scheck cannot be used with --tui, --serve, --dry-run or --emit-playbook.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if sweepMode != (sweepCIDR != "") {
+		fmt.Printf("%ssweep requires --cidr, and --cidr can only be used with sweep.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if sweepMode && (tuiMode || daemonMode || dryRun || playbookPath != "" || probeMethod != "arping" || backend == "gateway" || backend == "servicelb" || backend == "talos" || backend == "bgp") {
+		fmt.Printf("%ssweep needs a per-node arping backend and cannot be used with --tui, --serve, --dry-run or --emit-playbook.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if chaosMode != (chaosService != "") {
+		fmt.Printf("%schaos-verify requires --service, and --service can only be used with chaos-verify.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if chaosMode && (tuiMode || daemonMode || dryRun || playbookPath != "" || allIPs || ipsFlag != "" || ipFile != "" || len(expected) > 0 || terraformState != "") {
+		fmt.Printf("%schaos-verify probes the IP of --service only and cannot be used with --tui, --serve, --dry-run, --emit-playbook or other IP sources.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if benchMode && (tuiMode || daemonMode || dryRun || playbookPath != "") {
+		fmt.Printf("%sbench cannot be used with --tui, --serve, --dry-run or --emit-playbook.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if benchDrills < 1 || benchSettle < 0 || benchWatchFor < 0 {
+		fmt.Printf("%s--bench-drills must be at least 1, and --bench-settle and --bench-watch must not be negative%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if chaosAction != chaosDeletePod && chaosAction != chaosCordon {
+		fmt.Printf("%sInvalid --chaos-action %q (expected delete-pod or cordon)%s\n", ColorRed, chaosAction, ColorReset)
+		exitRun(exitConfig)
+	}
+	if chaosInterval <= 0 || chaosTimeout <= 0 {
+		fmt.Printf("%s--chaos-interval and --chaos-timeout must be positive%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if emitInventory != (inventoryList || inventoryHost != "") || (inventoryList && inventoryHost != "") {
+		fmt.Printf("%s--emit-dynamic-inventory requires exactly one of --list or --host, and they can only be used with it.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if emitInventory && (tuiMode || daemonMode || inventoryIn != "" || checkEnv || checkPolicy || sweepMode || poolsMode || chaosMode || benchMode) {
+		fmt.Printf("%s--emit-dynamic-inventory reads the nodes from the cluster and cannot be used with --tui, --serve, --inventory-in or a subcommand.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if poolsMode && (tuiMode || daemonMode) {
+		fmt.Printf("%spools cannot be used with --tui or --serve.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	var sweepPool []string
+	if sweepMode {
+		sweepPool, err = expandIPEntry(sweepCIDR)
+		if err != nil {
+			fatal("parsing sweep pool", configError{err})
+		}
+	}
+	var policy *placementPolicy
+	if policyPath != "" {
+		policy, err = loadPlacementPolicy(policyPath)
+		if err != nil {
+			fatal("loading policy", configError{err})
+		}
+	}
+	var desired *expectedState
+	if expectedFile != "" {
+		desired, err = loadExpectedState(expectedFile)
+		if err != nil {
+			fatal("loading expected state", configError{err})
+		}
+	}
+	if ouiFile != "" {
+		if err := loadOUIFile(ouiFile); err != nil {
+			fatal("loading OUI file", configError{err})
+		}
+	}
+	if (netboxCluster != "" || netboxPush) && netboxURL == "" {
+		fmt.Printf("%s--netbox-cluster and --netbox-push require --netbox-url to be set.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	var netbox *netboxClient
+	if netboxURL != "" {
+		netbox, err = newNetboxClient(netboxURL)
+		if err != nil {
+			fatal("setting up NetBox", configError{err})
+		}
+	}
+	if discovery.IncludeKeepalived && (!usesAnsible || tuiMode || mockDir != "") {
+		fmt.Printf("%s--include-keepalived reads the nodes through Ansible and cannot be used with this backend, --tui or --mock.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if checkEnv && (!usesAnsible || tuiMode || mockDir != "") {
+		fmt.Printf("%scheck-env verifies the Ansible backends and cannot be used with --tui or --mock.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if inventoryIn != "" && tuiMode {
+		fmt.Printf("%s--inventory-in cannot be used with --tui.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	if inventoryOut != "" {
+		inventoryFile, keepInventory = inventoryOut, true
+	} else if inventoryIn != "" {
+		inventoryFile, keepInventory = inventoryIn, true
+	}
+	if backend == "gateway" && gatewayHost == "" {
+		fmt.Printf("%sThe gateway backend requires --gateway to be set.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+	startRun(kubeconfig, mockDir != "")
+	var audit *auditLog
+	if auditLogPath != "" {
+		command := "run"
+		switch {
+		case checkEnv:
+			command = "check-env"
+		case checkPolicy:
+			command = "check"
+		case sweepMode:
+			command = "sweep"
+		case poolsMode:
+			command = "pools"
+		case chaosMode:
+			command = "chaos-verify"
+		case benchMode:
+			command = "bench"
+		case tuiMode:
+			command = "tui"
+		case daemonMode:
+			command = "daemon"
+		}
+		cluster := "mock"
+		if mockDir == "" {
+			cluster = currentContextName(kubeconfig)
+		}
+		audit, err = openAuditLog(auditLogPath, currentUser.Username, cluster, command)
+		if err != nil {
+			fatal("opening audit log", configError{err})
+		}
 	}
 
-	// Create Kubernetes clientset
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		fmt.Printf("%sError creating Kubernetes client: %v%s\n", ColorRed, err, ColorReset)
-		os.Exit(1)
+	// The TUI drives its own prompts, discovery and probing
+	if tuiMode {
+		if err := runTUI(kubeconfig, tuiOptions{NodeAddressType: nodeAddressType, ProberSpec: proberSpec, NodeTimeout: nodeTimeout}); err != nil {
+			logf("error running TUI: %v", err)
+			fmt.Printf("%sError running TUI: %v%s\n", ColorRed, err, ColorReset)
+			audit.finish(auditSummary{Errors: 1})
+			exitRun(1)
+		}
+		audit.finish(auditSummary{})
+		return
+	}
+
+	// In mock mode the clients are backed by fixtures instead of a real cluster
+	var clientset kubernetes.Interface
+	var dynamicClient dynamic.Interface
+	var mock *mockFixtures
+	if mockDir != "" {
+		mock, clientset, dynamicClient, err = loadMockCluster(mockDir)
+		if err != nil {
+			fatal("loading mock fixtures", configError{err})
+		}
+	} else {
+		// Load kubeconfig file
+		config, err := contextRESTConfig(kubeconfig, "")
+		if err != nil {
+			fatal("loading kubeconfig", configError{err})
+		}
+
+		// Create Kubernetes clientset
+		clientset, err = kubernetes.NewForConfig(config)
+		if err != nil {
+			fatal("creating Kubernetes client", configError{err})
+		}
+
+		// Create dynamic client for CRD-based resources such as Gateways
+		dynamicClient, err = dynamic.NewForConfig(config)
+		if err != nil {
+			fatal("creating Kubernetes dynamic client", configError{err})
+		}
+	}
+
+	if emitInventory {
+		nodes, addresses, roles, err := getAllNodes(clientset, nodeAddressType)
+		if err != nil {
+			fatal("fetching nodes", apiError{err})
+		}
+		nodes = nodeSelection.apply(nodes)
+		if excludeControlPlane {
+			nodes = workerNodes(nodes, roles)
+		}
+		if err := writeDynamicInventory(os.Stdout, inventoryHost, nodes, addresses, roles, ansibleUserFlag); err != nil {
+			fatal("writing inventory", err)
+		}
+		return
+	}
+
+	if poolsMode {
+		usage, err := getPoolUsage(clientset, dynamicClient)
+		if err != nil {
+			fatal("reading pools", apiError{err})
+		}
+		if err := writePoolUsage(outputFormat, usage, poolWarnPercent); err != nil {
+			logf("error writing pool report: %v", err)
+			fmt.Printf("%sError writing pool report: %v%s\n", ColorRed, err, ColorReset)
+		}
+		audit.finish(auditSummary{Errors: len(collectedErrors())})
+		return
 	}
 
 	// Print welcome message
-	printWelcomeMessage(currentUser)
+	if !quiet {
+		printWelcomeMessage(currentUser)
+	}
 
 	// Prompt user for Ansible username
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Print(ColorBlue, "\nEnter the Ansible username to run ARP command (Ex: johndoe or johndoe-adm): ", ColorReset)
-	ansibleUsername, _ := reader.ReadString('\n')
-	ansibleUsername = strings.TrimSpace(ansibleUsername)
+	ansibleUsername := ansibleUserFlag
+	if mock != nil && ansibleUsername == "" {
+		ansibleUsername = "mock"
+	}
+	if ansibleUsername == "" && usesAnsible {
+		fmt.Print(ColorBlue, "\nEnter the Ansible username to run ARP command (Ex: johndoe or johndoe-adm): ", ColorReset)
+		ansibleUsername, _ = reader.ReadString('\n')
+		ansibleUsername = strings.TrimSpace(ansibleUsername)
+	}
+	discovery.AnsibleUsername = ansibleUsername
 
-	// Get all nodes in the cluster
-	nodes, err := getAllNodes(clientset)
+	// Load the prober used for per-node probes
+	var prober Prober
+	if mock != nil {
+		prober = mockProber{hosted: mock.Hosted}
+	} else {
+		prober, err = loadProber(proberSpec, ansibleUsername)
+	}
 	if err != nil {
-		fmt.Printf("%sError fetching nodes: %v%s\n", ColorRed, err, ColorReset)
-		os.Exit(1)
+		fatal("loading prober", configError{err})
+	}
+
+	// Get all nodes in the cluster
+	_, span := startSpan(ctx, "list nodes")
+	var nodes []string
+	var nodeAddresses, nodeRoles map[string]string
+	if inventoryIn != "" {
+		nodes, err = readInventoryNodes(inventoryIn)
+	} else {
+		nodes, nodeAddresses, nodeRoles, err = getAllNodes(clientset, nodeAddressType)
+	}
+	endSpan(span, err)
+	if err != nil && inventoryIn != "" {
+		fatal("fetching nodes", configError{err})
+	} else if err != nil {
+		fatal("fetching nodes", apiError{err})
+	}
+	nodes = nodeSelection.apply(nodes)
+	if excludeControlPlane {
+		nodes = workerNodes(nodes, nodeRoles)
+	}
+	var maintenanceTaints []string
+	for _, taint := range strings.Split(skipTaints, ",") {
+		if taint = strings.TrimSpace(taint); taint != "" {
+			maintenanceTaints = append(maintenanceTaints, taint)
+		}
+	}
+	var maintenance map[string]string
+	if inventoryIn == "" && len(maintenanceTaints) > 0 {
+		tainted, err := getMaintenanceNodes(clientset, nil, maintenanceTaints)
+		if err != nil {
+			recordError("listing node taints", "", apiError{err})
+		}
+		nodes, maintenance = skipMaintenance(nodes, tainted)
+	}
+	if len(nodes) == 0 {
+		fmt.Printf("%sNo nodes left after --include-nodes, --exclude-nodes, --exclude-control-plane and --skip-taints.%s\n", ColorRed, ColorReset)
+		exitRun(exitConfig)
+	}
+
+	// The ssm backend reaches nodes through their EC2 instances
+	if backend == "ssm" {
+		instances, err := getNodeInstanceIDs(clientset)
+		if err != nil {
+			fatal("mapping nodes to EC2 instances", apiError{err})
+		}
+		prober = ssmProber{region: ssmRegion, instances: instances}
+	} else if backend == "teleport" {
+		prober = teleportProber{proxy: teleportProxy, login: teleportLogin}
+	} else if backend == "nsenter" {
+		nsenter := newNsenterProber(clientset, kubeconfig, nsenterNamespace, nsenterImage, nsenterBinary)
+		onExit(func(int) { nsenter.Close() })
+		prober = nsenter
 	}
 
 	// Create inventory file
-	err = createInventoryFile(nodes, ansibleUsername)
+	_, span = startSpan(ctx, "create inventory", attribute.Int("nodes", len(nodes)))
+	planOnly := dryRun || playbookPath != ""
+	if planOnly {
+		// Plans never run commands on the nodes, so keepalived isn't read
+		discovery.IncludeKeepalived = false
+	}
+	if !planOnly && inventoryIn == "" && usesAnsible {
+		err = createInventoryFile(nodes, nodeAddresses, nodeRoles, ansibleUsername)
+		// Runs that end early still remove the generated inventory
+		onExit(func(int) {
+			if err := removeInventoryFile(); err != nil {
+				logf("error removing inventory file: %v", err)
+			}
+		})
+	}
+	endSpan(span, err)
 	if err != nil {
-		fmt.Printf("%sError creating inventory file: %v%s\n", ColorRed, err, ColorReset)
-		os.Exit(1)
+		fatal("creating inventory file", backendError{err})
+	}
+
+	if checkEnv {
+		passed, missingArping := runPreflightChecks(nodes, ansibleUsername)
+		if len(missingArping) > 0 && !(installArpingFlag && confirmInstall) {
+			fmt.Printf("%sarping is missing on %s. Rerun with --install-arping --confirm-install to install it.%s\n", ColorYellow, strings.Join(missingArping, ", "), ColorReset)
+		} else if len(missingArping) > 0 {
+			fmt.Printf("\nInstalling arping on %s...\n", strings.Join(missingArping, ", "))
+			if failed := installArping(missingArping, ansibleUsername); len(failed) > 0 {
+				logf("error installing arping on %s", strings.Join(failed, ", "))
+				fmt.Printf("%sError installing arping on %s%s\n", ColorRed, strings.Join(failed, ", "), ColorReset)
+			}
+			passed, _ = runPreflightChecks(nodes, ansibleUsername)
+		}
+		if err := removeInventoryFile(); err != nil {
+			logf("error removing inventory file: %v", err)
+			fmt.Printf("%sError removing inventory file: %v%s\n", ColorRed, err, ColorReset)
+		}
+		if !passed {
+			audit.finish(auditSummary{Errors: len(collectedErrors())})
+			exitRun(1)
+		}
+		audit.finish(auditSummary{Errors: len(collectedErrors())})
+		return
 	}
 
-	// Get interface name starting with '7' using Ansible
-	arpInterface := getInterfaceNameStartingWithSeven()
+	// Get interface name starting with '7' using Ansible, unless cached
+	_, span = startSpan(ctx, "detect interface")
+	interfaces := loadInterfaceCache(interfaceCacheTTL)
+	interfaceKey := interfaceCacheKey(kubeconfig, backend, detectionNode(nodes))
+	var arpInterface string
+	if mock != nil {
+		arpInterface = mock.Interface
+	} else if planOnly {
+		arpInterface = dryRunInterface
+	} else if backend == "talos" {
+		// Talos reports addresses and neighbors on every link, so no interface is needed
+		arpInterface = "(Talos API)"
+	} else if backend == "bgp" {
+		arpInterface = "(BGP routes)"
+	} else if cached, ok := interfaces.lookup(interfaceKey); ok && !refreshInterfaces {
+		arpInterface = cached
+		span.SetAttributes(attribute.Bool("cached", true))
+	} else {
+		if remote, ok := prober.(remoteProber); ok {
+			arpInterface = remote.detectInterface(ctx, nodes)
+		} else {
+			arpInterface = getInterfaceNameStartingWithSeven()
+		}
+		if arpInterface != "" {
+			interfaces.store(interfaceKey, arpInterface)
+		}
+	}
+	span.SetAttributes(attribute.String("interface", arpInterface))
+	span.End()
 	if arpInterface == "" {
 		fmt.Println(ColorRed, "Failed to retrieve network interface starting with '7'. Please check your setup.", ColorReset)
-		os.Exit(1)
+		exitRun(exitBackend)
+	}
+
+	// Mixed fleets run different arping variants with different flags
+	if arping, ok := prober.(arpingProber); ok && !planOnly {
+		_, span = startSpan(ctx, "detect arping flavors")
+		arping.flavors = detectArpingFlavors(ansibleUsername)
+		span.End()
+		prober = arping
+	}
+
+	// Nodes the backend fails for are probed from a debug pod instead
+	var fallback *fallbackProber
+	if fallbackDebugPod && !planOnly {
+		debugPods := newNsenterProber(clientset, kubeconfig, nsenterNamespace, nsenterImage, nsenterBinary)
+		onExit(func(int) { debugPods.Close() })
+		fallback = newFallbackProber(prober, debugPods)
+		prober = fallback
+	}
+	if consensus > 1 && !planOnly {
+		prober = newConsensusProber(prober, consensus, consensusSpread)
+	}
+
+	if sweepMode {
+		allocated, _ := collectTargets(ctx, clientset, dynamicClient, discovery)
+		results, unreachable := runSweep(ctx, nodes, arpInterface, sweepPool, allocated, prober, nodeTimeout, newProbePacer(probeRate, probeRatePerNode))
+		if err := writeSweep(outputFormat, results, unreachable); err != nil {
+			logf("error writing sweep: %v", err)
+			fmt.Printf("%sError writing sweep: %v%s\n", ColorRed, err, ColorReset)
+		}
+		if err := removeInventoryFile(); err != nil {
+			logf("error removing inventory file: %v", err)
+			fmt.Printf("%sError removing inventory file: %v%s\n", ColorRed, err, ColorReset)
+		}
+		audit.finish(auditSummary{IPs: len(sweepPool), Unreachable: len(unreachable), Errors: len(collectedErrors())})
+		return
 	}
 
 	// Prompt user for LB IPs
-	fmt.Print(ColorBlue, "\nDo you want to get all LoadBalancer IPs ? (yes/no): ", ColorReset)
-	option, _ := reader.ReadString('\n')
-	option = strings.TrimSpace(option)
+	var option string
+	if allIPs {
+		option = "yes"
+	} else if ipsFlag != "" || ipFile != "" || len(expected) > 0 || len(terraformIPs) > 0 || chaosMode {
+		// Expected and Terraform IPs are probed even when no others are given
+		option = "no"
+	} else {
+		fmt.Print(ColorBlue, "\nDo you want to get all LoadBalancer IPs ? (yes/no): ", ColorReset)
+		option, _ = reader.ReadString('\n')
+		option = strings.TrimSpace(option)
+	}
 
 	// Get LB IPs based on user's choice
-	var lbIPs []string
+	targets := newIPSet()
+	var cloudLBs []cloudManagedLB
 	if option == "yes" {
-		lbIPs = getLoadBalancerIPsStartingWithSeven(clientset)
+		targets, cloudLBs = collectTargets(ctx, clientset, dynamicClient, discovery)
 	} else if option == "no" {
-		lbIPs = getSpecificLoadBalancerIPs(reader)
+		var manualIPs []string
+		if chaosMode {
+			manualIPs, err = serviceLBIPs(clientset, chaosService)
+			if err != nil {
+				fatal("reading the LB IP of "+chaosService, apiError{err})
+			}
+		} else if ipsFlag == "-" {
+			manualIPs, err = readIPList(os.Stdin)
+		} else if ipFile != "" {
+			manualIPs, err = readIPFile(ipFile)
+		} else if ipsFlag != "" {
+			manualIPs, err = parseIPList(ipsFlag)
+		} else if len(expected) == 0 && len(terraformIPs) == 0 {
+			manualIPs, err = getSpecificLoadBalancerIPs(reader)
+		}
+		if err != nil {
+			fatal("parsing LB IPs", configError{err})
+		}
+		for _, ip := range manualIPs {
+			targets.add(ip, "Manual")
+		}
 	} else {
 		fmt.Println(ColorRed, "Invalid option. Please choose 'yes' or 'no'.", ColorReset)
-		os.Exit(1)
+		exitRun(exitConfig)
+	}
+	for _, ip := range terraformIPs {
+		targets.add(ip, "Terraform")
+	}
+	for _, e := range expected {
+		if _, ok := targets.sources[e.IP]; !ok {
+			targets.add(e.IP, "Expected")
+		}
+	}
+	assignPools(dynamicClient, targets, backend != "bgp")
+	filterPools(targets, poolFilter)
+	assignSpeakers(clientset, targets)
+	targets.maintenance = maintenance
+	if reportByNamespace {
+		assignTenants(clientset, targets, tenantLabel)
+	}
+	lbIPs := targets.ips
+
+	// Resolve which node hosts each LB IP using the selected backend
+	// Checkpoint completed probes so an interrupted run can be resumed
+	var state *checkpoint
+	if stateFile != "" && !dryRun && playbookPath == "" {
+		state, err = openCheckpoint(stateFile, resume)
+		if err != nil {
+			fatal("opening state file", configError{err})
+		}
+	}
+
+	probe := probeOptions{
+		Backend:           backend,
+		ProbeMethod:       probeMethod,
+		GatewayHost:       gatewayHost,
+		GatewayUser:       gatewayUser,
+		GatewayARPCommand: gatewayARPCommand,
+		AnsibleUsername:   ansibleUsername,
+		Prober:            prober,
+		NodeTimeout:       nodeTimeout,
+		Checkpoint:        state,
+		Talosconfig:       talosconfig,
+		BGPRouter:         bgpRouter,
+		NodeAddresses:     nodeAddresses,
+		StreamFormat:      streamFormat,
+		NoProgress:        daemonMode,
+		Precheck:          precheck,
+		Pacer:             newProbePacer(probeRate, probeRatePerNode),
+	}
+
+	if dryRun {
+		inventory := inventoryContent(nodes, nodeAddresses, nodeRoles, ansibleUsername)
+		if inventoryIn != "" {
+			data, err := os.ReadFile(inventoryIn)
+			if err != nil {
+				fatal("reading inventory", configError{err})
+			}
+			inventory = string(data)
+		}
+		printDryRun(nodes, arpInterface, targets, inventory, probe)
+		return
+	}
+	if playbookPath != "" {
+		if err := writePlaybook(playbookPath, nodes, targets.ips); err != nil {
+			fatal("writing playbook", err)
+		}
+		if !quiet {
+			fmt.Printf("%sPlaybook written to %s%s\n", ColorGreen, playbookPath, ColorReset)
+		}
+		return
 	}
 
-	// Run ARP command on all nodes
-	stopSpinner := loadingAnimation()
-	defer stopSpinner() // Ensure spinner stops at the end
-	runARPCommandOnAllNodes(nodes, arpInterface, lbIPs, ansibleUsername)
+	if (chaosMode || benchMode) && len(lbIPs) == 0 {
+		fatal("choosing an IP to fail over", noDrillTargets(targets, poolFilter))
+	}
+	if chaosMode {
+		ip := lbIPs[0]
+		if len(lbIPs) > 1 {
+			logf("chaos-verify: %s has %d LB IPs, failing over %s", chaosService, len(lbIPs), ip)
+		}
+		if !confirmChaos {
+			fmt.Printf("%s\nchaos-verify will %s the node announcing %s (%s).%s", ColorYellow, chaosAction, ip, chaosService, ColorReset)
+			fmt.Print(ColorBlue, "\nType the service name to confirm: ", ColorReset)
+			answer, _ := reader.ReadString('\n')
+			if strings.TrimSpace(answer) != chaosService {
+				fmt.Printf("%sNot confirmed, nothing was disrupted.%s\n", ColorRed, ColorReset)
+				if err := removeInventoryFile(); err != nil {
+					logf("error removing inventory file: %v", err)
+					fmt.Printf("%sError removing inventory file: %v%s\n", ColorRed, err, ColorReset)
+				}
+				exitRun(exitConfig)
+			}
+		}
+		drill, err := runFailoverDrill(ctx, clientset, probe, nodes, arpInterface, chaosService, ip, chaosAction, chaosInterval, chaosTimeout)
+		if err != nil {
+			recordError("running the failover drill", chaosService, err)
+		}
+		if err := writeFailover(outputFormat, drill); err != nil {
+			logf("error writing failover report: %v", err)
+			fmt.Printf("%sError writing failover report: %v%s\n", ColorRed, err, ColorReset)
+		}
+		if err := removeInventoryFile(); err != nil {
+			logf("error removing inventory file: %v", err)
+			fmt.Printf("%sError removing inventory file: %v%s\n", ColorRed, err, ColorReset)
+		}
+		audit.finish(auditSummary{IPs: 1, Errors: len(collectedErrors())})
+		if err != nil || drill.Status != failoverOK {
+			exitRun(exitFailure)
+		}
+		return
+	}
+
+	if benchMode {
+		mode := benchDrill
+		var pools map[string]*benchPool
+		if benchWatchFor > 0 {
+			mode = benchWatch
+			pools = watchFailovers(ctx, clientset, probe, nodes, arpInterface, targets, chaosInterval, benchWatchFor)
+		} else {
+			if !confirmChaos {
+				fmt.Printf("%s\nbench will %s the node announcing one IP of every pool, %d times per pool.%s", ColorYellow, chaosAction, benchDrills, ColorReset)
+				fmt.Print(ColorBlue, "\nDo you want to continue? (yes/no): ", ColorReset)
+				answer, _ := reader.ReadString('\n')
+				if strings.TrimSpace(answer) != "yes" {
+					fmt.Printf("%sNot confirmed, nothing was disrupted.%s\n", ColorRed, ColorReset)
+					if err := removeInventoryFile(); err != nil {
+						logf("error removing inventory file: %v", err)
+						fmt.Printf("%sError removing inventory file: %v%s\n", ColorRed, err, ColorReset)
+					}
+					exitRun(exitConfig)
+				}
+			}
+			pools = runBenchDrills(ctx, clientset, probe, nodes, arpInterface, targets, chaosAction, benchDrills, chaosInterval, chaosTimeout, benchSettle)
+		}
+		if err := writeBench(outputFormat, newBenchReport(mode, pools)); err != nil {
+			logf("error writing benchmark: %v", err)
+			fmt.Printf("%sError writing benchmark: %v%s\n", ColorRed, err, ColorReset)
+		}
+		if err := removeInventoryFile(); err != nil {
+			logf("error removing inventory file: %v", err)
+			fmt.Printf("%sError removing inventory file: %v%s\n", ColorRed, err, ColorReset)
+		}
+		audit.finish(auditSummary{IPs: len(lbIPs), Errors: len(collectedErrors())})
+		return
+	}
+
+	// In daemon mode probe every interval, or on the schedule, until interrupted
+	if daemonMode {
+		// Re-collected targets and nodes come from informers rather than
+		// full Lists
+		var refresher *nodeRefresher
+		if allIPs || inventoryIn == "" {
+			clusterCache, err := startClusterCache(ctx, clientset, dynamicClient, discovery)
+			if err != nil {
+				fatal("starting informers", apiError{err})
+			}
+			if allIPs {
+				discovery.Cache = clusterCache
+			}
+			// Autoscaling adds and removes nodes between cycles
+			if inventoryIn == "" {
+				refresher = &nodeRefresher{cache: clusterCache, addressType: nodeAddressType, selection: nodeSelection, excludeControlPlane: excludeControlPlane, skipTaints: maintenanceTaints, ansibleUsername: ansibleUsername, writeInventory: usesAnsible, nodes: nodes, addresses: nodeAddresses}
+			}
+		}
+		flaps := newFlapTracker(flapWindow)
+
+		// Readiness requires the API server to answer
+		apiCheck := func() error {
+			_, err := clientset.Discovery().ServerVersion()
+			return err
+		}
+		var snapshot *inventorySnapshot
+		if useCache {
+			snapshot = &inventorySnapshot{ttl: cacheTTL}
+		}
+		var archiving *reportArchive
+		if archive.dir != "" {
+			archiving = &archive
+		}
+		// Cycles and on-demand probes share the targets, the prober state
+		// such as the consensus flap tracking and the recorded errors, so
+		// only one probes at a time
+		var probing sync.Mutex
+		cycle := func(ctx context.Context) cycleResult {
+			probing.Lock()
+			defer probing.Unlock()
+			started := time.Now()
+			resetErrors()
+			restartRun()
+			cycleTargets, cycleCloudLBs := targets, cloudLBs
+			cycleNodes, cycleProbe := nodes, probe
+			stale := false
+			if snapshot != nil {
+				if err := apiCheck(); err != nil {
+					if !snapshot.usable(started) {
+						err = fmt.Errorf("kubernetes API unavailable and no inventory within --cache-ttl to probe against: %v", err)
+						recordError("checking the Kubernetes API", "", apiError{err})
+						return cycleResult{Started: started, Finished: time.Now(), Report: newReport(nil, nil, newIPSet(), nil), Err: apiError{err}}
+					}
+					logf("kubernetes API unavailable, probing against the inventory from %s: %v", snapshot.taken.Format(time.RFC3339), err)
+					stale = true
+					markStaleInventory(snapshot.taken)
+					cycleTargets, cycleCloudLBs = snapshot.targets, snapshot.cloudLBs
+					cycleNodes, cycleProbe.NodeAddresses = snapshot.nodes, snapshot.addresses
+					cycleTargets.maintenance = snapshot.maintenance
+				}
+			}
+			if !stale {
+				if allIPs {
+					cycleTargets, cycleCloudLBs = collectTargets(ctx, clientset, dynamicClient, discovery)
+					assignPools(dynamicClient, cycleTargets, backend != "bgp")
+					filterPools(cycleTargets, poolFilter)
+				}
+				// Speaker pods are replaced on restarts, so look them up every cycle
+				assignSpeakers(clientset, cycleTargets)
+				if reportByNamespace {
+					assignTenants(clientset, cycleTargets, tenantLabel)
+				}
+				cycleTargets.maintenance = maintenance
+				if refresher != nil {
+					cycleNodes, cycleProbe.NodeAddresses = refresher.current()
+					cycleTargets.maintenance = refresher.inMaintenance()
+				}
+				if snapshot != nil {
+					snapshot.save(cycleTargets, cycleCloudLBs, cycleNodes, cycleProbe.NodeAddresses, started)
+				}
+			}
+			hostingNodes, unreachable, warnings, probeErr := probeTargets(ctx, clientset, cycleProbe, cycleNodes, arpInterface, cycleTargets)
+			if refresher != nil {
+				unreachable = refresher.dropDeleted(unreachable)
+			}
+			for _, warning := range warnings {
+				logf("warning: %s", warning)
+			}
+			if outputFormat == "wide" || fieldSelected("ptr") {
+				resolvePTRNames(cycleTargets, discovery.DNSServer)
+			}
+			cycleTargets.flaps = flaps.observe(hostingNodes, time.Now())
+			if err := writeReport(outputFormat, groupBy, hostingNodes, unreachable, cycleTargets, cycleCloudLBs); err != nil {
+				logf("error writing report: %v", err)
+			}
+			audit.cycle(auditSummary{IPs: len(cycleTargets.ips), Hosted: len(hostingNodes), Unreachable: len(unreachable), Errors: len(collectedErrors())})
+			finished := time.Now()
+			cycleReport := newReport(hostingNodes, unreachable, cycleTargets, cycleCloudLBs)
+			if err := archiving.store(cycleReport, finished); err != nil {
+				logf("error archiving report: %v", err)
+			}
+			if err := archiving.prune(finished); err != nil {
+				logf("error pruning report archive: %v", err)
+			}
+			return cycleResult{Started: started, Finished: finished, Report: cycleReport, Err: probeErr, IPs: cycleTargets.ips, Flaps: cycleTargets.flaps}
+		}
+
+		// On-demand probes for the gRPC API stream each row as it is confirmed
+		probeOnDemand := func(ctx context.Context, ips []string, onResult func(row reportRow)) error {
+			probing.Lock()
+			defer probing.Unlock()
+			requestTargets := targets
+			if len(ips) > 0 {
+				requestTargets = newIPSet()
+				for _, ip := range ips {
+					requestTargets.add(ip, "Manual")
+				}
+			} else if allIPs {
+				requestTargets, _ = collectTargets(ctx, clientset, dynamicClient, discovery)
+			}
+			requestProbe := probe
+			requestProbe.StreamFormat = ""
+			requestProbe.OnResult = func(row []string) {
+				onResult(reportRow{Node: row[0], IP: row[1], Source: requestTargets.source(row[1])})
+			}
+			requestNodes := nodes
+			if refresher != nil {
+				requestNodes, requestProbe.NodeAddresses = refresher.current()
+			}
+			_, _, _, err := probeTargets(ctx, clientset, requestProbe, requestNodes, arpInterface, requestTargets)
+			return err
+		}
+
+		d := newDaemon(interval, cycle, apiCheck)
+		d.grpcAddr, d.probe = grpcAddr, probeOnDemand
+		if enableTrigger {
+			d.triggerToken = os.Getenv("LBIP_TRIGGER_TOKEN")
+		}
+		if leaderElect {
+			d.leader = newLeaderElector(clientset, leaderElectNamespace)
+		}
+		d.alerts = alerts
+		if cron != nil {
+			// Readiness allows the gap between scheduled runs
+			first := cron.next(time.Now())
+			d.schedule, d.interval = cron, cron.next(first).Sub(first)
+		}
+		if grafanaURL != "" {
+			d.grafana, err = newGrafanaAnnotator(grafanaURL)
+			if err != nil {
+				fatal("setting up Grafana", configError{err})
+			}
+		}
+		// The daemon shuts down gracefully on signals instead
+		stopSignals()
+		daemonCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		err := d.run(daemonCtx, serveAddr, enablePprof)
+		stop()
+		if err := removeInventoryFile(); err != nil {
+			logf("error removing inventory file: %v", err)
+			fmt.Printf("%sError removing inventory file: %v%s\n", ColorRed, err, ColorReset)
+		}
+		if err != nil {
+			logf("error running daemon: %v", err)
+			fmt.Printf("%sError running daemon: %v%s\n", ColorRed, err, ColorReset)
+			audit.finish(auditSummary{Errors: 1})
+			exitRun(exitFailure)
+		}
+		audit.finish(auditSummary{})
+		return
+	}
+
+	// Another cluster announcing the same IP makes every probe result suspect
+	if conflictContexts != "" && mock == nil {
+		_, span = startSpan(ctx, "check IP conflicts")
+		current, err := collectClusterClaims(clientset, dynamicClient)
+		if err != nil {
+			recordError("checking IP conflicts", "", apiError{err})
+			current = make(clusterClaims)
+		}
+		for _, ip := range targets.ips {
+			if _, ok := current[ip]; !ok {
+				current.add(ip, "probe target")
+			}
+		}
+		conflicts := findIPConflicts(kubeconfig, currentContextName(kubeconfig), current, conflictContexts)
+		span.End()
+		for _, conflict := range conflicts {
+			recordError("IP conflict", conflict.IP, fmt.Errorf("claimed by %s", strings.Join(conflict.Claims, "; ")))
+		}
+		if tableOutput {
+			printIPConflicts(conflicts)
+		}
+	}
+
+	hostingNodes, unreachable, warnings, probeErr := probeTargets(ctx, clientset, probe, nodes, arpInterface, targets)
+	state.finish()
+	if udpProbe {
+		runUDPProbes(targets)
+	}
+	if outputFormat == "wide" || fieldSelected("ptr") {
+		resolvePTRNames(targets, discovery.DNSServer)
+	}
+	if fallback != nil {
+		if fellBack := fallback.fallbackNodes(); len(fellBack) > 0 {
+			sort.Strings(fellBack)
+			warnings = append(warnings, fmt.Sprintf("The %s backend failed for %s, so they were probed from a debug pod.", backend, strings.Join(fellBack, ", ")))
+		}
+	}
+
+	// Everything from here on is the report, written to --output-file or
+	// paged when it is a long table
+	var pager *reportPager
+	var file *reportFile
+	if outputFile != "" {
+		if tableOutput {
+			disableColors()
+		}
+		file, err = startReportFile(outputFile)
+		if err != nil {
+			fatal("opening output file", configError{err})
+		}
+	} else if tableOutput {
+		pager = startPager(noPager)
+	}
+	onExit(func(code int) {
+		pager.finish()
+		file.finish(code)
+	})
+	// Structured reports must stay parseable, so their warnings go to stderr
+	warningOut := os.Stdout
+	if !tableOutput {
+		warningOut = os.Stderr
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(warningOut, "%s%s%s\n", ColorYellow, warning, ColorReset)
+	}
+	var violations []policyViolation
+	var drifts []placementDrift
+	if policy != nil || desired != nil {
+		nodeLabels, err := getNodeLabels(clientset)
+		if err != nil {
+			recordError("fetching node labels", "", apiError{err})
+		}
+		if desired != nil {
+			drifts = checkDrift(desired, hostingNodes, targets, nodeLabels)
+		}
+		if policy != nil {
+			violations = checkPlacement(policy, hostingNodes, targets, nodeLabels)
+		}
+		for _, violation := range violations {
+			recordError("policy violation", violation.IP, fmt.Errorf("hosted on %s, which %s does not allow", violation.Node, violation.Rule))
+		}
+	}
+	unmet := checkExpectations(expected, hostingNodes)
+	for _, failure := range unmet {
+		recordError("expectation not met", failure.IP, fmt.Errorf("%s", failure.Problem))
+	}
+	unannounced := unannouncedIPs(terraformIPs, hostingNodes)
+	for _, ip := range unannounced {
+		recordError("Terraform IP not announced", ip, fmt.Errorf("allocated in %s, but no node announces it", terraformState))
+	}
+	var dnsChecks []dnsCheck
+	if checkDNS {
+		_, span = startSpan(ctx, "check external-dns records")
+		dnsChecks, err = checkExternalDNS(clientset, discovery.DNSServer)
+		endSpan(span, err)
+		if err != nil {
+			recordError("checking external-dns records", "", apiError{err})
+		}
+		for _, check := range dnsChecks {
+			if check.Status != "ok" {
+				recordError("external-dns record "+check.Status, check.Hostname, fmt.Errorf("resolves to [%s], %s has [%s]", strings.Join(check.Resolved, ", "), check.Service, strings.Join(check.Expected, ", ")))
+			}
+		}
+	}
+	var netboxChecks []netboxCheck
+	if netbox != nil {
+		_, span = startSpan(ctx, "check NetBox")
+		netboxChecks = checkNetBox(netbox, targets, hostingNodes, netboxCluster, netboxPush)
+		span.End()
+		for _, check := range netboxChecks {
+			if check.Status != "ok" {
+				recordError("NetBox "+check.Status, check.IP, fmt.Errorf("prefix %q, cluster %q", check.Prefix, check.Cluster))
+			}
+		}
+	}
+	if desired == nil || tableOutput {
+		if err := writeReport(outputFormat, groupBy, hostingNodes, unreachable, targets, cloudLBs); err != nil {
+			logf("error writing report: %v", err)
+			fmt.Printf("%sError writing report: %v%s\n", ColorRed, err, ColorReset)
+		}
+	}
+	if tableOutput {
+		printDNSChecks(dnsChecks)
+		printNetBoxChecks(netboxChecks)
+	}
+	if desired != nil {
+		if err := writeDrift(outputFormat, drifts); err != nil {
+			logf("error writing drift report: %v", err)
+			fmt.Printf("%sError writing drift report: %v%s\n", ColorRed, err, ColorReset)
+		}
+	}
+	if openReport {
+		path, err := openHTMLReport(newReport(hostingNodes, unreachable, targets, cloudLBs))
+		if err != nil {
+			logf("error opening HTML report: %v", err)
+			fmt.Fprintf(os.Stderr, "%sError opening HTML report: %v%s\n", ColorRed, err, ColorReset)
+		}
+		if path != "" {
+			fmt.Fprintf(os.Stderr, "HTML report: %s\n", path)
+		}
+	}
 
 	// Print the interface used for ARP command
-	fmt.Printf("\nInterface Used to run ARP command: %s%s%s\n\n\n", ColorGreen, arpInterface, ColorReset)
-	fmt.Printf("%s****%s\n\n", ColorPurple, ColorReset)
+	if !quiet && tableOutput {
+		fmt.Printf("\nInterface Used to run ARP command: %s%s%s\n\n\n", ColorGreen, arpInterface, ColorReset)
+		fmt.Printf("%s****%s\n\n", ColorPurple, ColorReset)
+	}
 
 	// Remove the inventory file after displaying the final output
 	err = removeInventoryFile()
 	if err != nil {
+		logf("error removing inventory file: %v", err)
 		fmt.Printf("%sError removing inventory file: %v%s\n", ColorRed, err, ColorReset)
 	}
+	logf("run finished: %d result(s) for %d IP(s)", len(hostingNodes), len(lbIPs))
+	audit.finish(auditSummary{IPs: len(lbIPs), Hosted: len(hostingNodes), Unreachable: len(unreachable), Errors: len(collectedErrors())})
+
+	// A failed probe leaves the result incomplete, which outranks any finding
+	if probeErr != nil {
+		exitRun(exitCode(probeErr))
+	}
+
+	if len(unmet) > 0 || len(unannounced) > 0 {
+		if tableOutput {
+			for _, failure := range unmet {
+				fmt.Printf("%sExpectation not met: %s %s%s\n", ColorRed, failure.IP, failure.Problem, ColorReset)
+			}
+			if len(unannounced) > 0 {
+				fmt.Printf("%sAllocated in Terraform but not announced by any node: %s%s\n", ColorRed, strings.Join(unannounced, ", "), ColorReset)
+			}
+		}
+		exitRun(exitFailure)
+	}
+
+	if policy != nil {
+		if len(violations) > 0 {
+			if tableOutput {
+				fmt.Printf("%s%d policy violation(s) found.%s\n", ColorRed, len(violations), ColorReset)
+			}
+			exitRun(exitFailure)
+		}
+		if !quiet && tableOutput {
+			fmt.Printf("%sAll LB IPs are placed as the policy allows.%s\n", ColorGreen, ColorReset)
+		}
+	}
+	if desired != nil {
+		if count := driftCount(drifts); count > 0 {
+			if tableOutput {
+				fmt.Printf("%s%d service(s) drifted from %s.%s\n", ColorRed, count, expectedFile, ColorReset)
+			}
+			exitRun(exitFailure)
+		}
+		if !quiet && tableOutput {
+			fmt.Printf("%sAll services are placed as %s expects.%s\n", ColorGreen, expectedFile, ColorReset)
+		}
+	}
 }
 
 func printWelcomeMessage(currentUser *user.User) {
@@ -132,162 +1627,532 @@ func printWelcomeMessage(currentUser *user.User) {
 	fmt.Printf("%sThis tool helps you find the node name associated with LoadBalancer IPs in your Kubernetes cluster.%s\n", ColorCyan, ColorReset) // Italics
 }
 
-func getLoadBalancerIPsStartingWithSeven(clientset *kubernetes.Clientset) []string {
-	var lbIPs []string
+// discoveryOptions controls which service addresses are collected from the cluster
+type discoveryOptions struct {
+	IncludeExternalIPs bool
+	IncludeIngress     bool
+	IncludeGateways    bool
+	IncludeKeepalived  bool
+	DNSServer          string
+	LBClass            string
+	// ExcludeNamespaces is a comma-separated list of namespaces, or globs,
+	// whose services, ingresses and gateways are left out
+	ExcludeNamespaces string
+	// AnnotatedOnly keeps only the services enrolled with probeAnnotation
+	AnnotatedOnly bool
+
+	// AnsibleUsername runs the keepalived lookup on the nodes
+	AnsibleUsername string
+
+	// Cache, if set, serves services, ingresses and gateways from informers
+	Cache *clusterCache
+}
+
+func getLoadBalancerIPsStartingWithSeven(clientset kubernetes.Interface, opts discoveryOptions) (*ipSet, []cloudManagedLB) {
+	lbIPs := newIPSet()
+	var cloudLBs []cloudManagedLB
 
 	// Get LoadBalancer services
-	services, err := clientset.CoreV1().Services("").List(context.TODO(), v1.ListOptions{})
+	services, err := listServices(clientset, opts.Cache)
 	if err != nil {
-		fmt.Printf("%sError fetching services: %v%s\n", ColorRed, err, ColorReset)
-		return lbIPs
+		recordError("fetching services", "", apiError{err})
+		return lbIPs, cloudLBs
 	}
 
 	// Collect LoadBalancer IPs
-	for _, service := range services.Items {
+	for _, service := range services {
+		if !opts.matchesLBClass(service) || opts.excludesNamespace(service.Namespace) {
+			continue
+		}
+		if annotationTrue(service, skipAnnotation) {
+			logf("skipping service %s/%s: it has %s=true", service.Namespace, service.Name, skipAnnotation)
+			continue
+		}
+		if opts.AnnotatedOnly && !annotationTrue(service, probeAnnotation) {
+			continue
+		}
 		if service.Spec.Type == "LoadBalancer" {
-			for _, ingress := range service.Status.LoadBalancer.Ingress {
-				if strings.HasPrefix(ingress.IP, "7") {
-					lbIPs = append(lbIPs, ingress.IP)
+			// Cloud load balancers aren't announced by nodes, so set them
+			// aside. External IPs on their spec are still collected below.
+			if provider := getCloudProvider(service); provider != "" {
+				for _, ingress := range service.Status.LoadBalancer.Ingress {
+					address := ingress.IP
+					if address == "" {
+						address = ingress.Hostname
+					}
+					cloudLBs = append(cloudLBs, cloudManagedLB{Namespace: service.Namespace, Service: service.Name, Provider: provider, Address: address})
+				}
+			} else {
+				for _, ingress := range service.Status.LoadBalancer.Ingress {
+					if strings.HasPrefix(ingress.IP, "7") {
+						lbIPs.add(ingress.IP, "LoadBalancer")
+						lbIPs.addService(ingress.IP, serviceLabel(service))
+						addServicePorts(lbIPs, ingress.IP, service)
+						if pool := annotatedPool(service); pool != "" {
+							lbIPs.pools[ingress.IP] = pool
+						}
+					}
+					if ingress.IP == "" && ingress.Hostname != "" {
+						addResolvedHostname(lbIPs, opts.DNSServer, ingress.Hostname, "LoadBalancer")
+					}
+				}
+			}
+		}
+
+		// Collect external IPs set directly on the service spec
+		if opts.IncludeExternalIPs {
+			for _, ip := range service.Spec.ExternalIPs {
+				if strings.HasPrefix(ip, "7") {
+					lbIPs.add(ip, "ExternalIP")
+					lbIPs.addService(ip, serviceLabel(service))
+					addServicePorts(lbIPs, ip, service)
 				}
 			}
 		}
 	}
 
-	return lbIPs
+	return lbIPs, cloudLBs
 }
 
-func getSpecificLoadBalancerIPs(reader *bufio.Reader) []string {
-	fmt.Print("\nEnter LB IP(s) separated by comma: ")
-	lbIPsStr, _ := reader.ReadString('\n')
-	lbIPsStr = strings.TrimSpace(lbIPsStr)
-	lbIPs := strings.Split(lbIPsStr, ",")
-	return lbIPs
+// excludesNamespace reports whether namespace is in --exclude-namespaces
+func (opts discoveryOptions) excludesNamespace(namespace string) bool {
+	if opts.ExcludeNamespaces == "" {
+		return false
+	}
+	for _, pattern := range strings.Split(opts.ExcludeNamespaces, ",") {
+		if matched, _ := path.Match(strings.TrimSpace(pattern), namespace); matched {
+			return true
+		}
+	}
+	return false
 }
 
-func getAllNodes(clientset *kubernetes.Clientset) ([]string, error) {
-	var nodes []string
+// matchesLBClass reports whether service has one of the --lb-class classes.
+// Every service matches when no class is given.
+func (opts discoveryOptions) matchesLBClass(service corev1.Service) bool {
+	if opts.LBClass == "" {
+		return true
+	}
+	if service.Spec.LoadBalancerClass == nil {
+		return false
+	}
+	for _, class := range strings.Split(opts.LBClass, ",") {
+		if strings.TrimSpace(class) == *service.Spec.LoadBalancerClass {
+			return true
+		}
+	}
+	return false
+}
+
+// addServicePorts records the ports service exposes on ip
+func addServicePorts(lbIPs *ipSet, ip string, service corev1.Service) {
+	for _, port := range service.Spec.Ports {
+		protocol := string(port.Protocol)
+		if protocol == "" {
+			protocol = "TCP"
+		}
+		lbIPs.addPort(ip, servicePort{Port: port.Port, Protocol: protocol})
+	}
+}
 
+// serviceLabel names a service with its ports, like default/web:80/TCP,443/TCP
+func serviceLabel(service corev1.Service) string {
+	var ports []string
+	for _, port := range service.Spec.Ports {
+		ports = append(ports, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+	}
+	label := service.Namespace + "/" + service.Name
+	if len(ports) > 0 {
+		label += ":" + strings.Join(ports, ",")
+	}
+	return label
+}
+
+func getSpecificLoadBalancerIPs(reader *bufio.Reader) ([]string, error) {
+	fmt.Print("\nEnter LB IP(s), CIDRs or ranges separated by comma (Ex: 7.10.20.4,7.10.20.0/28,7.10.20.5-7.10.20.9): ")
+	lbIPsStr, _ := reader.ReadString('\n')
+	return parseIPList(lbIPsStr)
+}
+
+// getAllNodes returns the names of all nodes and, keyed by name, the address
+// of addressType (InternalIP or ExternalIP) of every node that has one and
+// the inventory group of every node's role, control_plane or workers.
+func getAllNodes(clientset kubernetes.Interface, addressType string) ([]string, map[string]string, map[string]string, error) {
 	// Get all nodes in the cluster
 	nodeList, err := clientset.CoreV1().Nodes().List(context.TODO(), v1.ListOptions{})
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
+	nodes, addresses, roles := describeNodes(nodeList.Items, addressType)
+	return nodes, addresses, roles, nil
+}
 
-	// Collect node names
-	for _, node := range nodeList.Items {
+// describeNodes returns the names, addresses and roles of nodes as
+// getAllNodes does
+func describeNodes(nodeList []corev1.Node, addressType string) ([]string, map[string]string, map[string]string) {
+	var nodes []string
+	addresses := make(map[string]string)
+	roles := make(map[string]string)
+
+	// Collect node names, addresses and roles
+	for _, node := range nodeList {
 		nodes = append(nodes, node.Name)
+		for _, address := range node.Status.Addresses {
+			if string(address.Type) == addressType {
+				addresses[node.Name] = address.Address
+				break
+			}
+		}
+		roles[node.Name] = roleWorkers
+		for _, label := range controlPlaneLabels {
+			if _, ok := node.Labels[label]; ok {
+				roles[node.Name] = roleControlPlane
+			}
+		}
 	}
 
-	return nodes, nil
+	return nodes, addresses, roles
+}
+
+// Inventory groups generated from node roles. Ansible warns about dashes in
+// group names, so the control plane group uses an underscore.
+const (
+	roleControlPlane = "control_plane"
+	roleWorkers      = "workers"
+)
+
+// controlPlaneLabels mark control plane nodes, under the current and the
+// pre-1.24 role name
+var controlPlaneLabels = []string{"node-role.kubernetes.io/control-plane", "node-role.kubernetes.io/master"}
+
+// workerNodes returns the nodes that are not in the control plane
+func workerNodes(nodes []string, roles map[string]string) []string {
+	var workers []string
+	for _, node := range nodes {
+		if roles[node] != roleControlPlane {
+			workers = append(workers, node)
+		}
+	}
+	return workers
 }
 
-func createInventoryFile(nodes []string, ansibleUsername string) error {
-	// Create or overwrite k8s.inventory file
-	file, err := os.Create("k8s.inventory")
+func createInventoryFile(nodes []string, addresses, roles map[string]string, ansibleUsername string) error {
+	// Create or overwrite the inventory file
+	file, err := os.Create(inventoryFile)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	// Write inventory header
-	_, err = file.WriteString("[k8s]\n")
-	if err != nil {
-		return err
+	_, err = file.WriteString(inventoryContent(nodes, addresses, roles, ansibleUsername))
+	return err
+}
+
+// inventoryContent renders the k8s inventory group with one line per node.
+// Nodes with a known address get ansible_host so their names need not resolve
+// from the operator machine. With known roles the nodes are also listed in
+// control_plane and workers groups, for playbooks run against the inventory.
+func inventoryContent(nodes []string, addresses, roles map[string]string, ansibleUsername string) string {
+	var b strings.Builder
+	b.WriteString("[k8s]\n")
+	for _, node := range nodes {
+		fmt.Fprintf(&b, "%s ansible_user=%s", node, ansibleUsername)
+		if address, ok := addresses[node]; ok {
+			fmt.Fprintf(&b, " ansible_host=%s", address)
+		}
+		b.WriteString("\n")
 	}
+	for _, group := range []string{roleControlPlane, roleWorkers} {
+		var members []string
+		for _, node := range nodes {
+			if roles[node] == group {
+				members = append(members, node)
+			}
+		}
+		if len(members) > 0 {
+			fmt.Fprintf(&b, "\n[%s]\n%s\n", group, strings.Join(members, "\n"))
+		}
+	}
+	return b.String()
+}
+
+// runARPCommandOnAllNodes probes every LB IP from every node. It returns the
+// node/IP pairs found and the nodes that were unreachable, whose results are
+// left out.
+func runARPCommandOnAllNodes(ctx context.Context, nodes []string, arpInterface string, lbIPs []string, prober Prober, nodeTimeout time.Duration, state *checkpoint, pacer *probePacer, progress *progressBar, stream *resultStreamer) ([][]string, []string) {
+	var hostingNodes [][]string
+	var unreachable []string
 
-	// Write nodes to inventory file
 	for _, node := range nodes {
-		_, err := file.WriteString(fmt.Sprintf("%s ansible_user=%s\n", node, ansibleUsername))
-		if err != nil {
-			return err
+		progress.startNode(node)
+		nodeCtx, span := startSpan(ctx, "probe node", attribute.String("node", node))
+		rows, ok := runARPCommandOnNode(nodeCtx, node, arpInterface, lbIPs, prober, nodeTimeout, state, pacer, stream)
+		hostingNodes = append(hostingNodes, rows...)
+		if !ok {
+			unreachable = append(unreachable, node)
 		}
+		span.SetAttributes(attribute.Bool("reachable", ok))
+		span.End()
+		progress.nodeDone()
 	}
 
-	return nil
+	return hostingNodes, unreachable
 }
 
-func loadingAnimation() func() {
-	stop := make(chan struct{})
-	done := make(chan struct{})
-	go func() {
-		fmt.Println("\n*******************************************")
-		fmt.Println("*** Please wait... I am working on it ***")
-		fmt.Println("*******************************************")
-		for {
-			select {
-			case <-stop:
-				done <- struct{}{}
-				return
-			default:
-				for _, char := range chars {
-					fmt.Printf("\r%sWorking %s%s", ColorPurple, char, ColorReset)
-					time.Sleep(100 * time.Millisecond)
-				}
+// runARPCommandOnNode probes every LB IP from a single node and returns the
+// node/IP pairs the node hosts, streaming each one as it is confirmed. Each
+// probe may take up to nodeTimeout if set. When the node turns out to be
+// unreachable the remaining IPs are skipped and false is returned. Probes
+// completed in an earlier run are taken from state instead of repeated, and
+// the others are spaced out by pacer.
+func runARPCommandOnNode(ctx context.Context, node string, arpInterface string, lbIPs []string, prober Prober, nodeTimeout time.Duration, state *checkpoint, pacer *probePacer, stream *resultStreamer) ([][]string, bool) {
+	var hostingNodes [][]string
+
+	for _, ip := range lbIPs {
+		if hosted, ok := state.lookup(node, ip); ok {
+			if hosted {
+				hostingNodes = append(hostingNodes, []string{node, ip})
+				stream.emit([]string{node, ip})
 			}
+			continue
+		}
+		if err := pacer.wait(ctx, node); err != nil {
+			return hostingNodes, true
 		}
-	}()
 
-	return func() {
-		close(stop)
-		<-done
-		fmt.Print("\r                                            \r") // Clear spinner line
+		probeCtx, span := startSpan(ctx, "probe ip", attribute.String("node", node), attribute.String("ip", ip))
+		cancel := func() {}
+		if nodeTimeout > 0 {
+			probeCtx, cancel = context.WithTimeout(probeCtx, nodeTimeout)
+		}
+		result := prober.Probe(probeCtx, node, arpInterface, ip)
+		if probeCtx.Err() == context.DeadlineExceeded {
+			result = ProbeResult{Unreachable: true, Err: fmt.Errorf("no answer within %v", nodeTimeout)}
+		}
+		cancel()
+		span.SetAttributes(attribute.Bool("hosted", result.Hosted))
+		endSpan(span, result.Err)
+		if result.Unreachable {
+			recordError("connecting to node", node, backendError{result.Err})
+			return nil, false
+		}
+		if result.Err != nil {
+			recordError("probing "+ip, node, probeError{result.Err})
+			continue
+		}
+		state.record(node, ip, result.Hosted)
+		if result.Hosted {
+			hostingNodes = append(hostingNodes, []string{node, ip})
+			stream.emit([]string{node, ip})
+		}
 	}
+
+	return hostingNodes, true
 }
 
-func runARPCommandOnAllNodes(nodes []string, arpInterface string, lbIPs []string, ansibleUsername string) {
-	var hostingNodes [][]string
+// printResults prints the result table. The wide table adds the protocols
+// and reverse DNS name of each IP.
+func printResults(hostingNodes [][]string, targets *ipSet, wide bool) {
+	if !quiet {
+		fmt.Println("\nHere is your result:")
+	}
+	printResultTable(hostingNodes, targets, wide)
+}
 
-	for _, node := range nodes {
-		for _, ip := range lbIPs {
-			cmd := exec.Command("ansible", "-i", "k8s.inventory", node, "-u", ansibleUsername, "-m", "shell", "-a", fmt.Sprintf("arping -q -I %s %s -c 1", arpInterface, ip))
-			out, err := cmd.CombinedOutput()
-			if err != nil {
-				// If the output contains "FAILED", add the node to the list of LoadBalancer IP hosting nodes
-				if strings.Contains(string(out), "FAILED") {
-					hostingNodes = append(hostingNodes, []string{node, ip})
-				}
-				continue
+// printResultTable renders the result rows as a colored table
+func printResultTable(hostingNodes [][]string, targets *ipSet, wide bool) {
+	table := newTable(os.Stdout)
+	if len(selectedFields) > 0 {
+		printFieldTable(table, hostingNodes, targets)
+		return
+	}
+	header := []string{"Node Name", "LoadBalancer IP", "Source", "Services"}
+	if len(targets.ports) > 0 {
+		header = append(header, "Ports")
+	}
+	if len(targets.pools) > 0 {
+		header = append(header, "Pool")
+	}
+	if len(targets.speakers) > 0 {
+		header = append(header, "Speaker Pod")
+	}
+	if wide {
+		header = append(header, "Protocol", "Reverse DNS", "Responder MAC", "Vendor")
+	}
+	if len(targets.udpProbes) > 0 {
+		header = append(header, "UDP Probe")
+	}
+	if len(targets.flapping) > 0 {
+		header = append(header, "Consensus")
+	}
+	if len(targets.flaps) > 0 {
+		header = append(header, "Flaps")
+	}
+	table.SetHeader(header)
+	colorResultTable(table, len(header))
+
+	for _, row := range hostingNodes {
+		cells := append(row, targets.source(row[1]), targets.serviceList(row[1]))
+		if len(targets.ports) > 0 {
+			cells = append(cells, strings.Join(targets.portList(row[1]), ", "))
+		}
+		if len(targets.pools) > 0 {
+			cells = append(cells, targets.pools[row[1]])
+		}
+		if len(targets.speakers) > 0 {
+			cells = append(cells, targets.speakers[row[0]])
+		}
+		if wide {
+			mac := targets.responders[row[1]]
+			vendor := ""
+			if mac != "" {
+				vendor = macVendor(mac)
+			}
+			cells = append(cells, targets.protocols(row[1]), targets.ptrNames[row[1]], mac, vendor)
+		}
+		if len(targets.udpProbes) > 0 {
+			cells = append(cells, targets.udpProbes[row[1]])
+		}
+		if len(targets.flapping) > 0 {
+			consensus := "stable"
+			if targets.flapping[row[1]] {
+				consensus = "FLAPPING"
 			}
+			cells = append(cells, consensus)
+		}
+		if len(targets.flaps) > 0 {
+			cells = append(cells, strconv.Itoa(targets.flaps[row[1]]))
 		}
+		table.Append(cells)
+	}
+
+	table.Render() // Render the table with color settings
+}
+
+// printFieldTable prints the --fields columns of the result
+func printFieldTable(table *tablewriter.Table, hostingNodes [][]string, targets *ipSet) {
+	table.SetHeader(fieldHeaders(selectedFields))
+	colorResultTable(table, len(selectedFields))
+	for _, row := range hostingNodes {
+		table.Append(fieldCells(selectedFields, newReportRow(row, targets), ", "))
 	}
+	table.Render()
+}
 
-	// Print table with color
-	fmt.Println("\nHere is your result:")
+// colorResultTable colors the header and cells of a result table
+func colorResultTable(table *tablewriter.Table, columns int) {
+	if quiet {
+		return
+	}
+	// tablewriter wants exactly one color per column
+	headerColors := make([]tablewriter.Colors, columns)
+	columnColors := make([]tablewriter.Colors, columns)
+	for i := range headerColors {
+		headerColors[i] = tablewriter.Colors{tablewriter.Bold, tablewriter.FgRedColor}
+		columnColors[i] = tablewriter.Colors{tablewriter.Bold, tablewriter.FgYellowColor}
+	}
+	table.SetHeaderColor(headerColors...)
+	table.SetColumnColor(columnColors...)
+}
 
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Node Name", "LoadBalancer IP"})
-	table.SetHeaderColor(
-		tablewriter.Colors{tablewriter.Bold, tablewriter.FgRedColor},
-		tablewriter.Colors{tablewriter.Bold, tablewriter.FgRedColor},
-	)
-	table.SetColumnColor(
-		tablewriter.Colors{tablewriter.Bold, tablewriter.FgYellowColor},
-		tablewriter.Colors{tablewriter.Bold, tablewriter.FgYellowColor},
-	)
+// printResultsByPool prints one result table per pool, in pool name order,
+// with the IPs outside any known pool last
+func printResultsByPool(hostingNodes [][]string, targets *ipSet, wide bool) {
+	printResultSections(hostingNodes, targets, wide, "Pool", "(no pool)", func(ip string) []string {
+		return []string{targets.pools[ip]}
+	})
+}
 
+// printResultSections prints one titled table per section, sorted by name
+// with the rows in no section last under none. A row may be in several
+// sections and is then repeated in each.
+func printResultSections(hostingNodes [][]string, targets *ipSet, wide bool, title, none string, sections func(ip string) []string) {
+	bySection := make(map[string][][]string)
+	var names []string
 	for _, row := range hostingNodes {
-		table.Append(row)
+		rowSections := sections(row[1])
+		if len(rowSections) == 0 {
+			rowSections = []string{""}
+		}
+		for _, section := range rowSections {
+			if _, ok := bySection[section]; !ok {
+				names = append(names, section)
+			}
+			bySection[section] = append(bySection[section], row)
+		}
 	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i] == "" || names[j] == "" {
+			return names[j] == ""
+		}
+		return names[i] < names[j]
+	})
 
-	table.Render() // Render the table with color settings
+	if !quiet {
+		fmt.Println("\nHere is your result:")
+	}
+	for _, section := range names {
+		name := section
+		if name == "" {
+			name = none
+		}
+		fmt.Printf("\n%s%s %s:%s\n", ColorCyan, title, name, ColorReset)
+		printResultTable(bySection[section], targets, wide)
+	}
 }
 
 func removeInventoryFile() error {
+	// User-supplied and --inventory-out inventories are kept
+	if keepInventory {
+		return nil
+	}
+
 	// Check if the file exists
-	if _, err := os.Stat("k8s.inventory"); err == nil {
+	if _, err := os.Stat(inventoryFile); err == nil {
 		// Remove the file
-		if err := os.Remove("k8s.inventory"); err != nil {
+		if err := os.Remove(inventoryFile); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// parseAnsibleOutput splits the output of an ad-hoc ansible shell command into
+// the stdout of each host that ran it successfully, keyed by host name.
+func parseAnsibleOutput(out string) map[string]string {
+	results := make(map[string]string)
+	var host string
+	var lines []string
+	flush := func() {
+		if host != "" {
+			results[host] = strings.TrimSpace(strings.Join(lines, "\n"))
+		}
+		host, lines = "", nil
+	}
+	for _, line := range strings.Split(out, "\n") {
+		// Host headers look like "node-1 | CHANGED | rc=0 >>"
+		fields := strings.Split(line, " | ")
+		if len(fields) >= 3 && strings.HasSuffix(strings.TrimSpace(line), ">>") {
+			flush()
+			if fields[1] == "CHANGED" || fields[1] == "SUCCESS" {
+				host = strings.TrimSpace(fields[0])
+			}
+			continue
+		}
+		if host != "" {
+			lines = append(lines, line)
+		}
+	}
+	flush()
+	return results
+}
+
 func getInterfaceNameStartingWithSeven() string {
 	// Run a command using Ansible to get the interface name whose IP starts with '7'
-	cmd := exec.Command("ansible", "-i", "k8s.inventory", "k8s[1]", "-m", "shell", "-a", "ip route | awk '/7/ {print $3}' | head -2")
-	out, err := cmd.CombinedOutput()
+	cmd := exec.Command(ansiblePath, ansibleShellArgs("k8s[1]", "", interfaceDetectionCommand)...)
+	out, err := runCommand(cmd)
 	if err != nil {
+		logf("error executing Ansible command: %v", err)
 		fmt.Printf("%sError executing Ansible command: %v%s\n", ColorRed, err, ColorReset)
 		return "" // Return empty string or handle error appropriately
 	}
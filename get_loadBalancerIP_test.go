@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseAnsibleOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want map[string]string
+	}{
+		{
+			name: "successful hosts only",
+			out: strings.Join([]string{
+				"node-1 | CHANGED | rc=0 >>",
+				"7.10.20.0/24 dev eth0 proto kernel scope link src 7.10.20.11",
+				"eth0",
+				"node-2 | FAILED | rc=1 >>",
+				"ARPING 7.10.20.5 from 7.10.20.12 eth0",
+				"node-3 | UNREACHABLE! => {",
+				`    "changed": false,`,
+				`    "unreachable": true`,
+				"}",
+				"node-4 | SUCCESS | rc=0 >>",
+				"",
+			}, "\n"),
+			want: map[string]string{
+				"node-1": "7.10.20.0/24 dev eth0 proto kernel scope link src 7.10.20.11\neth0",
+				"node-4": "",
+			},
+		},
+		{
+			name: "output is trimmed",
+			out:  "node-1 | CHANGED | rc=0 >>\n\n  eth0  \n\n",
+			want: map[string]string{"node-1": "eth0"},
+		},
+		{name: "no hosts", out: "", want: map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseAnsibleOutput(tt.out); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAnsibleOutput() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMockEndToEnd runs the whole tool against the fixtures in testdata/mock.
+// main exits the process on failure, so it runs in a child test process.
+func TestMockEndToEnd(t *testing.T) {
+	if os.Getenv("LBIP_TEST_MAIN") == "1" {
+		os.Args = []string{"get_loadBalancerIP", "--mock", "testdata/mock", "--all", "--quiet", "--ansible-user", "mock", "--output", "json"}
+		main()
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestMockEndToEnd$")
+	cmd.Env = append(os.Environ(), "LBIP_TEST_MAIN=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("run failed: %v\nstdout:\n%s\nstderr:\n%s", err, out, stderr.String())
+	}
+
+	// The child test process prints PASS after the report
+	var r report
+	if err := json.NewDecoder(bytes.NewReader(out)).Decode(&r); err != nil {
+		t.Fatalf("decoding report: %v\n%s", err, out)
+	}
+	if r.APIVersion != reportAPIVersion {
+		t.Errorf("apiVersion = %q, want %q", r.APIVersion, reportAPIVersion)
+	}
+	var got []string
+	for _, row := range r.Results {
+		got = append(got, row.Node+" "+row.IP+" "+row.Source)
+	}
+	sort.Strings(got)
+	want := []string{"node-1 7.10.20.5 LoadBalancer", "node-2 7.10.20.6 LoadBalancer"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("results = %q, want %q", got, want)
+	}
+	if len(r.Unreachable) > 0 {
+		t.Errorf("unreachable = %v, want none", r.Unreachable)
+	}
+	if len(r.Errors) > 0 {
+		t.Errorf("errors = %+v, want none", r.Errors)
+	}
+	if _, err := os.Stat(inventoryFile); !os.IsNotExist(err) {
+		t.Errorf("inventory file %s was left behind", inventoryFile)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// grafanaTimeout bounds each annotation request
+const grafanaTimeout = 10 * time.Second
+
+// grafanaAnnotator posts annotations to the Grafana HTTP API with a service
+// account token from GRAFANA_TOKEN, so IP moves show up on dashboards
+type grafanaAnnotator struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+// grafanaAnnotation is the body of POST /api/annotations
+type grafanaAnnotation struct {
+	Time int64    `json:"time"`
+	Tags []string `json:"tags"`
+	Text string   `json:"text"`
+}
+
+func newGrafanaAnnotator(addr string) (*grafanaAnnotator, error) {
+	token := os.Getenv("GRAFANA_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("no Grafana token: set GRAFANA_TOKEN")
+	}
+	return &grafanaAnnotator{url: strings.TrimSuffix(addr, "/"), token: token, http: &http.Client{Timeout: grafanaTimeout}}, nil
+}
+
+// annotateMove records that ip moved between nodes. The request is sent in
+// the background so a slow Grafana never delays a cycle; failures are logged.
+func (g *grafanaAnnotator) annotateMove(ip, from, to string, at time.Time) {
+	if g == nil {
+		return
+	}
+	annotation := grafanaAnnotation{
+		Time: at.UnixMilli(),
+		Tags: []string{"get_loadBalancerIP", "ip-moved", "ip:" + ip, "from:" + from, "to:" + to},
+		Text: fmt.Sprintf("%s moved from %s to %s", ip, from, to),
+	}
+	go func() {
+		if err := g.post(annotation); err != nil {
+			logf("error annotating Grafana: %v", err)
+		}
+	}()
+}
+
+func (g *grafanaAnnotator) post(annotation grafanaAnnotation) error {
+	body, err := json.Marshal(annotation)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", g.url+"/api/annotations", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("POST /api/annotations: %s", resp.Status)
+	}
+	return nil
+}
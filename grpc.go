@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+// The gRPC API is a single service, lbip.v1.Prober, whose messages are
+// exchanged as JSON so clients need no generated code. Clients select the
+// codec with the "json" content subtype, e.g. grpc.CallContentSubtype("json"),
+// and open a server stream on /lbip.v1.Prober/ProbeAll.
+
+// jsonCodec marshals gRPC messages as JSON
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return "json" }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// probeAllRequest selects the IPs to probe; when empty the daemon's
+// configured targets are probed.
+type probeAllRequest struct {
+	IPs []string `json:"ips,omitempty"`
+}
+
+// probeFunc probes ips (or the configured targets when empty) and calls
+// onResult with each row as soon as it is confirmed.
+type probeFunc func(ctx context.Context, ips []string, onResult func(row reportRow)) error
+
+// proberService implements lbip.v1.Prober
+type proberService struct {
+	probe probeFunc
+}
+
+// ProbeAll streams a reportRow for every hosting node as it is discovered
+func (s *proberService) ProbeAll(req *probeAllRequest, stream grpc.ServerStream) error {
+	var ips []string
+	if len(req.IPs) > 0 {
+		var err error
+		ips, err = parseIPList(strings.Join(req.IPs, ","))
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	var sendErr error
+	err := s.probe(stream.Context(), ips, func(row reportRow) {
+		if sendErr == nil {
+			sendErr = stream.SendMsg(&row)
+		}
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+var proberServiceDesc = grpc.ServiceDesc{
+	ServiceName: "lbip.v1.Prober",
+	HandlerType: (*interface {
+		ProbeAll(*probeAllRequest, grpc.ServerStream) error
+	})(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ProbeAll",
+			ServerStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				var req probeAllRequest
+				if err := stream.RecvMsg(&req); err != nil {
+					return err
+				}
+				return srv.(*proberService).ProbeAll(&req, stream)
+			},
+		},
+	},
+}
+
+// serveGRPC serves the Prober service on addr until ctx is cancelled
+func serveGRPC(ctx context.Context, addr string, probe probeFunc) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := grpc.NewServer()
+	server.RegisterService(&proberServiceDesc, &proberService{probe: probe})
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	logf("gRPC API listening on %s", addr)
+	return server.Serve(listener)
+}
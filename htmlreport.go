@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// htmlReportTemplate renders a report as a standalone page, readable when
+// shared on screen during an incident call
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{"join": strings.Join}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>LoadBalancer IP placement - {{.Metadata.Cluster}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: left; }
+th { background: #eee; }
+.meta, .empty { color: #666; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>LoadBalancer IP placement</h1>
+<p class="meta">Cluster {{.Metadata.Cluster}} (context {{.Metadata.Context}}) | run {{.Metadata.RunID}} | {{.Metadata.Finished.Format "2006-01-02 15:04:05 MST"}}</p>
+{{with .Metadata.StaleInventory}}<p class="error">Based on stale inventory from {{.Format "2006-01-02 15:04:05 MST"}}: the Kubernetes API was unavailable</p>{{end}}
+<table>
+<tr><th>Node Name</th><th>LoadBalancer IP</th><th>Source</th><th>Pool</th><th>Services</th><th>Ports</th></tr>
+{{range .Results}}<tr><td>{{.Node}}</td><td>{{.IP}}</td><td>{{.Source}}</td><td>{{.Pool}}</td><td>{{join .Services ", "}}</td><td>{{join .Ports ", "}}</td></tr>
+{{else}}<tr><td colspan="6" class="empty">No node hosts any of the LB IPs</td></tr>
+{{end}}</table>
+{{if .Unreachable}}<p class="error">UNREACHABLE (excluded from the result): {{join .Unreachable ", "}}</p>{{end}}
+{{if .Maintenance}}<p>IN MAINTENANCE (not probed): {{range $i, $n := .Maintenance}}{{if $i}}, {{end}}{{$n.Node}} ({{$n.Taint}}){{end}}</p>{{end}}
+{{if .CloudManaged}}<h2>Cloud-managed load balancers</h2>
+<table>
+<tr><th>Service</th><th>Provider</th><th>Address</th></tr>
+{{range .CloudManaged}}<tr><td>{{.Namespace}}/{{.Service}}</td><td>{{.Provider}}</td><td>{{.Address}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Errors}}<h2 class="error">Errors</h2>
+<table>
+<tr><th>Phase</th><th>Subject</th><th>Error</th></tr>
+{{range .Errors}}<tr><td>{{.Phase}}</td><td>{{.Subject}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>{{end}}
+</body>
+</html>
+`))
+
+// openHTMLReport writes the report as an HTML page to a temporary file and
+// opens it in the default browser. The file is left behind for the browser
+// to read and returned so it can be shown if no browser starts.
+func openHTMLReport(r report) (string, error) {
+	file, err := os.CreateTemp("", "get_loadBalancerIP-*.html")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if err := htmlReportTemplate.Execute(file, r); err != nil {
+		return file.Name(), err
+	}
+	if err := file.Close(); err != nil {
+		return file.Name(), err
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", file.Name())
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", file.Name())
+	default:
+		cmd = exec.Command("xdg-open", file.Name())
+	}
+	if err := cmd.Start(); err != nil {
+		return file.Name(), fmt.Errorf("opening a browser: %v", err)
+	}
+	go cmd.Wait()
+	return file.Name(), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// interfaceCacheEntry is the interface detected on a node and when
+type interfaceCacheEntry struct {
+	Interface  string    `json:"interface"`
+	DetectedAt time.Time `json:"detectedAt"`
+}
+
+// interfaceCache keeps detected interfaces across runs, keyed by
+// interfaceCacheKey, since detection is slow and rarely changes.
+type interfaceCache struct {
+	path    string
+	ttl     time.Duration
+	Entries map[string]interfaceCacheEntry `json:"entries"`
+}
+
+// loadInterfaceCache reads the cache from the user cache directory. A missing
+// or unreadable cache starts empty.
+func loadInterfaceCache(ttl time.Duration) *interfaceCache {
+	c := &interfaceCache{ttl: ttl, Entries: make(map[string]interfaceCacheEntry)}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return c
+	}
+	c.path = filepath.Join(dir, "get_loadBalancerIP", "interfaces.json")
+	if data, err := os.ReadFile(c.path); err == nil {
+		if err := json.Unmarshal(data, c); err != nil || c.Entries == nil {
+			c.Entries = make(map[string]interfaceCacheEntry)
+		}
+	}
+	return c
+}
+
+// interfaceCacheKey names the cache entry of the interface detected on node.
+// The same node name may be another machine in another cluster, and each
+// backend detects the interface its own way, so the kubeconfig context, its
+// cluster and the backend are part of the key.
+func interfaceCacheKey(kubeconfig, backend, node string) string {
+	context, cluster := "current", ""
+	if rawConfig, err := loadKubeconfig(kubeconfig); err == nil && rawConfig.CurrentContext != "" {
+		context = rawConfig.CurrentContext
+		if c, ok := rawConfig.Contexts[context]; ok {
+			cluster = c.Cluster
+		}
+	}
+	return strings.Join([]string{context, cluster, backend, node}, "|")
+}
+
+// lookup returns the interface cached under key if it is younger than the TTL
+func (c *interfaceCache) lookup(key string) (string, bool) {
+	entry, ok := c.Entries[key]
+	if !ok || c.ttl <= 0 || time.Since(entry.DetectedAt) > c.ttl {
+		return "", false
+	}
+	return entry.Interface, true
+}
+
+// store caches the interface under key and saves the cache
+func (c *interfaceCache) store(key, iface string) {
+	if c.path == "" || c.ttl <= 0 {
+		return
+	}
+	c.Entries[key] = interfaceCacheEntry{Interface: iface, DetectedAt: time.Now()}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(c.path), 0700)
+	}
+	if err == nil {
+		err = os.WriteFile(c.path, data, 0600)
+	}
+	if err != nil {
+		logf("error saving interface cache %s: %v", c.path, err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInterfaceCacheKey(t *testing.T) {
+	dir := t.TempDir()
+	kubeconfig := func(name, currentContext string) string {
+		path := filepath.Join(dir, name)
+		content := `apiVersion: v1
+kind: Config
+clusters:
+- name: dc1
+  cluster: {server: "https://dc1.example.com:6443"}
+- name: dc2
+  cluster: {server: "https://dc2.example.com:6443"}
+contexts:
+- name: admin@dc1
+  context: {cluster: dc1, user: admin}
+- name: admin@dc2
+  context: {cluster: dc2, user: admin}
+current-context: ` + currentContext + "\n"
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	dc1, dc2 := kubeconfig("dc1", "admin@dc1"), kubeconfig("dc2", "admin@dc2")
+
+	if got, want := interfaceCacheKey(dc1, "ansible", "node-1"), "admin@dc1|dc1|ansible|node-1"; got != want {
+		t.Errorf("interfaceCacheKey() = %q, want %q", got, want)
+	}
+	keys := map[string]bool{
+		interfaceCacheKey(dc1, "ansible", "node-1"):  true,
+		interfaceCacheKey(dc2, "ansible", "node-1"):  true,
+		interfaceCacheKey(dc1, "teleport", "node-1"): true,
+		interfaceCacheKey(dc1, "ansible", "node-2"):  true,
+	}
+	if len(keys) != 4 {
+		t.Errorf("keys of different clusters, backends and nodes collide: %v", keys)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// informerResync is how often the informers replay their cache. Watches keep
+// it current in between.
+const informerResync = 10 * time.Minute
+
+// clusterCache serves the objects discovery reads from shared informers, so
+// daemon cycles work off an in-memory cache updated by watches instead of
+// listing every service, ingress and gateway each interval.
+type clusterCache struct {
+	services  cache.Indexer
+	ingresses cache.Indexer
+	gateways  cache.GenericLister
+	nodes     cache.Indexer
+}
+
+// startClusterCache starts the informers discovery needs and waits for their
+// initial sync. They stop when ctx is done.
+func startClusterCache(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, opts discoveryOptions) (*clusterCache, error) {
+	factory := informers.NewSharedInformerFactory(clientset, informerResync)
+	c := &clusterCache{services: factory.Core().V1().Services().Informer().GetIndexer(), nodes: factory.Core().V1().Nodes().Informer().GetIndexer()}
+	if opts.IncludeIngress {
+		c.ingresses = factory.Networking().V1().Ingresses().Informer().GetIndexer()
+	}
+	factory.Start(ctx.Done())
+	for informerType, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return nil, fmt.Errorf("syncing %v informer", informerType)
+		}
+	}
+
+	if opts.IncludeGateways {
+		dynamicFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, informerResync)
+		c.gateways = dynamicFactory.ForResource(gatewayResource).Lister()
+		dynamicFactory.Start(ctx.Done())
+		for resource, synced := range dynamicFactory.WaitForCacheSync(ctx.Done()) {
+			if !synced {
+				return nil, fmt.Errorf("syncing %s informer", resource.Resource)
+			}
+		}
+	}
+	return c, nil
+}
+
+// listServices returns every service, from the cache if there is one
+func listServices(clientset kubernetes.Interface, c *clusterCache) ([]corev1.Service, error) {
+	if c == nil {
+		services, err := clientset.CoreV1().Services("").List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return services.Items, nil
+	}
+	var services []corev1.Service
+	for _, obj := range c.services.List() {
+		services = append(services, *obj.(*corev1.Service))
+	}
+	return services, nil
+}
+
+// listNodes returns the names, addresses and roles of the cached nodes, in
+// name order like a List, leaving out nodes that are being deleted
+func (c *clusterCache) listNodes(addressType string) ([]string, map[string]string, map[string]string) {
+	var nodes []corev1.Node
+	for _, obj := range c.nodes.List() {
+		if node := obj.(*corev1.Node); node.DeletionTimestamp == nil {
+			nodes = append(nodes, *node)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return describeNodes(nodes, addressType)
+}
+
+// listIngresses returns every ingress, from the cache if there is one
+func listIngresses(clientset kubernetes.Interface, c *clusterCache) ([]networkingv1.Ingress, error) {
+	if c == nil || c.ingresses == nil {
+		ingresses, err := clientset.NetworkingV1().Ingresses("").List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return ingresses.Items, nil
+	}
+	var ingresses []networkingv1.Ingress
+	for _, obj := range c.ingresses.List() {
+		ingresses = append(ingresses, *obj.(*networkingv1.Ingress))
+	}
+	return ingresses, nil
+}
+
+// listGateways returns every Gateway, from the cache if there is one
+func listGateways(dynamicClient dynamic.Interface, c *clusterCache) ([]unstructured.Unstructured, error) {
+	if c == nil || c.gateways == nil {
+		gateways, err := dynamicClient.Resource(gatewayResource).Namespace("").List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return gateways.Items, nil
+	}
+	objs, err := c.gateways.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var gateways []unstructured.Unstructured
+	for _, obj := range objs {
+		if gateway, ok := obj.(*unstructured.Unstructured); ok {
+			gateways = append(gateways, *gateway)
+		}
+	}
+	return gateways, nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// maxExpandedIPs caps how many addresses a single CIDR or range entry may
+// expand to, so a typo like /8 doesn't queue millions of probes.
+const maxExpandedIPs = 4096
+
+// ipSet collects discovered IPs in order, remembering where each one came from
+// and which services share it, e.g. through MetalLB's allow-shared-ip. Each IP
+// is probed once however many services use it.
+type ipSet struct {
+	ips      []string
+	sources  map[string][]string
+	services map[string][]string
+
+	// ports are the service ports exposed on each IP, and udpProbes the
+	// outcome of probing the UDP ones with --udp-probe
+	ports     map[string][]servicePort
+	udpProbes map[string]string
+
+	// ptrNames are the reverse DNS names of each IP, for the wide output
+	ptrNames map[string]string
+
+	// pools are the MetalLB or Cilium pools the IPs belong to, and
+	// bgpAdvertised the IPs taken out of ips because their pool is only
+	// announced over BGP
+	pools         map[string]string
+	bgpAdvertised []string
+
+	// responders are the MACs seen answering for each IP, when the backend
+	// reads them from an ARP or neighbor table
+	responders map[string]string
+
+	// tenants are the namespaces, or tenant label values, of the services
+	// using each IP, for --report-by-namespace
+	tenants map[string][]string
+
+	// speakers are the MetalLB speaker pods, as namespace/name, on each
+	// node rather than for each IP
+	speakers map[string]string
+
+	// maintenance are the nodes skipped for carrying a --skip-taints taint,
+	// with the taint found
+	maintenance map[string]string
+
+	// flapping are the IPs whose --consensus probes gave differing answers
+	flapping map[string]bool
+
+	// flaps are how often each IP changed owner within the daemon's
+	// --flap-window
+	flaps map[string]int
+}
+
+// servicePort is a port a service exposes on its LB IP
+type servicePort struct {
+	Port     int32
+	Protocol string
+}
+
+func newIPSet() *ipSet {
+	return &ipSet{sources: make(map[string][]string), services: make(map[string][]string), ports: make(map[string][]servicePort), udpProbes: make(map[string]string), ptrNames: make(map[string]string), responders: make(map[string]string), pools: make(map[string]string), tenants: make(map[string][]string), speakers: make(map[string]string), flapping: make(map[string]bool), flaps: make(map[string]int)}
+}
+
+// add records ip as discovered from source, ignoring repeats of either
+func (s *ipSet) add(ip, source string) {
+	if _, ok := s.sources[ip]; !ok {
+		s.ips = append(s.ips, ip)
+	}
+	for _, existing := range s.sources[ip] {
+		if existing == source {
+			return
+		}
+	}
+	s.sources[ip] = append(s.sources[ip], source)
+}
+
+// addService records that service, as namespace/name:ports, uses ip
+func (s *ipSet) addService(ip, service string) {
+	for _, existing := range s.services[ip] {
+		if existing == service {
+			return
+		}
+	}
+	s.services[ip] = append(s.services[ip], service)
+}
+
+// addPort records that port is exposed on ip
+func (s *ipSet) addPort(ip string, port servicePort) {
+	for _, existing := range s.ports[ip] {
+		if existing == port {
+			return
+		}
+	}
+	s.ports[ip] = append(s.ports[ip], port)
+}
+
+// portList returns the ports exposed on ip, like 80/TCP
+func (s *ipSet) portList(ip string) []string {
+	var ports []string
+	for _, port := range s.ports[ip] {
+		ports = append(ports, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+	}
+	return ports
+}
+
+// protocols returns the protocols exposed on ip, like TCP, UDP or TCP/UDP
+func (s *ipSet) protocols(ip string) string {
+	var protocols []string
+	seen := make(map[string]bool)
+	for _, port := range s.ports[ip] {
+		if !seen[port.Protocol] {
+			seen[port.Protocol] = true
+			protocols = append(protocols, port.Protocol)
+		}
+	}
+	return strings.Join(protocols, "/")
+}
+
+// serviceList returns the services using ip, separated by semicolons
+func (s *ipSet) serviceList(ip string) string {
+	return strings.Join(s.services[ip], "; ")
+}
+
+// source returns the comma-separated sources ip was discovered from
+func (s *ipSet) source(ip string) string {
+	return strings.Join(s.sources[ip], ", ")
+}
+
+// readIPList reads IPs, CIDRs and ranges separated by newlines, commas or
+// spaces from r, as piped to --ips - or kept in an --ip-file. Everything
+// after a # on a line is a comment.
+func readIPList(r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		entries = append(entries, strings.Fields(strings.ReplaceAll(line, ",", " "))...)
+	}
+	return parseIPList(strings.Join(entries, ","))
+}
+
+// readIPFile reads the LB IPs of an --ip-file with readIPList
+func readIPFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	ips, err := readIPList(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return ips, nil
+}
+
+// parseIPList parses a comma-separated list of IPs, CIDRs and ranges into a
+// normalized, deduplicated list of IPs, preserving the order they were given.
+func parseIPList(input string) ([]string, error) {
+	var lbIPs []string
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(input, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ips, err := expandIPEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			addr, err := netip.ParseAddr(ip)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP address %q (expected e.g. 7.10.20.4, 7.10.20.0/28 or 7.10.20.5-7.10.20.9)", ip)
+			}
+			ip = addr.Unmap().String()
+			if !seen[ip] {
+				seen[ip] = true
+				lbIPs = append(lbIPs, ip)
+			}
+		}
+	}
+	if len(lbIPs) == 0 {
+		return nil, fmt.Errorf("no LB IPs were entered")
+	}
+	return lbIPs, nil
+}
+
+// expandIPEntry expands a CIDR (7.10.20.0/28) or an inclusive range
+// (7.10.20.5-7.10.20.9) into individual IPs. Any other entry is returned as is.
+func expandIPEntry(entry string) ([]string, error) {
+	switch {
+	case strings.Contains(entry, "/"):
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %v", entry, err)
+		}
+		prefix = prefix.Masked()
+		var ips []string
+		for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+			if len(ips) == maxExpandedIPs {
+				return nil, fmt.Errorf("CIDR %q expands to more than %d addresses", entry, maxExpandedIPs)
+			}
+			ips = append(ips, addr.String())
+		}
+		return ips, nil
+
+	case strings.Contains(entry, "-"):
+		bounds := strings.SplitN(entry, "-", 2)
+		start, err := netip.ParseAddr(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid range start in %q: %v", entry, err)
+		}
+		end, err := netip.ParseAddr(strings.TrimSpace(bounds[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid range end in %q: %v", entry, err)
+		}
+		if start.BitLen() != end.BitLen() || end.Less(start) {
+			return nil, fmt.Errorf("invalid range %q: end must not be before start", entry)
+		}
+		var ips []string
+		for addr := start; addr.IsValid() && addr.Compare(end) <= 0; addr = addr.Next() {
+			if len(ips) == maxExpandedIPs {
+				return nil, fmt.Errorf("range %q expands to more than %d addresses", entry, maxExpandedIPs)
+			}
+			ips = append(ips, addr.String())
+		}
+		return ips, nil
+	}
+
+	return []string{entry}, nil
+}
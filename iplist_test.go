@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIPList(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "single IP", input: "7.10.20.4", want: []string{"7.10.20.4"}},
+		{name: "spaces and repeats", input: " 7.10.20.4, 7.10.20.5,7.10.20.4 ", want: []string{"7.10.20.4", "7.10.20.5"}},
+		{name: "CIDR and range", input: "7.10.20.0/31,7.10.20.5-7.10.20.6", want: []string{"7.10.20.0", "7.10.20.1", "7.10.20.5", "7.10.20.6"}},
+		{name: "repeat inside a range", input: "7.10.20.5,7.10.20.4-7.10.20.6", want: []string{"7.10.20.5", "7.10.20.4", "7.10.20.6"}},
+		{name: "IPv4-mapped IPv6 is unmapped", input: "::ffff:7.10.20.4", want: []string{"7.10.20.4"}},
+		{name: "only separators", input: " , ", wantErr: true},
+		{name: "invalid IP", input: "7.10.20", wantErr: true},
+		{name: "invalid range", input: "7.10.20.9-7.10.20.5", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIPList(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseIPList(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseIPList(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandIPEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "plain IP", entry: "7.10.20.4", want: []string{"7.10.20.4"}},
+		{name: "CIDR", entry: "7.10.20.0/30", want: []string{"7.10.20.0", "7.10.20.1", "7.10.20.2", "7.10.20.3"}},
+		{name: "CIDR is masked", entry: "7.10.20.5/31", want: []string{"7.10.20.4", "7.10.20.5"}},
+		{name: "single-address range", entry: "7.10.20.9-7.10.20.9", want: []string{"7.10.20.9"}},
+		{name: "range with spaces", entry: "7.10.20.8 - 7.10.20.9", want: []string{"7.10.20.8", "7.10.20.9"}},
+		{name: "IPv6 range", entry: "fd00::1-fd00::2", want: []string{"fd00::1", "fd00::2"}},
+		{name: "range ending before its start", entry: "7.10.20.9-7.10.20.5", wantErr: true},
+		{name: "range across families", entry: "7.10.20.1-fd00::1", wantErr: true},
+		{name: "invalid range start", entry: "node-1", wantErr: true},
+		{name: "invalid CIDR", entry: "7.10.20.0/33", wantErr: true},
+		{name: "CIDR too large", entry: "7.10.0.0/16", wantErr: true},
+		{name: "range too large", entry: "7.10.0.0-7.10.255.255", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandIPEntry(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandIPEntry(%q) error = %v, wantErr %v", tt.entry, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandIPEntry(%q) = %v, want %v", tt.entry, got, tt.want)
+			}
+		})
+	}
+}
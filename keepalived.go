@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// keepalivedVIPCommand prints the entries of every virtual_ipaddress block
+// in the keepalived configuration, one per line
+const keepalivedVIPCommand = `awk '/virtual_ipaddress *\{/{f=1;next} f&&/\}/{f=0} f{print $1}' /etc/keepalived/keepalived.conf /etc/keepalived/conf.d/*.conf 2>/dev/null; true`
+
+// collectKeepalivedVIPs adds the VRRP VIPs configured in keepalived on the
+// inventory nodes, so entry IPs fronting ingress nodes are probed alongside
+// the LoadBalancers. Whichever node holds a VIP as VRRP master is then found
+// by the usual probe. Nodes without keepalived contribute nothing.
+func collectKeepalivedVIPs(lbIPs *ipSet, ansibleUsername string) error {
+	cmd := exec.Command(ansiblePath, ansibleShellArgs("k8s", ansibleUsername, keepalivedVIPCommand)...)
+	out, err := runCommand(cmd)
+	outputs := parseAnsibleOutput(string(out))
+	if err != nil && len(outputs) == 0 {
+		return fmt.Errorf("reading keepalived configuration: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	for node, output := range outputs {
+		for _, vip := range parseKeepalivedVIPs(output) {
+			if strings.HasPrefix(vip, "7") {
+				lbIPs.add(vip, "Keepalived")
+				lbIPs.addService(vip, "keepalived@"+node)
+			}
+		}
+	}
+	return nil
+}
+
+// parseKeepalivedVIPs extracts the addresses of virtual_ipaddress entries
+// like "7.10.20.4/24" or "7.10.20.5", dropping the prefix length
+func parseKeepalivedVIPs(out string) []string {
+	var vips []string
+	for _, line := range strings.Split(out, "\n") {
+		vip, _, _ := strings.Cut(strings.TrimSpace(line), "/")
+		if vip != "" {
+			vips = append(vips, vip)
+		}
+	}
+	return vips
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// kubeconfigLoadingRules finds the kubeconfig the way kubectl does: the
+// --kubeconfig file if one was given, otherwise every file listed in
+// $KUBECONFIG merged in order, otherwise ~/.kube/config
+func kubeconfigLoadingRules(kubeconfig string) *clientcmd.ClientConfigLoadingRules {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	return rules
+}
+
+// loadKubeconfig returns the merged kubeconfig
+func loadKubeconfig(kubeconfig string) (*clientcmdapi.Config, error) {
+	return kubeconfigLoadingRules(kubeconfig).Load()
+}
+
+// contextRESTConfig returns the client config of contextName, or of the
+// current context when contextName is empty
+func contextRESTConfig(kubeconfig, contextName string) (*rest.Config, error) {
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		kubeconfigLoadingRules(kubeconfig),
+		&clientcmd.ConfigOverrides{CurrentContext: contextName},
+	).ClientConfig()
+}
+
+// kubectlConfigArgs passes --kubeconfig on to kubectl when one was given;
+// otherwise kubectl merges $KUBECONFIG itself
+func kubectlConfigArgs(kubeconfig string) []string {
+	if kubeconfig == "" {
+		return nil
+	}
+	return []string{"--kubeconfig", kubeconfig}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// leaseName is the coordination.k8s.io Lease the daemon replicas compete for
+const leaseName = "get-loadbalancer-ip"
+
+// leaderElector tracks whether this replica holds the lease, so that only
+// one replica of an HA deployment sends ARP traffic.
+type leaderElector struct {
+	clientset kubernetes.Interface
+	namespace string
+	identity  string
+
+	leading atomic.Bool
+	started chan struct{}
+}
+
+func newLeaderElector(clientset kubernetes.Interface, namespace string) *leaderElector {
+	identity, err := os.Hostname()
+	if err != nil {
+		identity = "unknown"
+	}
+	return &leaderElector{clientset: clientset, namespace: namespace, identity: identity, started: make(chan struct{}, 1)}
+}
+
+// run competes for the lease until ctx is done, releasing it on the way out
+func (l *leaderElector) run(ctx context.Context) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: leaseName, Namespace: l.namespace},
+		Client:     l.clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: l.identity},
+	}
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   15 * time.Second,
+			RenewDeadline:   10 * time.Second,
+			RetryPeriod:     2 * time.Second,
+			ReleaseOnCancel: true,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					logf("%s became the leader", l.identity)
+					l.leading.Store(true)
+					select {
+					case l.started <- struct{}{}:
+					default:
+					}
+				},
+				OnStoppedLeading: func() {
+					logf("%s stopped leading", l.identity)
+					l.leading.Store(false)
+				},
+			},
+		})
+	}
+}
+
+// isLeader reports whether this replica may probe. Without leader election
+// every replica probes.
+func (l *leaderElector) isLeader() bool {
+	return l == nil || l.leading.Load()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// runLogger records probes, remote command output and errors to --log-file.
+// It is nil when no log file was requested.
+var runLogger *log.Logger
+
+// rotatingFile is an io.Writer that rotates the underlying file once it
+// exceeds maxSize bytes, keeping up to maxBackups old files as path.1, path.2, ...
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size = file, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxSize > 0 && r.size+int64(len(p)) > r.maxSize && r.size > 0 {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts path.N-1 to path.N, moves the current file to path.1 and
+// reopens an empty file, dropping anything beyond maxBackups.
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	if r.maxBackups > 0 {
+		for i := r.maxBackups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// setupLogFile starts logging to path, rotating at maxSizeMB megabytes
+func setupLogFile(path string, maxSizeMB, maxBackups int) (io.Closer, error) {
+	file, err := newRotatingFile(path, int64(maxSizeMB)*1024*1024, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	runLogger = log.New(file, "", log.LstdFlags|log.Lmicroseconds)
+	return file, nil
+}
+
+// logf writes a line to the run log, if one is configured
+func logf(format string, args ...interface{}) {
+	if runLogger != nil {
+		runLogger.Printf(format, args...)
+	}
+}
+
+// runCommand runs cmd and returns its combined output, logging the command
+// line, its output and its exit status to the run log.
+func runCommand(cmd *exec.Cmd) ([]byte, error) {
+	return runNamedCommand("", cmd)
+}
+
+// runNamedCommand is runCommand for a command whose debug artifact is saved
+// under name, such as node_ip for a probe.
+func runNamedCommand(name string, cmd *exec.Cmd) ([]byte, error) {
+	var out []byte
+	var err error
+	if artifactsDir != "" {
+		var combined, stdout, stderr bytes.Buffer
+		cmd.Stdout = io.MultiWriter(&combined, &stdout)
+		cmd.Stderr = io.MultiWriter(&combined, &stderr)
+		err = cmd.Run()
+		out = combined.Bytes()
+		saveArtifact(name, cmd, stdout.Bytes(), stderr.Bytes(), err)
+	} else {
+		out, err = cmd.CombinedOutput()
+	}
+	if runLogger != nil {
+		status := "ok"
+		if err != nil {
+			status = err.Error()
+		}
+		logf("exec %q: %s\n%s", strings.Join(cmd.Args, " "), status, strings.TrimRight(string(out), "\n"))
+	}
+	return out, err
+}
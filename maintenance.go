@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// defaultSkipTaints are the taints of nodes under planned maintenance: the
+// one cordoning adds and the one marking a node shut down for good
+const defaultSkipTaints = "node.kubernetes.io/unschedulable,node.kubernetes.io/out-of-service"
+
+// maintenanceNode is a node left out of probing because of a taint
+type maintenanceNode struct {
+	Node  string `json:"node"`
+	Taint string `json:"taint"`
+}
+
+// maintenanceTaint returns the first of taints, as key or key=value, that
+// node carries, or "". A cordoned node counts as tainted with
+// node.kubernetes.io/unschedulable even before the taint controller adds it.
+func maintenanceTaint(node corev1.Node, taints []string) string {
+	for _, skip := range taints {
+		key, value, hasValue := strings.Cut(skip, "=")
+		if key == corev1.TaintNodeUnschedulable && node.Spec.Unschedulable {
+			return skip
+		}
+		for _, taint := range node.Spec.Taints {
+			if taint.Key == key && (!hasValue || taint.Value == value) {
+				return skip
+			}
+		}
+	}
+	return ""
+}
+
+// getMaintenanceNodes returns the nodes carrying any of taints and, keyed by
+// node, the taint found. Nodes come from the cache if there is one.
+func getMaintenanceNodes(clientset kubernetes.Interface, c *clusterCache, taints []string) (map[string]string, error) {
+	var nodeList []corev1.Node
+	if c == nil {
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		nodeList = nodes.Items
+	} else {
+		for _, obj := range c.nodes.List() {
+			nodeList = append(nodeList, *obj.(*corev1.Node))
+		}
+	}
+	maintenance := make(map[string]string)
+	for _, node := range nodeList {
+		if taint := maintenanceTaint(node, taints); taint != "" {
+			maintenance[node.Name] = taint
+		}
+	}
+	return maintenance, nil
+}
+
+// skipMaintenance returns nodes without those in maintenance, keeping only
+// the ones found among nodes in maintenance so the report lists no node that
+// was filtered out for another reason
+func skipMaintenance(nodes []string, maintenance map[string]string) ([]string, map[string]string) {
+	var remaining []string
+	skipped := make(map[string]string)
+	for _, node := range nodes {
+		if taint, ok := maintenance[node]; ok {
+			skipped[node] = taint
+			continue
+		}
+		remaining = append(remaining, node)
+	}
+	return remaining, skipped
+}
+
+// maintenanceNodes lists the skipped nodes of targets in node order
+func maintenanceNodes(targets *ipSet) []maintenanceNode {
+	var nodes []maintenanceNode
+	for node, taint := range targets.maintenance {
+		nodes = append(nodes, maintenanceNode{Node: node, Taint: taint})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Node < nodes[j].Node })
+	return nodes
+}
+
+// printMaintenance lists the nodes skipped for maintenance below the table
+func printMaintenance(nodes []maintenanceNode) {
+	if len(nodes) == 0 {
+		return
+	}
+	var skipped []string
+	for _, n := range nodes {
+		skipped = append(skipped, fmt.Sprintf("%s (%s)", n.Node, n.Taint))
+	}
+	fmt.Printf("%sIN MAINTENANCE (not probed): %s%s\n", ColorYellow, strings.Join(skipped, ", "), ColorReset)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// version is the tool version, set at build time with
+// -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+// runMetadata identifies the run that produced a report, so archived
+// reports are self-describing. Finished is stamped when the report is
+// written.
+type runMetadata struct {
+	RunID    string    `json:"runId"`
+	Version  string    `json:"version"`
+	Cluster  string    `json:"cluster"`
+	Context  string    `json:"context"`
+	User     string    `json:"user,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// StaleInventory, when set, is when the node and service inventory the
+	// results are based on was read, because the API server was unavailable
+	StaleInventory *time.Time `json:"staleInventory,omitempty"`
+}
+
+var (
+	runMetaMu sync.Mutex
+	runMeta   runMetadata
+)
+
+// startRun records the start of a run, or of a daemon cycle, under a new
+// run ID. The cluster, context and user are read from the kubeconfig's
+// current context; in mock mode they are all "mock".
+func startRun(kubeconfig string, mock bool) {
+	meta := runMetadata{RunID: newRunID(), Version: version, Cluster: "mock", Context: "mock", User: "mock", Started: time.Now().UTC()}
+	if !mock {
+		meta.Cluster, meta.Context, meta.User = "", "", ""
+		if rawConfig, err := loadKubeconfig(kubeconfig); err == nil {
+			meta.Context = rawConfig.CurrentContext
+			if context := rawConfig.Contexts[rawConfig.CurrentContext]; context != nil {
+				meta.Cluster, meta.User = context.Cluster, context.AuthInfo
+			}
+		}
+	}
+	runMetaMu.Lock()
+	defer runMetaMu.Unlock()
+	runMeta = meta
+}
+
+// restartRun starts a daemon cycle under a new run ID, keeping the cluster
+func restartRun() {
+	runMetaMu.Lock()
+	defer runMetaMu.Unlock()
+	runMeta.RunID, runMeta.Started, runMeta.StaleInventory = newRunID(), time.Now().UTC(), nil
+}
+
+// markStaleInventory records that the current cycle probes against the
+// inventory read at taken
+func markStaleInventory(taken time.Time) {
+	runMetaMu.Lock()
+	defer runMetaMu.Unlock()
+	taken = taken.UTC()
+	runMeta.StaleInventory = &taken
+}
+
+// currentRun returns the metadata of the current run, finished now
+func currentRun() runMetadata {
+	runMetaMu.Lock()
+	defer runMetaMu.Unlock()
+	meta := runMeta
+	meta.Finished = time.Now().UTC()
+	return meta
+}
+
+// newRunID returns a random 16-character hex ID
+func newRunID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
+
+// writeCSVComments writes the metadata as # comment lines ahead of a CSV
+// header. encoding/csv reads them back with Reader.Comment = '#'.
+func (m runMetadata) writeCSVComments(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# runId: %s\n# version: %s\n# cluster: %s\n# context: %s\n# user: %s\n# started: %s\n# finished: %s\n",
+		m.RunID, m.Version, m.Cluster, m.Context, m.User, m.Started.Format(time.RFC3339), m.Finished.Format(time.RFC3339))
+	if err == nil && m.StaleInventory != nil {
+		_, err = fmt.Fprintf(w, "# staleInventory: %s\n", m.StaleInventory.Format(time.RFC3339))
+	}
+	return err
+}
+
+// printRunFooter prints the metadata below a table report. Quiet mode
+// prints only the result.
+func printRunFooter(m runMetadata) {
+	if quiet {
+		return
+	}
+	fmt.Printf("\nRun %s | get_loadBalancerIP %s | cluster %s (context %s, user %s) | %s to %s\n", m.RunID, m.Version, m.Cluster, m.Context, m.User, m.Started.Format(time.RFC3339), m.Finished.Format(time.RFC3339))
+	if m.StaleInventory != nil {
+		fmt.Printf("%sBased on stale inventory from %s: the Kubernetes API was unavailable%s\n", ColorYellow, m.StaleInventory.Format(time.RFC3339), ColorReset)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// mockFixtures are the canned probe answers read from probes.json in the
+// --mock fixtures directory:
+//
+//	{"interface": "eth0", "hosted": {"node-1": ["7.10.20.5"]}}
+type mockFixtures struct {
+	Interface string              `json:"interface"`
+	Hosted    map[string][]string `json:"hosted"`
+}
+
+// loadMockCluster builds fake Kubernetes clients from the fixtures in dir:
+// nodes.json and services.json (as written by `kubectl get -o json`), an
+// optional pods.json, and probes.json with the canned probe answers.
+func loadMockCluster(dir string) (*mockFixtures, kubernetes.Interface, dynamic.Interface, error) {
+	var objects []runtime.Object
+
+	var nodes corev1.NodeList
+	if err := readFixture(dir, "nodes.json", &nodes, true); err != nil {
+		return nil, nil, nil, err
+	}
+	for i := range nodes.Items {
+		objects = append(objects, &nodes.Items[i])
+	}
+
+	var services corev1.ServiceList
+	if err := readFixture(dir, "services.json", &services, true); err != nil {
+		return nil, nil, nil, err
+	}
+	for i := range services.Items {
+		objects = append(objects, &services.Items[i])
+	}
+
+	var pods corev1.PodList
+	if err := readFixture(dir, "pods.json", &pods, false); err != nil {
+		return nil, nil, nil, err
+	}
+	for i := range pods.Items {
+		objects = append(objects, &pods.Items[i])
+	}
+
+	var fixtures mockFixtures
+	if err := readFixture(dir, "probes.json", &fixtures, true); err != nil {
+		return nil, nil, nil, err
+	}
+	if fixtures.Interface == "" {
+		fixtures.Interface = "mock0"
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		gatewayResource:          "GatewayList",
+		ipAddressPoolResource:    "IPAddressPoolList",
+		ciliumPoolResource:       "CiliumLoadBalancerIPPoolList",
+		bgpAdvertisementResource: "BGPAdvertisementList",
+		l2AdvertisementResource:  "L2AdvertisementList",
+	})
+	return &fixtures, fake.NewSimpleClientset(objects...), dynamicClient, nil
+}
+
+// readFixture decodes the JSON fixture name in dir into v. Missing optional
+// fixtures are skipped.
+func readFixture(dir, name string, v interface{}, required bool) error {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading fixture: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parsing fixture %s: %v", name, err)
+	}
+	return nil
+}
+
+// mockProber answers probes from the canned fixtures
+type mockProber struct {
+	hosted map[string][]string
+}
+
+func (p mockProber) Probe(ctx context.Context, node, iface, ip string) ProbeResult {
+	for _, hostedIP := range p.hosted[node] {
+		if hostedIP == ip {
+			return ProbeResult{Hosted: true, Detail: "mock"}
+		}
+	}
+	return ProbeResult{}
+}
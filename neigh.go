@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// neighEntry is a single entry of `ip -json neigh` output
+type neighEntry struct {
+	Dst    string   `json:"dst"`
+	Dev    string   `json:"dev"`
+	LLAddr string   `json:"lladdr"`
+	State  []string `json:"state"`
+}
+
+// runNeighLookupOnAllNodes resolves LB IP ownership from the neighbor caches
+// the nodes already hold, without sending any ARP traffic. An IP is owned by
+// the node whose interface MAC the other nodes have cached for it. The cached
+// MAC of every LB IP is returned as well, including those no node owns.
+func runNeighLookupOnAllNodes(arpInterface string, lbIPs []string, ansibleUsername string) ([][]string, map[string]string, error) {
+	var hostingNodes [][]string
+	responders := make(map[string]string)
+
+	// Learn the MAC address of the ARP interface on every node
+	nodeMACs, err := getNodeMACAddresses(arpInterface, ansibleUsername)
+	if err != nil {
+		return hostingNodes, responders, err
+	}
+
+	// Dump the neighbor table of every node
+	cmd := exec.Command(ansiblePath, ansibleShellArgs("k8s", ansibleUsername, neighCommand(arpInterface))...)
+	out, _ := runCommand(cmd)
+
+	sightings := make(map[string][]neighSighting)
+	for node, output := range parseAnsibleOutput(string(out)) {
+		entries, err := parseNeighEntries(output)
+		if err != nil {
+			continue
+		}
+		for ip, entry := range entries {
+			sightings[ip] = append(sightings[ip], neighSighting{node: node, entry: entry})
+		}
+	}
+	if len(sightings) == 0 {
+		return hostingNodes, responders, fmt.Errorf("no usable neighbor entries found on any node")
+	}
+
+	// Match each LB IP to the node owning the cached MAC
+	for _, ip := range lbIPs {
+		if len(sightings[ip]) == 0 {
+			continue
+		}
+		mac, conflict := resolveNeighSightings(sightings[ip])
+		if conflict != nil {
+			recordError("reading neighbor tables", ip, conflict)
+		}
+		responders[ip] = mac
+		if node, ok := nodeMACs[mac]; ok {
+			hostingNodes = append(hostingNodes, []string{node, ip})
+		}
+	}
+
+	return hostingNodes, responders, nil
+}
+
+// neighSighting is the neighbor entry one node holds for an IP
+type neighSighting struct {
+	node  string
+	entry neighEntry
+}
+
+// resolveNeighSightings picks the MAC of an IP from what the nodes have
+// cached: the most recently confirmed state wins, then the MAC most nodes
+// agree on. When nodes disagree, an error listing every sighting is returned
+// along with the chosen MAC.
+func resolveNeighSightings(sightings []neighSighting) (string, error) {
+	rank := make(map[string]int)
+	votes := make(map[string]int)
+	for _, s := range sightings {
+		mac := s.entry.LLAddr
+		votes[mac]++
+		if r := neighStateRank(s.entry); r > rank[mac] {
+			rank[mac] = r
+		}
+	}
+	var best string
+	for mac := range votes {
+		if best == "" || rank[mac] > rank[best] ||
+			rank[mac] == rank[best] && (votes[mac] > votes[best] || votes[mac] == votes[best] && mac < best) {
+			best = mac
+		}
+	}
+	if len(votes) == 1 {
+		return best, nil
+	}
+
+	var seen []string
+	for _, s := range sightings {
+		sighting := s.node + " has " + s.entry.LLAddr
+		if len(s.entry.State) > 0 {
+			sighting += " (" + strings.Join(s.entry.State, ",") + ")"
+		}
+		seen = append(seen, sighting)
+	}
+	sort.Strings(seen)
+	return best, fmt.Errorf("nodes disagree on the MAC, using %s: %s", best, strings.Join(seen, "; "))
+}
+
+// neighStateRank orders neighbor states by how recently the entry was
+// confirmed, so a REACHABLE entry outweighs a STALE one
+func neighStateRank(entry neighEntry) int {
+	switch {
+	case hasNeighState(entry, "PERMANENT", "REACHABLE"):
+		return 2
+	case hasNeighState(entry, "DELAY", "PROBE"):
+		return 1
+	}
+	return 0
+}
+
+// parseNeighJSON converts `ip -json neigh` output into a map of IP to MAC,
+// ignoring entries that have no link-layer address or failed resolution.
+func parseNeighJSON(out string) (map[string]string, error) {
+	entries, err := parseNeighEntries(out)
+	if err != nil {
+		return nil, err
+	}
+	table := make(map[string]string)
+	for ip, entry := range entries {
+		table[ip] = entry.LLAddr
+	}
+	return table, nil
+}
+
+// parseNeighEntries is parseNeighJSON keeping the whole entry of each IP,
+// with its MAC normalized.
+func parseNeighEntries(out string) (map[string]neighEntry, error) {
+	var entries []neighEntry
+	if err := json.Unmarshal([]byte(out), &entries); err != nil {
+		return nil, err
+	}
+
+	table := make(map[string]neighEntry)
+	for _, entry := range entries {
+		if entry.LLAddr == "" || hasNeighState(entry, "FAILED", "INCOMPLETE") {
+			continue
+		}
+		if mac := normalizeMAC(entry.LLAddr); mac != "" {
+			entry.LLAddr = mac
+			table[entry.Dst] = entry
+		}
+	}
+	return table, nil
+}
+
+// hasNeighState reports whether the entry is in any of the given states
+func hasNeighState(entry neighEntry, states ...string) bool {
+	for _, s := range entry.State {
+		for _, want := range states {
+			if s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
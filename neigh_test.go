@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNeighJSON(t *testing.T) {
+	out := `[
+		{"dst":"7.10.20.5","dev":"eth0","lladdr":"52:54:00:AA:BB:01","state":["REACHABLE"]},
+		{"dst":"7.10.20.6","dev":"eth0","lladdr":"52:54:00:aa:bb:02","state":["STALE"]},
+		{"dst":"7.10.20.7","dev":"eth0","state":["FAILED"]},
+		{"dst":"7.10.20.8","dev":"eth0","lladdr":"52:54:00:aa:bb:03","state":["INCOMPLETE"]},
+		{"dst":"7.10.20.9","dev":"eth0","lladdr":"not-a-mac","state":["REACHABLE"]}
+	]`
+	want := map[string]string{"7.10.20.5": "52:54:00:aa:bb:01", "7.10.20.6": "52:54:00:aa:bb:02"}
+	got, err := parseNeighJSON(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNeighJSON() = %v, want %v", got, want)
+	}
+
+	if _, err := parseNeighJSON("7.10.20.5 dev eth0 lladdr 52:54:00:aa:bb:01 REACHABLE"); err == nil {
+		t.Error("parseNeighJSON() of plain ip neigh output succeeded, want an error")
+	}
+}
+
+func TestResolveNeighSightings(t *testing.T) {
+	sighting := func(node, mac string, state ...string) neighSighting {
+		return neighSighting{node: node, entry: neighEntry{LLAddr: mac, State: state}}
+	}
+	macA, macB := "52:54:00:aa:bb:01", "52:54:00:aa:bb:02"
+	tests := []struct {
+		name      string
+		sightings []neighSighting
+		want      string
+		conflict  bool
+	}{
+		{name: "one node", sightings: []neighSighting{sighting("node-1", macA, "STALE")}, want: macA},
+		{name: "nodes agree", sightings: []neighSighting{sighting("node-1", macA, "STALE"), sighting("node-2", macA, "REACHABLE")}, want: macA},
+		{
+			name:      "reachable beats stale",
+			sightings: []neighSighting{sighting("node-1", macA, "STALE"), sighting("node-2", macA, "STALE"), sighting("node-3", macB, "REACHABLE")},
+			want:      macB,
+			conflict:  true,
+		},
+		{
+			name:      "majority among equal states",
+			sightings: []neighSighting{sighting("node-1", macB, "STALE"), sighting("node-2", macA, "STALE"), sighting("node-3", macB, "STALE")},
+			want:      macB,
+			conflict:  true,
+		},
+		{
+			name:      "ties pick the same MAC every time",
+			sightings: []neighSighting{sighting("node-1", macB, "DELAY"), sighting("node-2", macA, "PROBE")},
+			want:      macA,
+			conflict:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveNeighSightings(tt.sightings)
+			if got != tt.want || (err != nil) != tt.conflict {
+				t.Errorf("resolveNeighSightings() = %s, %v, want %s, conflict %t", got, err, tt.want, tt.conflict)
+			}
+		})
+	}
+}
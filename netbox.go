@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// netboxTimeout bounds each NetBox API request
+	netboxTimeout = 10 * time.Second
+
+	// netboxClusterField and netboxNodeField are the IP address custom
+	// fields holding the owning cluster and, with --netbox-push, the node
+	// last seen hosting the IP
+	netboxClusterField = "k8s_cluster"
+	netboxNodeField    = "k8s_node"
+)
+
+// netboxClient talks to the NetBox REST API with a token from NETBOX_TOKEN
+type netboxClient struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+// netboxIPAddress is the part of a NetBox IP address record we use
+type netboxIPAddress struct {
+	ID           int                    `json:"id"`
+	Address      string                 `json:"address"`
+	CustomFields map[string]interface{} `json:"custom_fields"`
+}
+
+// netboxPrefix is the part of a NetBox prefix record we use
+type netboxPrefix struct {
+	Prefix string `json:"prefix"`
+	Depth  int    `json:"_depth"`
+}
+
+// netboxCheck is the outcome of looking up one LB IP in NetBox. Status is ok,
+// unregistered, no prefix or wrong cluster.
+type netboxCheck struct {
+	IP      string
+	Prefix  string
+	Cluster string
+	Status  string
+}
+
+func newNetboxClient(addr string) (*netboxClient, error) {
+	token := os.Getenv("NETBOX_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("no NetBox token: set NETBOX_TOKEN")
+	}
+	return &netboxClient{url: strings.TrimSuffix(addr, "/"), token: token, http: &http.Client{Timeout: netboxTimeout}}, nil
+}
+
+// do sends a request to path under /api and decodes the response into out
+func (c *netboxClient) do(method, path string, body, out interface{}) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.url+"/api/"+path, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// lookupIP returns the NetBox record of ip, or nil if it isn't registered
+func (c *netboxClient) lookupIP(ip string) (*netboxIPAddress, error) {
+	var list struct {
+		Results []netboxIPAddress `json:"results"`
+	}
+	if err := c.do("GET", "ipam/ip-addresses/?address="+url.QueryEscape(ip), nil, &list); err != nil {
+		return nil, err
+	}
+	if len(list.Results) == 0 {
+		return nil, nil
+	}
+	return &list.Results[0], nil
+}
+
+// containingPrefix returns the most specific NetBox prefix containing ip
+func (c *netboxClient) containingPrefix(ip string) (string, error) {
+	var list struct {
+		Results []netboxPrefix `json:"results"`
+	}
+	if err := c.do("GET", "ipam/prefixes/?contains="+url.QueryEscape(ip), nil, &list); err != nil {
+		return "", err
+	}
+	var best netboxPrefix
+	for _, prefix := range list.Results {
+		if best.Prefix == "" || prefix.Depth > best.Depth {
+			best = prefix
+		}
+	}
+	return best.Prefix, nil
+}
+
+// setNode records node as the host of the IP address record id
+func (c *netboxClient) setNode(id int, node string) error {
+	body := map[string]interface{}{"custom_fields": map[string]string{netboxNodeField: node}}
+	return c.do("PATCH", fmt.Sprintf("ipam/ip-addresses/%d/", id), body, nil)
+}
+
+// checkNetBox confirms every target is registered in NetBox, inside a
+// NetBox prefix and, when cluster is set, assigned to that cluster through
+// the k8s_cluster custom field. With push, the hosting node found for each
+// registered IP is written back to its k8s_node custom field.
+func checkNetBox(client *netboxClient, targets *ipSet, hostingNodes [][]string, cluster string, push bool) []netboxCheck {
+	hosts := make(map[string][]string)
+	for _, row := range hostingNodes {
+		hosts[row[1]] = append(hosts[row[1]], row[0])
+	}
+
+	var checks []netboxCheck
+	for _, ip := range targets.ips {
+		record, err := client.lookupIP(ip)
+		if err != nil {
+			recordError("querying NetBox", ip, apiError{err})
+			continue
+		}
+		check := netboxCheck{IP: ip, Status: "ok"}
+		if record == nil {
+			check.Status = "unregistered"
+			checks = append(checks, check)
+			continue
+		}
+		check.Cluster, _ = record.CustomFields[netboxClusterField].(string)
+		if check.Prefix, err = client.containingPrefix(ip); err != nil {
+			recordError("querying NetBox", ip, apiError{err})
+		} else if check.Prefix == "" {
+			check.Status = "no prefix"
+		}
+		if cluster != "" && check.Cluster != cluster {
+			check.Status = "wrong cluster"
+		}
+		checks = append(checks, check)
+
+		if push && len(hosts[ip]) > 0 {
+			if err := client.setNode(record.ID, strings.Join(hosts[ip], ",")); err != nil {
+				recordError("updating NetBox", ip, apiError{err})
+			}
+		}
+	}
+	return checks
+}
+
+// printNetBoxChecks prints the NetBox cross-check of the table report
+func printNetBoxChecks(checks []netboxCheck) {
+	if len(checks) == 0 {
+		return
+	}
+	fmt.Println("\nNetBox IPAM:")
+	table := newTable(os.Stdout)
+	table.SetHeader([]string{"LB IP", "Prefix", "Cluster", "Status"})
+	for _, check := range checks {
+		status := check.Status
+		if status != "ok" {
+			status = ColorRed + status + ColorReset
+		}
+		table.Append([]string{check.IP, check.Prefix, check.Cluster, status})
+	}
+	table.Render()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// nodeFilter selects nodes by name or glob pattern for --include-nodes and
+// --exclude-nodes
+type nodeFilter struct {
+	include []string
+	exclude []string
+}
+
+// newNodeFilter parses comma-separated include and exclude lists
+func newNodeFilter(include, exclude string) (nodeFilter, error) {
+	var filter nodeFilter
+	var err error
+	if filter.include, err = parsePatterns(include); err != nil {
+		return filter, err
+	}
+	filter.exclude, err = parsePatterns(exclude)
+	return filter, err
+}
+
+func parsePatterns(list string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(list, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// apply returns the nodes matching an include pattern, if any are set, and
+// no exclude pattern
+func (f nodeFilter) apply(nodes []string) []string {
+	var selected []string
+	for _, node := range nodes {
+		if len(f.include) > 0 && !matchesAny(f.include, node) {
+			continue
+		}
+		if matchesAny(f.exclude, node) {
+			continue
+		}
+		selected = append(selected, node)
+	}
+	return selected
+}
+
+func matchesAny(patterns []string, node string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, node); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"sync"
+)
+
+// nodeRefresher re-resolves the nodes to probe from the node informer at the
+// start of each daemon cycle, so nodes added by the cluster autoscaler are
+// probed and deleted ones no longer are. Nodes that get a maintenance taint
+// drop out the same way. The generated inventory is rewritten whenever the
+// set changes.
+type nodeRefresher struct {
+	cache               *clusterCache
+	addressType         string
+	selection           nodeFilter
+	excludeControlPlane bool
+	skipTaints          []string
+	// ansibleUsername is set when the generated inventory must follow along
+	ansibleUsername string
+	writeInventory  bool
+
+	mu          sync.Mutex
+	nodes       []string
+	addresses   map[string]string
+	maintenance map[string]string
+}
+
+// current returns the nodes to probe and their addresses. When the cache has
+// no nodes left after filtering, e.g. while it is resyncing, the last set is
+// kept.
+func (r *nodeRefresher) current() ([]string, map[string]string) {
+	nodes, addresses, roles := r.cache.listNodes(r.addressType)
+	nodes = r.selection.apply(nodes)
+	if r.excludeControlPlane {
+		nodes = workerNodes(nodes, roles)
+	}
+	var maintenance map[string]string
+	if len(r.skipTaints) > 0 {
+		tainted, _ := getMaintenanceNodes(nil, r.cache, r.skipTaints)
+		nodes, maintenance = skipMaintenance(nodes, tainted)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(nodes) == 0 {
+		logf("no nodes to probe in the node cache, keeping the previous %d", len(r.nodes))
+		return r.nodes, r.addresses
+	}
+	r.maintenance = maintenance
+	if added, removed := diffNodes(r.nodes, nodes); len(added) > 0 || len(removed) > 0 {
+		logf("node set changed: added [%s], removed [%s]", strings.Join(added, ", "), strings.Join(removed, ", "))
+		if r.writeInventory {
+			if err := replaceInventoryFile(nodes, addresses, roles, r.ansibleUsername); err != nil {
+				recordError("rewriting inventory file", "", backendError{err})
+			}
+		}
+	}
+	r.nodes, r.addresses = nodes, addresses
+	return nodes, addresses
+}
+
+// inMaintenance returns the nodes the last current left out for a
+// maintenance taint
+func (r *nodeRefresher) inMaintenance() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.maintenance
+}
+
+// dropDeleted returns the unreachable nodes that still exist. A node deleted
+// while the cycle probed it was scaled away, not down.
+func (r *nodeRefresher) dropDeleted(unreachable []string) []string {
+	var remaining []string
+	for _, node := range unreachable {
+		if _, exists, _ := r.cache.nodes.GetByKey(node); !exists {
+			logf("node %s was deleted during the cycle, not counting it as unreachable", node)
+			continue
+		}
+		remaining = append(remaining, node)
+	}
+	return remaining
+}
+
+// diffNodes returns the nodes in current but not in previous, and those in
+// previous but not in current
+func diffNodes(previous, current []string) ([]string, []string) {
+	var added, removed []string
+	for _, node := range current {
+		if !containsString(previous, node) {
+			added = append(added, node)
+		}
+	}
+	for _, node := range previous {
+		if !containsString(current, node) {
+			removed = append(removed, node)
+		}
+	}
+	return added, removed
+}
+
+// replaceInventoryFile rewrites the inventory through a rename, so Ansible
+// runs in flight never read a half-written file
+func replaceInventoryFile(nodes []string, addresses, roles map[string]string, ansibleUsername string) error {
+	tmp := inventoryFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(inventoryContent(nodes, addresses, roles, ansibleUsername)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, inventoryFile)
+}
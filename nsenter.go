@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// nsenterProberPath is where the static prober is copied in the pod
+	nsenterProberPath = "/lbip-prober"
+	// nsenterPodTimeout bounds how long a probe pod may take to start
+	nsenterPodTimeout = 2 * time.Minute
+	// runIDLabel carries the ID of the run that started a probe pod, so pods
+	// left behind by a killed run can be found and removed with
+	// kubectl delete pod -l lbip.haribhusal.io/run-id=<id>
+	runIDLabel = "lbip.haribhusal.io/run-id"
+)
+
+// nsenterProber probes from a privileged pod on each node, for immutable
+// OSes like Flatcar or Bottlerocket that have no arping. The pod shares the
+// host PID namespace, so nsenter can enter the network namespace of PID 1
+// and run a statically linked arping-compatible prober copied in from the
+// operator machine. Pods are started on first use and removed by Close.
+type nsenterProber struct {
+	clientset  kubernetes.Interface
+	kubeconfig string
+	namespace  string
+	image      string
+	binary     string
+
+	// pods are the ready pods of each node and created every pod started,
+	// ready or not, for Close. nodeLocks let pods start on all nodes at once
+	// while only one starts per node.
+	mu        sync.Mutex
+	pods      map[string]string
+	created   map[string]string
+	nodeLocks map[string]*sync.Mutex
+}
+
+func newNsenterProber(clientset kubernetes.Interface, kubeconfig, namespace, image, binary string) *nsenterProber {
+	return &nsenterProber{clientset: clientset, kubeconfig: kubeconfig, namespace: namespace, image: image, binary: binary, pods: make(map[string]string), created: make(map[string]string), nodeLocks: make(map[string]*sync.Mutex)}
+}
+
+func (p *nsenterProber) Probe(ctx context.Context, node, iface, ip string) ProbeResult {
+	pod, err := p.podFor(ctx, node)
+	if err != nil {
+		return ProbeResult{Err: err}
+	}
+	out, err := runNamedCommand(node+"_"+ip, exec.CommandContext(ctx, "kubectl", p.execArgs(pod, nsenterProberPath, "-q", "-I", iface, ip, "-c", "1")...))
+	if err == nil {
+		return ProbeResult{}
+	}
+	// The prober exits 1 when nothing answers, which means the node holds the IP
+	if strings.Contains(string(out), "command terminated with exit code 1") {
+		return ProbeResult{Hosted: true}
+	}
+	return ProbeResult{Err: fmt.Errorf("probing from pod %s: %v: %s", pod, err, strings.TrimSpace(string(out)))}
+}
+
+func (p *nsenterProber) detectInterface(ctx context.Context, nodes []string) string {
+	pod, err := p.podFor(ctx, detectionNode(nodes))
+	if err == nil {
+		var out []byte
+		out, err = runCommand(exec.CommandContext(ctx, "kubectl", p.execArgs(pod, "sh", "-c", interfaceDetectionCommand)...))
+		if err == nil {
+			return parseInterfaceDetection(string(out))
+		}
+	}
+	logf("error detecting interface from a probe pod: %v", err)
+	fmt.Printf("%sError detecting interface from a probe pod: %v%s\n", ColorRed, err, ColorReset)
+	return ""
+}
+
+func (p *nsenterProber) commandLine(node, command string) string {
+	fields := strings.Fields(command)
+	if len(fields) > 0 && fields[0] == "arping" {
+		fields[0] = nsenterProberPath
+	} else {
+		fields = []string{"sh", "-c", command}
+	}
+	return shellJoin("kubectl", p.execArgs(fmt.Sprintf("<probe pod on %s>", node), fields...)...)
+}
+
+// execArgs returns the kubectl arguments that run command in the host network
+// namespace from pod
+func (p *nsenterProber) execArgs(pod string, command ...string) []string {
+	args := append(kubectlConfigArgs(p.kubeconfig), "-n", p.namespace, "exec", pod, "--", "nsenter", "-t", "1", "-n", "--")
+	return append(args, command...)
+}
+
+// podFor returns the probe pod on node, starting it and copying the prober in
+// on first use. A pod that fails to get ready is deleted, so the next probe
+// starts over.
+func (p *nsenterProber) podFor(ctx context.Context, node string) (string, error) {
+	p.mu.Lock()
+	if pod, ok := p.pods[node]; ok {
+		p.mu.Unlock()
+		return pod, nil
+	}
+	nodeLock, ok := p.nodeLocks[node]
+	if !ok {
+		nodeLock = &sync.Mutex{}
+		p.nodeLocks[node] = nodeLock
+	}
+	p.mu.Unlock()
+
+	nodeLock.Lock()
+	defer nodeLock.Unlock()
+	p.mu.Lock()
+	pod, ok := p.pods[node]
+	p.mu.Unlock()
+	if ok {
+		return pod, nil
+	}
+
+	pod, err := p.startPod(ctx, node)
+	if err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	p.pods[node] = pod
+	p.mu.Unlock()
+	return pod, nil
+}
+
+// startPod starts a probe pod on node and copies the prober in
+func (p *nsenterProber) startPod(ctx context.Context, node string) (string, error) {
+	privileged := true
+	pod, err := p.clientset.CoreV1().Pods(p.namespace).Create(ctx, &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			GenerateName: "lbip-probe-",
+			Labels:       map[string]string{"app.kubernetes.io/name": "get-loadbalancer-ip-probe", runIDLabel: currentRun().RunID},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:      node,
+			HostPID:       true,
+			RestartPolicy: corev1.RestartPolicyNever,
+			Tolerations:   []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Containers: []corev1.Container{{
+				Name:            "probe",
+				Image:           p.image,
+				Command:         []string{"sleep", "3600"},
+				SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+			}},
+		},
+	}, v1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("creating probe pod on %s: %v", node, err)
+	}
+	p.mu.Lock()
+	p.created[node] = pod.Name
+	p.mu.Unlock()
+	logf("started probe pod %s on %s for run %s", pod.Name, node, pod.Labels[runIDLabel])
+
+	if err := p.preparePod(ctx, node, pod.Name); err != nil {
+		p.deletePod(node, pod.Name)
+		return "", err
+	}
+	return pod.Name, nil
+}
+
+// preparePod waits for pod to run and copies the prober in
+func (p *nsenterProber) preparePod(ctx context.Context, node, pod string) error {
+	deadline := time.Now().Add(nsenterPodTimeout)
+	for {
+		current, err := p.clientset.CoreV1().Pods(p.namespace).Get(ctx, pod, v1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("waiting for probe pod %s: %v", pod, err)
+		}
+		if current.Status.Phase == corev1.PodRunning {
+			break
+		}
+		if current.Status.Phase == corev1.PodFailed || time.Now().After(deadline) {
+			return fmt.Errorf("probe pod %s on %s did not start (phase %s)", pod, node, current.Status.Phase)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for probe pod %s: %v", pod, ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+
+	out, err := runCommand(exec.CommandContext(ctx, "kubectl", append(kubectlConfigArgs(p.kubeconfig), "-n", p.namespace, "cp", p.binary, pod+":"+nsenterProberPath)...))
+	if err != nil {
+		return fmt.Errorf("copying prober to pod %s: %v: %s", pod, err, strings.TrimSpace(string(out)))
+	}
+	out, err = runCommand(exec.CommandContext(ctx, "kubectl", append(kubectlConfigArgs(p.kubeconfig), "-n", p.namespace, "exec", pod, "--", "chmod", "+x", nsenterProberPath)...))
+	if err != nil {
+		return fmt.Errorf("making prober executable in pod %s: %v: %s", pod, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// deletePod deletes the probe pod on node and forgets it
+func (p *nsenterProber) deletePod(node, pod string) {
+	if err := p.clientset.CoreV1().Pods(p.namespace).Delete(context.TODO(), pod, v1.DeleteOptions{}); err != nil {
+		recordError("deleting probe pod "+pod, node, apiError{err})
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.created, node)
+	delete(p.pods, node)
+}
+
+// Close deletes every probe pod started, ready or not
+func (p *nsenterProber) Close() {
+	p.mu.Lock()
+	created := make(map[string]string, len(p.created))
+	for node, pod := range p.created {
+		created[node] = pod
+	}
+	p.mu.Unlock()
+	for node, pod := range created {
+		p.deletePod(node, pod)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// embeddedOUIs is a short list of vendors commonly seen on LB segments
+//
+//go:embed oui.txt
+var embeddedOUIs string
+
+// ouiVendors maps upper-case OUIs like 00:50:56 to their vendor
+var ouiVendors = parseOUIs(embeddedOUIs)
+
+// parseOUIs reads the "(hex)" lines of an IEEE oui.txt registry
+func parseOUIs(data string) map[string]string {
+	vendors := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		prefix, vendor, ok := strings.Cut(scanner.Text(), "(hex)")
+		if !ok {
+			continue
+		}
+		prefix = strings.ReplaceAll(strings.TrimSpace(prefix), "-", ":")
+		if len(prefix) == 8 {
+			vendors[strings.ToUpper(prefix)] = strings.TrimSpace(vendor)
+		}
+	}
+	return vendors
+}
+
+// loadOUIFile replaces the embedded vendor list with a full IEEE registry
+func loadOUIFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	ouiVendors = parseOUIs(string(data))
+	return nil
+}
+
+// macVendor returns the vendor owning mac's OUI. Locally administered
+// addresses, as used by VMs, containers and many VIP daemons, have none.
+func macVendor(mac string) string {
+	mac = normalizeMAC(mac)
+	if mac == "" {
+		return ""
+	}
+	if vendor, ok := ouiVendors[strings.ToUpper(mac[:8])]; ok {
+		return vendor
+	}
+	if first, err := strconv.ParseUint(mac[:2], 16, 8); err == nil && first&0x02 != 0 {
+		return "locally administered"
+	}
+	return "unknown"
+}
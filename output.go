@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// outputManager serializes everything written while probing. The progress
+// UI goes to stderr and the report to stdout, so redirecting stdout captures
+// only results, and a single lock keeps the bar's redraws from landing in the
+// middle of a result line.
+type outputManager struct {
+	mu     sync.Mutex
+	ui     io.Writer
+	report io.Writer
+}
+
+var output = &outputManager{ui: os.Stderr, report: os.Stdout}
+
+// UI writes s to the progress stream
+func (o *outputManager) UI(s string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	io.WriteString(o.ui, s)
+}
+
+// Report writes s to the report stream
+func (o *outputManager) Report(s string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	io.WriteString(o.report, s)
+}
+
+// ReportBetween writes line to the report stream between two UI writes
+// without any other write in between, e.g. to clear and redraw the bar
+// around a streamed result
+func (o *outputManager) ReportBetween(before, line, after string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	io.WriteString(o.ui, before)
+	io.WriteString(o.report, line)
+	io.WriteString(o.ui, after)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// probePacer spaces out probes so a run doesn't trip the ARP rate limits of
+// the switches on the segment. A global token bucket caps the probes per
+// second of the whole run and a bucket per node caps each node, and every
+// probe is delayed by a random jitter so nodes don't fire in lockstep.
+type probePacer struct {
+	global  *rate.Limiter
+	perNode rate.Limit
+
+	mu    sync.Mutex
+	nodes map[string]*rate.Limiter
+}
+
+// newProbePacer returns a pacer for the given probes per second, globally and
+// per node, where 0 means unlimited. It returns nil when both are unlimited.
+func newProbePacer(global, perNode float64) *probePacer {
+	if global <= 0 && perNode <= 0 {
+		return nil
+	}
+	p := &probePacer{nodes: make(map[string]*rate.Limiter)}
+	if global > 0 {
+		p.global = rate.NewLimiter(rate.Limit(global), 1)
+	}
+	if perNode > 0 {
+		p.perNode = rate.Limit(perNode)
+	}
+	return p
+}
+
+// wait blocks until node may send its next probe, or ctx is done
+func (p *probePacer) wait(ctx context.Context, node string) error {
+	if p == nil {
+		return nil
+	}
+	if p.perNode > 0 {
+		p.mu.Lock()
+		limiter, ok := p.nodes[node]
+		if !ok {
+			limiter = rate.NewLimiter(p.perNode, 1)
+			p.nodes[node] = limiter
+		}
+		p.mu.Unlock()
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if p.global != nil {
+		if err := p.global.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Jitter by up to half the interval of the slower limit
+	limit := p.perNode
+	if p.global != nil && (limit == 0 || p.global.Limit() < limit) {
+		limit = p.global.Limit()
+	}
+	jitter := time.Duration(rand.Int63n(int64(float64(time.Second)/float64(limit)/2) + 1))
+	select {
+	case <-time.After(jitter):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
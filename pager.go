@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+
+	"golang.org/x/term"
+)
+
+// defaultPager is used when $PAGER is unset; -R keeps the colors
+const defaultPager = "less -R"
+
+// reportPager holds back the final report while it is printed, and shows it
+// through $PAGER if it turns out taller than the terminal. A nil
+// reportPager leaves stdout alone.
+type reportPager struct {
+	stdout *os.File
+	pipe   *os.File
+	buf    bytes.Buffer
+	copied chan struct{}
+}
+
+// startPager captures stdout until finish when it is a terminal. With
+// disabled set, or when stdout is redirected, nil is returned.
+func startPager(disabled bool) *reportPager {
+	if disabled || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		logf("error starting pager: %v", err)
+		return nil
+	}
+	p := &reportPager{stdout: os.Stdout, pipe: w, copied: make(chan struct{})}
+	go func() {
+		io.Copy(&p.buf, r)
+		r.Close()
+		close(p.copied)
+	}()
+	os.Stdout = w
+	return p
+}
+
+// finish restores stdout and shows the captured report, through the pager
+// if it doesn't fit the terminal. If the pager can't be run the report is
+// printed as is.
+func (p *reportPager) finish() {
+	if p == nil {
+		return
+	}
+	os.Stdout = p.stdout
+	p.pipe.Close()
+	<-p.copied
+
+	_, height, err := term.GetSize(int(p.stdout.Fd()))
+	if err != nil || bytes.Count(p.buf.Bytes(), []byte("\n")) < height {
+		p.stdout.Write(p.buf.Bytes())
+		return
+	}
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = defaultPager
+	}
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = bytes.NewReader(p.buf.Bytes()), p.stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		logf("error running pager %q: %v", pager, err)
+		p.stdout.Write(p.buf.Bytes())
+	}
+}
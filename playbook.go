@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// playbookTemplate runs the same logic as the ansible backend: detect the
+// interface of the routes starting with '7' and the arping flavor of each
+// node, then arping every LB IP from every node. A node cannot arping an
+// address it holds itself, so an arping without reply means the node hosts
+// the IP. Any other arping failure fails the task.
+const playbookTemplate = `# Generated by get_loadBalancerIP
+- name: Find the nodes hosting LoadBalancer IPs
+  hosts: %s
+  gather_facts: false
+  vars:
+    lb_ips: %s
+    lb_arping_commands: %s
+  tasks:
+    - name: Detect the interface of the routes starting with '7'
+      shell: %s
+      register: lb_route
+      changed_when: false
+      run_once: true
+
+    - name: Set the ARP interface
+      set_fact:
+        lb_interface: "{{ lb_route.stdout_lines[1] | default(lb_route.stdout_lines[0]) }}"
+
+    - name: Detect the arping flavor
+      shell: %s
+      register: lb_arping_banner
+      changed_when: false
+
+    # busybox exits 0 without a reply; iputils and Habets arping exit 1
+    - name: Set the arping flavor
+      set_fact:
+        lb_arping_flavor: "{{ 'busybox' if 'BusyBox' in lb_arping_banner.stdout else 'habets' if ('Habets' in lb_arping_banner.stdout or 'ARPing' in lb_arping_banner.stdout) else 'iputils' }}"
+
+    - name: Arping every LoadBalancer IP
+      shell: "{{ lb_arping_commands[lb_arping_flavor] }}"
+      loop: "{{ lb_ips }}"
+      register: lb_arping
+      changed_when: false
+      failed_when: "(lb_arping.rc != 0) if lb_arping_flavor == 'busybox' else (lb_arping.rc not in [0, 1])"
+
+    - name: Report the LoadBalancer IPs hosted on this node
+      debug:
+        msg: "{{ inventory_hostname }} hosts {{ item.item }}"
+      loop: "{{ lb_arping.results }}"
+      loop_control:
+        label: "{{ item.item }}"
+      when: "('Received 0 response' in item.stdout) if lb_arping_flavor == 'busybox' else (item.rc == 1)"
+`
+
+// writePlaybook writes a playbook that probes lbIPs from nodes, for running
+// the probe through AWX/Tower instead of ad-hoc commands.
+func writePlaybook(path string, nodes, lbIPs []string) error {
+	hosts, err := json.Marshal(strings.Join(nodes, ","))
+	if err != nil {
+		return err
+	}
+	ips, err := json.Marshal(lbIPs)
+	if err != nil {
+		return err
+	}
+	// The commands of every flavor, templated per node and IP by Ansible
+	commands := make(map[string]string)
+	for _, flavor := range []arpingFlavor{arpingIputils, arpingBusybox, arpingHabets} {
+		commands[flavor.String()] = flavor.command("{{ lb_interface }}", "{{ item }}")
+	}
+	arpingCommands, err := json.Marshal(commands)
+	if err != nil {
+		return err
+	}
+	detect, err := json.Marshal(interfaceDetectionCommand)
+	if err != nil {
+		return err
+	}
+	flavorDetect, err := json.Marshal(arpingFlavorCommand)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(fmt.Sprintf(playbookTemplate, hosts, ips, arpingCommands, detect, flavorDetect)), 0644)
+}
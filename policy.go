@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// placementPolicy lists the nodes each LB IP is allowed to be hosted on, e.g.
+//
+//	rules:
+//	  - ip: 7.10.20.0/28
+//	    nodes: ["edge-*"]
+//	  - service: ingress-nginx/ingress-nginx-controller
+//	    nodeSelector:
+//	      topology.kubernetes.io/zone: dc1-a
+type placementPolicy struct {
+	Rules []placementRule `json:"rules"`
+}
+
+// placementRule matches an IP, CIDR or range, or a namespace/name service,
+// and allows the nodes named by a glob in Nodes or carrying all the labels
+// of NodeSelector.
+type placementRule struct {
+	IP           string            `json:"ip,omitempty"`
+	Service      string            `json:"service,omitempty"`
+	Nodes        []string          `json:"nodes,omitempty"`
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	ips map[string]bool
+}
+
+// policyViolation is an LB IP found on a node none of its rules allow
+type policyViolation struct {
+	Node string
+	IP   string
+	Rule string
+}
+
+// loadPlacementPolicy reads and validates a policy file
+func loadPlacementPolicy(path string) (*placementPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy placementPolicy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if (rule.IP == "") == (rule.Service == "") {
+			return nil, fmt.Errorf("rule %d must set exactly one of ip or service", i+1)
+		}
+		if len(rule.Nodes) == 0 && len(rule.NodeSelector) == 0 {
+			return nil, fmt.Errorf("rule %d allows no nodes: set nodes or nodeSelector", i+1)
+		}
+		if rule.IP != "" {
+			ips, err := expandIPEntry(rule.IP)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i+1, err)
+			}
+			rule.ips = make(map[string]bool)
+			for _, ip := range ips {
+				rule.ips[ip] = true
+			}
+		}
+	}
+	return &policy, nil
+}
+
+// matches reports whether the rule applies to ip, which the services in
+// targets share
+func (r placementRule) matches(ip string, targets *ipSet) bool {
+	if r.IP != "" {
+		return r.ips[ip]
+	}
+	for _, service := range targets.services[ip] {
+		if strings.SplitN(service, ":", 2)[0] == r.Service {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether the rule allows node, whose labels are given
+func (r placementRule) allows(node string, nodeLabels map[string]string) bool {
+	for _, pattern := range r.Nodes {
+		if ok, _ := path.Match(pattern, node); ok {
+			return true
+		}
+	}
+	return len(r.NodeSelector) > 0 && labels.SelectorFromSet(r.NodeSelector).Matches(labels.Set(nodeLabels))
+}
+
+// describe names the rule in violation reports
+func (r placementRule) describe() string {
+	if r.IP != "" {
+		return "ip " + r.IP
+	}
+	return "service " + r.Service
+}
+
+// checkPlacement returns every hosting node/IP pair that matches a rule but
+// is on a node no matching rule allows. IPs no rule covers may be anywhere.
+func checkPlacement(policy *placementPolicy, hostingNodes [][]string, targets *ipSet, nodeLabels map[string]map[string]string) []policyViolation {
+	var violations []policyViolation
+	for _, row := range hostingNodes {
+		node, ip := row[0], row[1]
+		var matched []string
+		allowed := false
+		for _, rule := range policy.Rules {
+			if !rule.matches(ip, targets) {
+				continue
+			}
+			matched = append(matched, rule.describe())
+			if rule.allows(node, nodeLabels[node]) {
+				allowed = true
+				break
+			}
+		}
+		if len(matched) > 0 && !allowed {
+			violations = append(violations, policyViolation{Node: node, IP: ip, Rule: strings.Join(matched, ", ")})
+		}
+	}
+	return violations
+}
+
+// getNodeLabels returns the labels of every node, for nodeSelector rules
+func getNodeLabels(clientset kubernetes.Interface) (map[string]map[string]string, error) {
+	nodeList, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	nodeLabels := make(map[string]map[string]string)
+	for _, node := range nodeList.Items {
+		nodeLabels[node.Name] = node.Labels
+	}
+	return nodeLabels, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckPlacement(t *testing.T) {
+	edgeRule := placementRule{IP: "7.10.20.0/30", Nodes: []string{"edge-*"}}
+	ips, err := expandIPEntry(edgeRule.IP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edgeRule.ips = make(map[string]bool)
+	for _, ip := range ips {
+		edgeRule.ips[ip] = true
+	}
+	policy := &placementPolicy{Rules: []placementRule{
+		edgeRule,
+		{Service: "ingress/nginx", NodeSelector: map[string]string{"zone": "a"}},
+	}}
+
+	targets := newIPSet()
+	targets.add("7.10.20.9", "LoadBalancer")
+	targets.addService("7.10.20.9", "ingress/nginx:80/TCP,443/TCP")
+	nodeLabels := map[string]map[string]string{
+		"node-a": {"zone": "a"},
+		"node-b": {"zone": "b"},
+	}
+
+	tests := []struct {
+		name string
+		rows [][]string
+		want []policyViolation
+	}{
+		{name: "IP rule allows node glob", rows: [][]string{{"edge-1", "7.10.20.1"}}},
+		{name: "IP rule violated", rows: [][]string{{"core-1", "7.10.20.2"}}, want: []policyViolation{{Node: "core-1", IP: "7.10.20.2", Rule: "ip 7.10.20.0/30"}}},
+		{name: "service rule allows node labels", rows: [][]string{{"node-a", "7.10.20.9"}}},
+		{name: "service rule violated", rows: [][]string{{"node-b", "7.10.20.9"}}, want: []policyViolation{{Node: "node-b", IP: "7.10.20.9", Rule: "service ingress/nginx"}}},
+		{name: "IPs no rule covers may be anywhere", rows: [][]string{{"core-1", "7.10.20.50"}}},
+		{
+			name: "every violation is reported",
+			rows: [][]string{{"edge-1", "7.10.20.1"}, {"core-1", "7.10.20.3"}, {"node-b", "7.10.20.9"}},
+			want: []policyViolation{
+				{Node: "core-1", IP: "7.10.20.3", Rule: "ip 7.10.20.0/30"},
+				{Node: "node-b", IP: "7.10.20.9", Rule: "service ingress/nginx"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkPlacement(policy, tt.rows, targets, nodeLabels); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkPlacement(%v) = %+v, want %+v", tt.rows, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// poolUsage is the utilization of one MetalLB IPAddressPool
+type poolUsage struct {
+	Pool      string   `json:"pool"`
+	Addresses []string `json:"addresses"`
+	Total     uint64   `json:"total"`
+	Used      uint64   `json:"used"`
+	Free      uint64   `json:"free"`
+	Percent   float64  `json:"percent"`
+}
+
+// ipAddressPoolResource is the MetalLB resource holding address pools
+var ipAddressPoolResource = schema.GroupVersionResource{Group: "metallb.io", Version: "v1beta1", Resource: "ipaddresspools"}
+
+// ciliumPoolResource is the Cilium resource holding LB IPAM pools
+var ciliumPoolResource = schema.GroupVersionResource{Group: "cilium.io", Version: "v2alpha1", Resource: "ciliumloadbalancerippools"}
+
+// addressPool is a MetalLB IPAddressPool, named namespace/name, or a
+// cluster-scoped CiliumLoadBalancerIPPool, named by its name
+type addressPool struct {
+	Name      string
+	Addresses []string
+	Labels    map[string]string
+	ranges    []poolRange
+}
+
+// contains reports whether ip lies in one of the pool's ranges
+func (p addressPool) contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, r := range p.ranges {
+		if r.contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// listAddressPools returns the MetalLB and Cilium LB IPAM pools of the
+// cluster. Clusters usually have only one of the two CRDs, so an error is
+// returned only when neither can be listed. Malformed entries are recorded
+// and skipped.
+func listAddressPools(dynamicClient dynamic.Interface) ([]addressPool, error) {
+	var pools []addressPool
+	metallb, metallbErr := dynamicClient.Resource(ipAddressPoolResource).Namespace("").List(context.TODO(), metav1.ListOptions{})
+	if metallbErr == nil {
+		for _, item := range metallb.Items {
+			addresses, _, _ := unstructured.NestedStringSlice(item.Object, "spec", "addresses")
+			pool := newAddressPool(item.GetNamespace()+"/"+item.GetName(), addresses)
+			pool.Labels = item.GetLabels()
+			pools = append(pools, pool)
+		}
+	}
+	cilium, ciliumErr := dynamicClient.Resource(ciliumPoolResource).List(context.TODO(), metav1.ListOptions{})
+	if ciliumErr == nil {
+		for _, item := range cilium.Items {
+			pools = append(pools, newAddressPool(item.GetName(), ciliumPoolAddresses(item)))
+		}
+	}
+	if metallbErr != nil && ciliumErr != nil {
+		return nil, fmt.Errorf("fetching MetalLB IPAddressPools: %v; fetching CiliumLoadBalancerIPPools: %v", metallbErr, ciliumErr)
+	}
+	return pools, nil
+}
+
+// ciliumPoolAddresses returns the spec.blocks of a Cilium pool as CIDRs or
+// ranges, along with the spec.cidrs of older Cilium releases
+func ciliumPoolAddresses(pool unstructured.Unstructured) []string {
+	var addresses []string
+	blocks, _, _ := unstructured.NestedSlice(pool.Object, "spec", "blocks")
+	legacy, _, _ := unstructured.NestedSlice(pool.Object, "spec", "cidrs")
+	for _, block := range append(blocks, legacy...) {
+		entry, ok := block.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		cidr, _ := entry["cidr"].(string)
+		start, _ := entry["start"].(string)
+		stop, _ := entry["stop"].(string)
+		switch {
+		case cidr != "":
+			addresses = append(addresses, cidr)
+		case start != "" && stop != "":
+			addresses = append(addresses, start+"-"+stop)
+		}
+	}
+	return addresses
+}
+
+func newAddressPool(name string, addresses []string) addressPool {
+	pool := addressPool{Name: name, Addresses: addresses}
+	for _, entry := range addresses {
+		r, err := parsePoolRange(entry)
+		if err != nil {
+			recordError("parsing pool", name, err)
+			continue
+		}
+		pool.ranges = append(pool.ranges, r)
+	}
+	return pool
+}
+
+// assignPools records the pool of every target and returns the pools.
+// Targets whose service names its pool in a MetalLB annotation keep that
+// pool. Without pool CRDs the other targets are left without pools. With
+// setAsideBGP the targets of BGP-only MetalLB pools are then set aside from
+// probing.
+func assignPools(dynamicClient dynamic.Interface, targets *ipSet, setAsideBGP bool) []addressPool {
+	pools, err := listAddressPools(dynamicClient)
+	if err != nil {
+		logf("no address pools read: %v", err)
+		return nil
+	}
+	for _, ip := range targets.ips {
+		if _, annotated := targets.pools[ip]; annotated {
+			continue
+		}
+		for _, pool := range pools {
+			if pool.contains(ip) {
+				targets.pools[ip] = pool.Name
+				break
+			}
+		}
+	}
+	if setAsideBGP {
+		setAsideBGPAdvertised(dynamicClient, targets, pools)
+	}
+	return pools
+}
+
+// filterPools keeps only the targets in one of the comma-separated pools,
+// for --pool. Targets with no known pool are dropped.
+func filterPools(targets *ipSet, pools string) {
+	if pools == "" {
+		return
+	}
+	wanted := make(map[string]bool)
+	for _, pool := range strings.Split(pools, ",") {
+		wanted[strings.TrimSpace(pool)] = true
+	}
+	var kept []string
+	for _, ip := range targets.ips {
+		if wanted[targets.pools[ip]] {
+			kept = append(kept, ip)
+		}
+	}
+	targets.ips = kept
+}
+
+// poolRange is one spec.addresses entry of a pool as an inclusive range
+type poolRange struct {
+	start, end netip.Addr
+}
+
+// parsePoolRange parses a CIDR (7.10.20.0/28) or range (7.10.20.5-7.10.20.9)
+// pool entry without expanding it, so large pools can be measured
+func parsePoolRange(entry string) (poolRange, error) {
+	entry = strings.TrimSpace(entry)
+	if start, end, ok := strings.Cut(entry, "-"); ok {
+		first, err := netip.ParseAddr(strings.TrimSpace(start))
+		if err != nil {
+			return poolRange{}, fmt.Errorf("invalid range start in %q: %v", entry, err)
+		}
+		last, err := netip.ParseAddr(strings.TrimSpace(end))
+		if err != nil {
+			return poolRange{}, fmt.Errorf("invalid range end in %q: %v", entry, err)
+		}
+		if first.BitLen() != last.BitLen() || last.Less(first) {
+			return poolRange{}, fmt.Errorf("invalid range %q: end must not be before start", entry)
+		}
+		return poolRange{first, last}, nil
+	}
+	prefix, err := netip.ParsePrefix(entry)
+	if err != nil {
+		return poolRange{}, fmt.Errorf("invalid CIDR %q: %v", entry, err)
+	}
+	prefix = prefix.Masked()
+	last := prefix.Addr()
+	bytes := last.AsSlice()
+	for bit := prefix.Bits(); bit < len(bytes)*8; bit++ {
+		bytes[bit/8] |= 0x80 >> (bit % 8)
+	}
+	last, _ = netip.AddrFromSlice(bytes)
+	return poolRange{prefix.Addr(), last}, nil
+}
+
+// size returns the number of addresses in the range, saturating for huge
+// IPv6 ranges
+func (r poolRange) size() uint64 {
+	a, b := r.start.As16(), r.end.As16()
+	var hiA, hiB, loA, loB uint64
+	for i := 0; i < 8; i++ {
+		hiA, hiB = hiA<<8|uint64(a[i]), hiB<<8|uint64(b[i])
+		loA, loB = loA<<8|uint64(a[i+8]), loB<<8|uint64(b[i+8])
+	}
+	if hiA != hiB || loB-loA == math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return loB - loA + 1
+}
+
+func (r poolRange) contains(addr netip.Addr) bool {
+	return addr.BitLen() == r.start.BitLen() && r.start.Compare(addr) <= 0 && addr.Compare(r.end) <= 0
+}
+
+// getPoolUsage measures every MetalLB and Cilium pool against the addresses
+// allocated to LoadBalancer services. An address is counted once however
+// many services share it.
+func getPoolUsage(clientset kubernetes.Interface, dynamicClient dynamic.Interface) ([]poolUsage, error) {
+	pools, err := listAddressPools(dynamicClient)
+	if err != nil {
+		return nil, err
+	}
+	services, err := clientset.CoreV1().Services("").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("fetching services: %v", err)
+	}
+	allocated := make(map[netip.Addr]bool)
+	for _, service := range services.Items {
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if addr, err := netip.ParseAddr(ingress.IP); err == nil {
+				allocated[addr.Unmap()] = true
+			}
+		}
+	}
+
+	var usage []poolUsage
+	for _, pool := range pools {
+		u := poolUsage{Pool: pool.Name, Addresses: pool.Addresses}
+		for _, r := range pool.ranges {
+			if size := r.size(); u.Total > math.MaxUint64-size {
+				u.Total = math.MaxUint64
+			} else {
+				u.Total += size
+			}
+		}
+		for addr := range allocated {
+			for _, r := range pool.ranges {
+				if r.contains(addr) {
+					u.Used++
+					break
+				}
+			}
+		}
+		u.Free = u.Total - u.Used
+		if u.Total > 0 {
+			u.Percent = math.Round(float64(u.Used)/float64(u.Total)*1000) / 10
+		}
+		usage = append(usage, u)
+	}
+	return usage, nil
+}
+
+// writePoolUsage prints the pool utilization report. Pools at or above
+// warnPercent are highlighted and summarized below the table.
+func writePoolUsage(format string, usage []poolUsage, warnPercent float64) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(struct {
+			Metadata runMetadata `json:"metadata"`
+			Pools    []poolUsage `json:"pools"`
+		}{currentRun(), usage})
+	case "csv":
+		if err := currentRun().writeCSVComments(os.Stdout); err != nil {
+			return err
+		}
+		writer := csv.NewWriter(os.Stdout)
+		if err := writer.Write([]string{"pool", "addresses", "total", "used", "free", "percent"}); err != nil {
+			return err
+		}
+		for _, u := range usage {
+			if err := writer.Write([]string{u.Pool, strings.Join(u.Addresses, " "), fmt.Sprint(u.Total), fmt.Sprint(u.Used), fmt.Sprint(u.Free), fmt.Sprintf("%.1f", u.Percent)}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+
+	table := newTable(os.Stdout)
+	table.SetHeader([]string{"Pool", "Addresses", "Total", "Used", "Free", "Utilized"})
+	var full []string
+	for _, u := range usage {
+		percent := fmt.Sprintf("%.1f%%", u.Percent)
+		if u.Percent >= warnPercent {
+			percent = ColorRed + percent + ColorReset
+			full = append(full, u.Pool)
+		}
+		table.Append([]string{u.Pool, strings.Join(u.Addresses, ", "), fmt.Sprint(u.Total), fmt.Sprint(u.Used), fmt.Sprint(u.Free), percent})
+	}
+	table.Render()
+	if len(full) > 0 {
+		fmt.Printf("%sPools at or above %.0f%% utilization: %s%s\n", ColorYellow, warnPercent, strings.Join(full, ", "), ColorReset)
+	}
+	printErrors(collectedErrors())
+	printRunFooter(currentRun())
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+	"net/netip"
+	"testing"
+)
+
+func TestParsePoolRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		entry      string
+		start, end string
+		size       uint64
+		wantErr    bool
+	}{
+		{name: "CIDR", entry: "7.10.20.0/28", start: "7.10.20.0", end: "7.10.20.15", size: 16},
+		{name: "CIDR is masked", entry: "7.10.20.5/28", start: "7.10.20.0", end: "7.10.20.15", size: 16},
+		{name: "single address", entry: "7.10.20.5/32", start: "7.10.20.5", end: "7.10.20.5", size: 1},
+		{name: "range", entry: "7.10.20.5-7.10.20.9", start: "7.10.20.5", end: "7.10.20.9", size: 5},
+		{name: "range with spaces", entry: " 7.10.20.5 - 7.10.20.5 ", start: "7.10.20.5", end: "7.10.20.5", size: 1},
+		{name: "range across octets", entry: "7.10.20.250-7.10.21.4", start: "7.10.20.250", end: "7.10.21.4", size: 11},
+		{name: "small IPv6 CIDR", entry: "fd00::/120", start: "fd00::", end: "fd00::ff", size: 256},
+		{name: "IPv6 /64 saturates", entry: "fd00::/64", start: "fd00::", end: "fd00::ffff:ffff:ffff:ffff", size: math.MaxUint64},
+		{name: "IPv6 /32 saturates", entry: "fd00::/32", start: "fd00::", end: "fd00:0:ffff:ffff:ffff:ffff:ffff:ffff", size: math.MaxUint64},
+		{name: "backwards range", entry: "7.10.20.9-7.10.20.5", wantErr: true},
+		{name: "range across families", entry: "7.10.20.1-fd00::1", wantErr: true},
+		{name: "invalid CIDR", entry: "7.10.20.0/40", wantErr: true},
+		{name: "garbage", entry: "pool-a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parsePoolRange(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePoolRange(%q) error = %v, wantErr %v", tt.entry, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if want := netip.MustParseAddr(tt.start); r.start != want {
+				t.Errorf("parsePoolRange(%q) start = %s, want %s", tt.entry, r.start, want)
+			}
+			if want := netip.MustParseAddr(tt.end); r.end != want {
+				t.Errorf("parsePoolRange(%q) end = %s, want %s", tt.entry, r.end, want)
+			}
+			if got := r.size(); got != tt.size {
+				t.Errorf("size() of %q = %d, want %d", tt.entry, got, tt.size)
+			}
+		})
+	}
+}
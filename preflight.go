@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// preflightScript reports, as key=value lines, whether arping is installed,
+// how it gets the raw socket access it needs, and the detected interface.
+// Probes run arping without privilege escalation, so a user who could only
+// run it through sudo is reported as such and fails the check.
+const preflightScript = `p=$(command -v arping); echo "arping=${p:-missing}"
+if [ -z "$p" ]; then echo "capability=none"
+elif [ "$(id -u)" = 0 ]; then echo "capability=root"
+elif getcap "$p" 2>/dev/null | grep -q cap_net_raw; then echo "capability=cap_net_raw"
+elif [ -u "$p" ]; then echo "capability=setuid"
+elif sudo -n true 2>/dev/null; then echo "capability=sudo"
+else echo "capability=none"; fi
+echo "interface=$(` + interfaceDetectionCommand + ` | sed -n 2p)"`
+
+// installArpingScript installs arping with the node's package manager. It
+// ships in iputils-arping on Debian and Ubuntu and in iputils elsewhere.
+const installArpingScript = `if command -v apt-get >/dev/null; then DEBIAN_FRONTEND=noninteractive apt-get install -y iputils-arping
+elif command -v dnf >/dev/null; then dnf install -y iputils
+elif command -v yum >/dev/null; then yum install -y iputils
+elif command -v zypper >/dev/null; then zypper --non-interactive install iputils
+else echo "no supported package manager (apt, yum, zypper)"; exit 1; fi`
+
+// preflightResult is the outcome of the checks on one node
+type preflightResult struct {
+	node       string
+	reachable  string
+	arping     string
+	capability string
+	iface      string
+}
+
+func (r preflightResult) passed() bool {
+	return r.reachable == "ok" && r.arping != "missing" && r.capability != "none" && r.capability != "sudo" && r.iface != ""
+}
+
+// runPreflightChecks verifies the local tools, then SSH reachability, arping
+// presence and capability, and interface detection on every node, and prints
+// a pass/fail table. It reports whether every check passed, and which
+// reachable nodes lack arping.
+func runPreflightChecks(nodes []string, ansibleUsername string) (bool, []string) {
+	var missingArping []string
+	passed := true
+
+	fmt.Println("\nLocal tools:")
+	for _, tool := range []string{ansiblePath, "ssh"} {
+		if path, err := exec.LookPath(tool); err != nil {
+			fmt.Printf("  %s%-8s FAIL%s (%v)\n", ColorRed, tool, ColorReset, err)
+			passed = false
+		} else {
+			fmt.Printf("  %s%-8s PASS%s (%s)\n", ColorGreen, tool, ColorReset, path)
+		}
+	}
+	if !passed {
+		return false, nil
+	}
+
+	out, _ := runCommand(exec.Command(ansiblePath, ansibleShellArgs("k8s", ansibleUsername, preflightScript)...))
+	outputs := parseAnsibleOutput(string(out))
+
+	var results []preflightResult
+	for _, node := range nodes {
+		result := preflightResult{node: node, reachable: "ok"}
+		output, ok := outputs[node]
+		if !ok {
+			result.reachable = "failed"
+			if strings.Contains(string(out), node+" | UNREACHABLE!") {
+				result.reachable = "unreachable"
+			}
+		}
+		for _, line := range strings.Split(output, "\n") {
+			key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+			switch key {
+			case "arping":
+				result.arping = value
+			case "capability":
+				result.capability = value
+			case "interface":
+				result.iface = value
+			}
+		}
+		if !result.passed() {
+			passed = false
+		}
+		if result.reachable == "ok" && result.arping == "missing" {
+			missingArping = append(missingArping, node)
+		}
+		results = append(results, result)
+	}
+
+	fmt.Println("\nNodes:")
+	table := newTable(os.Stdout)
+	table.SetHeader([]string{"Node Name", "SSH", "arping", "Capability", "Interface", "Result"})
+	for _, result := range results {
+		status := "PASS"
+		if !result.passed() {
+			status = "FAIL"
+		}
+		capability := result.capability
+		if capability == "sudo" {
+			capability = "sudo only (probes do not escalate)"
+		}
+		table.Append([]string{result.node, result.reachable, result.arping, capability, result.iface, status})
+	}
+	table.Render()
+	return passed, missingArping
+}
+
+// installArping installs arping on nodes through Ansible with privilege
+// escalation, and reports the nodes that failed.
+func installArping(nodes []string, ansibleUsername string) []string {
+	args := append([]string{"--become"}, ansibleShellArgs(strings.Join(nodes, ":"), ansibleUsername, installArpingScript)...)
+	out, _ := runCommand(exec.Command(ansiblePath, args...))
+	installed := parseAnsibleOutput(string(out))
+
+	var failed []string
+	for _, node := range nodes {
+		if _, ok := installed[node]; !ok {
+			failed = append(failed, node)
+		}
+	}
+	return failed
+}
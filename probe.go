@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// probeOptions selects how LB IP ownership is resolved and how progress is shown
+type probeOptions struct {
+	Backend           string
+	ProbeMethod       string
+	GatewayHost       string
+	GatewayUser       string
+	GatewayARPCommand string
+	AnsibleUsername   string
+	Prober            Prober
+	NodeTimeout       time.Duration
+	Checkpoint        *checkpoint
+	Talosconfig       string
+	BGPRouter         string
+	NodeAddresses     map[string]string
+	StreamFormat      string
+	NoProgress        bool
+	Pacer             *probePacer
+	// Precheck, tcp or ping, excludes nodes that don't answer before probing
+	Precheck string
+
+	// OnResult, if set, is called with each node/IP row as soon as it is confirmed
+	OnResult func(row []string)
+}
+
+// collectTargets gathers every LB IP to probe from the cluster according to
+// the discovery options.
+func collectTargets(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, discovery discoveryOptions) (*ipSet, []cloudManagedLB) {
+	_, span := startSpan(ctx, "list services")
+	targets, cloudLBs := getLoadBalancerIPsStartingWithSeven(clientset, discovery)
+	span.End()
+
+	if discovery.IncludeIngress {
+		_, span = startSpan(ctx, "list ingresses")
+		err := collectIngressIPs(clientset, targets, discovery)
+		endSpan(span, err)
+		if err != nil {
+			recordError("fetching ingresses", "", apiError{err})
+		}
+	}
+	if discovery.IncludeKeepalived {
+		_, span = startSpan(ctx, "read keepalived VIPs")
+		err := collectKeepalivedVIPs(targets, discovery.AnsibleUsername)
+		endSpan(span, err)
+		if err != nil {
+			recordError("fetching keepalived VIPs", "", backendError{err})
+		}
+	}
+	if discovery.IncludeGateways {
+		_, span = startSpan(ctx, "list gateways")
+		err := collectGatewayIPs(dynamicClient, targets, discovery)
+		endSpan(span, err)
+		if err != nil {
+			recordError("fetching gateways", "", apiError{err})
+		}
+	}
+
+	return targets, cloudLBs
+}
+
+// probeTargets resolves which node hosts each target IP using the selected
+// backend, and which nodes were unreachable. Warnings and errors are returned
+// rather than printed so they never interleave with the progress bar.
+func probeTargets(ctx context.Context, clientset kubernetes.Interface, opts probeOptions, nodes []string, arpInterface string, targets *ipSet) ([][]string, []string, []string, error) {
+	var hostingNodes, arpCheck [][]string
+	var unreachable []string
+	var warnings []string
+	var probeErr error
+	lbIPs := targets.ips
+
+	probeCtx, probeSpan := startSpan(ctx, "probe", attribute.Int("nodes", len(nodes)), attribute.Int("ips", len(lbIPs)))
+	if opts.Backend == "servicelb" {
+		_, span := startSpan(probeCtx, "read ServiceLB placement")
+		hostingNodes, probeErr = getServiceLBPlacement(clientset, lbIPs)
+		endSpan(span, probeErr)
+		if probeErr != nil {
+			probeErr = apiError{fmt.Errorf("reading ServiceLB placement: %v", probeErr)}
+		}
+	}
+
+	// Nodes that are down are left out before the per-node probes start
+	perNode := opts.Backend == "servicelb" || (opts.Backend != "gateway" && opts.Backend != "talos" && opts.Backend != "bgp" && opts.ProbeMethod != "neigh")
+	var excluded []string
+	if opts.Precheck != "" && perNode {
+		_, span := startSpan(probeCtx, "check node reachability", attribute.String("method", opts.Precheck))
+		nodes, excluded = checkNodeReachability(probeCtx, opts.Precheck, nodes, opts.NodeAddresses, opts.AnsibleUsername)
+		span.SetAttributes(attribute.Int("unreachable", len(excluded)))
+		span.End()
+		if len(excluded) > 0 {
+			warnings = append(warnings, fmt.Sprintf("Excluded %s before probing, as they did not pass the %s reachability check.", strings.Join(excluded, ", "), opts.Precheck))
+		}
+	}
+
+	// Bulk backends finish in a single step
+	progressTotal := len(nodes)
+	if opts.Backend == "gateway" || opts.Backend == "talos" || opts.Backend == "bgp" || (opts.Backend == "ansible" && opts.ProbeMethod == "neigh") {
+		progressTotal = 1
+	}
+	probeStart := time.Now()
+	emitEvent(eventProbeStarted, map[string]interface{}{"backend": opts.Backend, "probeMethod": opts.ProbeMethod, "nodes": len(nodes), "ips": len(lbIPs)})
+	var progress *progressBar
+	if !opts.NoProgress {
+		progress = newProgressBar(progressTotal)
+	}
+	stream := newResultStreamer(opts.StreamFormat, progress, targets, opts.OnResult)
+	prober := opts.Prober
+	if prober == nil {
+		prober = arpingProber{ansibleUsername: opts.AnsibleUsername}
+	}
+
+	if opts.Backend == "gateway" {
+		gatewayUser, arpCommand := opts.GatewayUser, opts.GatewayARPCommand
+		if gatewayUser == "" {
+			gatewayUser = opts.AnsibleUsername
+		}
+		if opts.ProbeMethod == "neigh" {
+			arpCommand = "ip -json neigh show"
+		}
+		progress.startNode(opts.GatewayHost)
+		_, span := startSpan(probeCtx, "read gateway ARP table", attribute.String("gateway", opts.GatewayHost))
+		hostingNodes, targets.responders, probeErr = runGatewayARPLookup(opts.GatewayHost, gatewayUser, arpCommand, arpInterface, lbIPs, opts.AnsibleUsername)
+		endSpan(span, probeErr)
+		if probeErr != nil {
+			probeErr = backendError{fmt.Errorf("reading gateway ARP table: %v", probeErr)}
+		}
+		progress.nodeDone()
+	} else if opts.Backend == "talos" {
+		progress.startNode("all nodes")
+		_, span := startSpan(probeCtx, "read Talos addresses and neighbors")
+		hostingNodes, targets.responders, probeErr = runTalosLookup(opts.Talosconfig, nodes, opts.NodeAddresses, lbIPs)
+		endSpan(span, probeErr)
+		if probeErr != nil {
+			probeErr = backendError{fmt.Errorf("reading the Talos API: %v", probeErr)}
+		}
+		progress.nodeDone()
+	} else if opts.Backend == "bgp" {
+		progress.startNode(opts.BGPRouter)
+		_, span := startSpan(probeCtx, "read BGP routes", attribute.String("router", opts.BGPRouter))
+		hostingNodes, probeErr = runBGPRouteLookup(opts.BGPRouter, nodes, opts.NodeAddresses, lbIPs)
+		endSpan(span, probeErr)
+		if probeErr != nil {
+			probeErr = backendError{fmt.Errorf("reading BGP routes: %v", probeErr)}
+		}
+		progress.nodeDone()
+	} else if opts.Backend == "servicelb" {
+		arpCheck, unreachable = runARPCommandOnAllNodes(probeCtx, nodes, arpInterface, lbIPs, prober, opts.NodeTimeout, opts.Checkpoint, opts.Pacer, progress, nil)
+	} else if opts.ProbeMethod == "neigh" {
+		progress.startNode("all nodes")
+		_, span := startSpan(probeCtx, "read neighbor tables")
+		hostingNodes, targets.responders, probeErr = runNeighLookupOnAllNodes(arpInterface, lbIPs, opts.AnsibleUsername)
+		endSpan(span, probeErr)
+		if probeErr != nil {
+			probeErr = backendError{fmt.Errorf("reading neighbor tables: %v", probeErr)}
+		}
+		progress.nodeDone()
+	} else {
+		hostingNodes, unreachable = runARPCommandOnAllNodes(probeCtx, nodes, arpInterface, lbIPs, prober, opts.NodeTimeout, opts.Checkpoint, opts.Pacer, progress, stream)
+	}
+	if consensus, ok := prober.(*consensusProber); ok {
+		targets.flapping = make(map[string]bool)
+		flapping := consensus.takeFlapping()
+		for _, ip := range lbIPs {
+			if answers, ok := flapping[ip]; ok {
+				targets.flapping[ip] = true
+				recordError("FLAPPING", ip, fmt.Errorf("%s", strings.Join(answers, "; ")))
+			}
+		}
+	}
+
+	// Backends without per-probe results stream everything once they finish
+	if opts.Backend == "gateway" || opts.Backend == "servicelb" || opts.Backend == "talos" || opts.Backend == "bgp" || opts.ProbeMethod == "neigh" {
+		for _, row := range hostingNodes {
+			stream.emit(row)
+		}
+	}
+	unreachable = append(excluded, unreachable...)
+	progress.Stop()
+	probeSpan.SetAttributes(attribute.Int("results", len(hostingNodes)))
+	endSpan(probeSpan, probeErr)
+
+	if opts.Backend == "servicelb" {
+		warnings = compareWithARP(hostingNodes, arpCheck)
+	}
+
+	// Record the outcome in the run log and event sinks
+	if probeErr != nil {
+		recordError("probing", opts.Backend, probeErr)
+	}
+	claimed := make(map[string]bool)
+	for _, row := range hostingNodes {
+		logf("result: %s is hosted by %s", row[1], row[0])
+		claimed[row[1]] = true
+	}
+	for _, node := range unreachable {
+		logf("result: %s is UNREACHABLE", node)
+	}
+	for _, ip := range lbIPs {
+		// A responder that is no cluster node is a rogue device or a conflict
+		if mac, ok := targets.responders[ip]; ok && !claimed[ip] {
+			recordError("foreign ARP responder", ip, fmt.Errorf("answered by %s (%s), which is not a cluster node", mac, macVendor(mac)))
+		}
+		if !claimed[ip] {
+			emitEvent(eventIPUnclaimed, map[string]interface{}{"ip": ip, "source": targets.source(ip)})
+		}
+	}
+	emitEvent(eventProbeFinished, map[string]interface{}{"results": len(hostingNodes), "ips": len(lbIPs), "durationSeconds": time.Since(probeStart).Seconds()})
+
+	return hostingNodes, unreachable, warnings, probeErr
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"plugin"
+	"strings"
+)
+
+// ProbeResult is the outcome of probing one IP from one node. Unreachable
+// means the node itself could not be reached, so none of its results count.
+type ProbeResult struct {
+	Hosted      bool
+	Unreachable bool
+	Detail      string
+	Err         error
+}
+
+// Prober decides whether node hosts ip on interface iface. Site-specific
+// probers can be loaded with --prober as a Go plugin or an external executable.
+type Prober interface {
+	Probe(ctx context.Context, node, iface, ip string) ProbeResult
+}
+
+// remoteProber is a prober that reaches nodes without Ansible, so the ARP
+// interface is detected through it as well.
+type remoteProber interface {
+	Prober
+	detectInterface(ctx context.Context, nodes []string) string
+	// commandLine shows how command would be run on node, for --dry-run
+	commandLine(node, command string) string
+}
+
+// detectionNode picks the node the interface is detected on: the second one,
+// like the Ansible backend's k8s[1], or the only node of a single-node cluster.
+func detectionNode(nodes []string) string {
+	if len(nodes) > 1 {
+		return nodes[1]
+	}
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	return ""
+}
+
+// parseInterfaceDetection picks the interface from the detection command's
+// output, which is the second route line as with the Ansible backend.
+func parseInterfaceDetection(out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) >= 2 {
+		return strings.TrimSpace(lines[1])
+	}
+	return ""
+}
+
+// arpingProber is the built-in prober: it arpings the IP from the node through
+// Ansible. A node cannot arping an address it holds itself, so an arping
+// without reply means the node hosts the IP. flavors holds the arping variant
+// detected on each node; nodes without one are assumed to run iputils.
+type arpingProber struct {
+	ansibleUsername string
+	flavors         map[string]arpingFlavor
+}
+
+func (p arpingProber) Probe(ctx context.Context, node, iface, ip string) ProbeResult {
+	flavor := p.flavors[node]
+	cmd := exec.CommandContext(ctx, ansiblePath, ansibleShellArgs(node, p.ansibleUsername, flavor.command(iface, ip))...)
+	out, err := runNamedCommand(node+"_"+ip, cmd)
+	if strings.Contains(string(out), "UNREACHABLE!") {
+		return ProbeResult{Unreachable: true, Err: fmt.Errorf("%s", strings.TrimSpace(string(out)))}
+	}
+	hosted, err := flavor.noReply(string(out), err)
+	return ProbeResult{Hosted: hosted, Err: err, Detail: flavor.String()}
+}
+
+// pluginProbeFunc is the symbol a Go plugin must export as "Probe"
+type pluginProbeFunc = func(ctx context.Context, node, iface, ip string) (hosted bool, detail string, err error)
+
+// pluginProber calls the Probe function exported by a Go plugin
+type pluginProber struct {
+	probe pluginProbeFunc
+}
+
+func (p pluginProber) Probe(ctx context.Context, node, iface, ip string) ProbeResult {
+	hosted, detail, err := p.probe(ctx, node, iface, ip)
+	return ProbeResult{Hosted: hosted, Detail: detail, Err: err}
+}
+
+// execProbeRequest is written as JSON to an external prober's stdin
+type execProbeRequest struct {
+	Node      string `json:"node"`
+	Interface string `json:"interface"`
+	IP        string `json:"ip"`
+}
+
+// execProbeResponse is read as JSON from an external prober's stdout
+type execProbeResponse struct {
+	Hosted bool   `json:"hosted"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// execProber runs an external executable once per probe, sending an
+// execProbeRequest on stdin and reading an execProbeResponse from stdout.
+type execProber struct {
+	path string
+}
+
+func (p execProber) Probe(ctx context.Context, node, iface, ip string) ProbeResult {
+	request, err := json.Marshal(execProbeRequest{Node: node, Interface: iface, IP: ip})
+	if err != nil {
+		return ProbeResult{Err: err}
+	}
+
+	cmd := exec.CommandContext(ctx, p.path)
+	cmd.Stdin = bytes.NewReader(request)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	logf("exec %q for %s on %s: %s", p.path, ip, node, strings.TrimSpace(string(out)))
+	if artifactsDir != "" {
+		saveArtifact(node+"_"+ip, cmd, out, stderr.Bytes(), err)
+	}
+	if err != nil {
+		return ProbeResult{Err: fmt.Errorf("%s: %v: %s", p.path, err, strings.TrimSpace(stderr.String()))}
+	}
+
+	var response execProbeResponse
+	if err := json.Unmarshal(out, &response); err != nil {
+		return ProbeResult{Err: fmt.Errorf("%s returned invalid JSON: %v", p.path, err)}
+	}
+	result := ProbeResult{Hosted: response.Hosted, Detail: response.Detail}
+	if response.Error != "" {
+		result.Err = fmt.Errorf("%s", response.Error)
+	}
+	return result
+}
+
+// loadProber returns the prober selected by spec: "arping" for the built-in
+// prober, "plugin:<path.so>" for a Go plugin or "exec:<path>" for an external
+// executable speaking the JSON protocol.
+func loadProber(spec, ansibleUsername string) (Prober, error) {
+	switch {
+	case spec == "" || spec == "arping":
+		return arpingProber{ansibleUsername: ansibleUsername}, nil
+
+	case strings.HasPrefix(spec, "plugin:"):
+		path := strings.TrimPrefix(spec, "plugin:")
+		p, err := plugin.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		symbol, err := p.Lookup("Probe")
+		if err != nil {
+			return nil, err
+		}
+		probe, ok := symbol.(pluginProbeFunc)
+		if !ok {
+			return nil, fmt.Errorf("plugin %s: Probe must be a func(context.Context, string, string, string) (bool, string, error)", path)
+		}
+		return pluginProber{probe: probe}, nil
+
+	case strings.HasPrefix(spec, "exec:"):
+		path, err := exec.LookPath(strings.TrimPrefix(spec, "exec:"))
+		if err != nil {
+			return nil, err
+		}
+		return execProber{path: path}, nil
+	}
+
+	return nil, fmt.Errorf("invalid prober %q (expected arping, plugin:<path.so> or exec:<path>)", spec)
+}
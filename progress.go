@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressBarWidth is the number of cells in the rendered bar
+const progressBarWidth = 30
+
+// plainProgress replaces the redrawn bar with a timestamped line per node,
+// for CI logs that don't interpret carriage returns
+var plainProgress bool
+
+// progressBar renders nodes completed / total, the node currently being
+// probed and elapsed/ETA on a single redrawn line. A live block set with
+// setLive is redrawn in place above the bar. All methods are safe to call on
+// a nil bar.
+type progressBar struct {
+	mu      sync.Mutex
+	total   int
+	done    int
+	current string
+	start   time.Time
+
+	live      []string
+	liveDrawn int // lines of the live block currently on screen
+
+	stop     chan struct{}
+	finished chan struct{}
+}
+
+// newProgressBar prints the working banner to the UI stream and starts
+// redrawing the bar. In quiet mode no bar is shown and nil is returned.
+func newProgressBar(total int) *progressBar {
+	if quiet {
+		return nil
+	}
+	p := &progressBar{
+		total:    total,
+		start:    time.Now(),
+		stop:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+
+	output.UI("\n*******************************************\n" +
+		"*** Please wait... I am working on it ***\n" +
+		"*******************************************\n")
+
+	if plainProgress {
+		close(p.finished)
+		return p
+	}
+	go func() {
+		ticker := time.NewTicker(200 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			p.render()
+			select {
+			case <-p.stop:
+				close(p.finished)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return p
+}
+
+// startNode records the node now being probed
+func (p *progressBar) startNode(node string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.current = node
+	if plainProgress {
+		output.UI(fmt.Sprintf("%s probing %s (%d/%d)...\n", time.Now().Format(time.RFC3339), node, p.done+1, p.total))
+	}
+	p.mu.Unlock()
+}
+
+// nodeDone marks the current node as completed
+func (p *progressBar) nodeDone() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.done++
+	p.current = ""
+	p.mu.Unlock()
+}
+
+// Stop stops redrawing and clears the bar so results can be printed cleanly
+func (p *progressBar) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.finished
+	if plainProgress {
+		output.UI(fmt.Sprintf("%s probed %d/%d nodes in %s\n", time.Now().Format(time.RFC3339), p.done, p.total, time.Since(p.start).Round(time.Second)))
+		return
+	}
+	p.mu.Lock()
+	output.UI(p.clearLocked()) // Clear progress line and live block
+	p.mu.Unlock()
+}
+
+// setLive replaces the block redrawn above the bar
+func (p *progressBar) setLive(lines []string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clear := p.clearLocked()
+	p.live = lines
+	output.UI(clear + p.frameLocked())
+}
+
+// println prints line to the report above the bar and redraws the bar below
+// it, so output produced while probing never interleaves with the progress
+// line.
+func (p *progressBar) println(line string) {
+	if p == nil {
+		output.Report(line + "\n")
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if plainProgress {
+		output.Report(line + "\n")
+		return
+	}
+	output.ReportBetween(p.clearLocked(), line+"\n", p.frameLocked())
+}
+
+func (p *progressBar) render() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	output.UI(p.clearLocked() + p.frameLocked())
+}
+
+// clearLocked returns the sequence erasing the bar and the live block above
+// it, leaving the cursor where the live block started; the caller must hold
+// p.mu
+func (p *progressBar) clearLocked() string {
+	var b strings.Builder
+	b.WriteString("\r\033[K")
+	for ; p.liveDrawn > 0; p.liveDrawn-- {
+		b.WriteString("\033[1A\033[K")
+	}
+	return b.String()
+}
+
+// frameLocked returns the live block and the bar, to be drawn on a cleared
+// screen area as a single write; the caller must hold p.mu
+func (p *progressBar) frameLocked() string {
+	var b strings.Builder
+	for _, line := range p.live {
+		b.WriteString(line + "\n")
+	}
+	p.liveDrawn = len(p.live)
+
+	filled := 0
+	if p.total > 0 {
+		filled = p.done * progressBarWidth / p.total
+	}
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled)
+
+	elapsed := time.Since(p.start).Round(time.Second)
+	eta := "--"
+	if p.done > 0 && p.done < p.total {
+		remaining := time.Duration(int64(time.Since(p.start)) / int64(p.done) * int64(p.total-p.done))
+		eta = remaining.Round(time.Second).String()
+	}
+
+	current := p.current
+	if current == "" {
+		current = "-"
+	}
+	fmt.Fprintf(&b, "%s[%s] %d/%d nodes | %s | elapsed %s | ETA %s%s", ColorPurple, bar, p.done, p.total, current, elapsed, eta, ColorReset)
+	return b.String()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reachabilityTimeout bounds each TCP connection attempt of the pre-check
+const reachabilityTimeout = 3 * time.Second
+
+// checkNodeReachability checks every node at once before probing, either by
+// connecting to its SSH port (tcp) or with an Ansible ping (ping), so nodes
+// that are down are excluded up front instead of each of their probes timing
+// out in turn. It returns the nodes that answered and those that did not, in
+// the order given.
+func checkNodeReachability(ctx context.Context, method string, nodes []string, nodeAddresses map[string]string, ansibleUsername string) ([]string, []string) {
+	failures := make(map[string]error)
+	if method == "ping" {
+		failures = ansiblePing(ctx, nodes, ansibleUsername)
+	} else {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, node := range nodes {
+			address := node
+			if nodeAddresses[node] != "" {
+				address = nodeAddresses[node]
+			}
+			wg.Add(1)
+			go func(node, address string) {
+				defer wg.Done()
+				dialer := net.Dialer{Timeout: reachabilityTimeout}
+				conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, "22"))
+				if err != nil {
+					mu.Lock()
+					failures[node] = err
+					mu.Unlock()
+					return
+				}
+				conn.Close()
+			}(node, address)
+		}
+		wg.Wait()
+	}
+
+	var reachable, unreachable []string
+	for _, node := range nodes {
+		if err, failed := failures[node]; failed {
+			recordError("connecting to node", node, backendError{err})
+			unreachable = append(unreachable, node)
+		} else {
+			reachable = append(reachable, node)
+		}
+	}
+	return reachable, unreachable
+}
+
+// ansiblePing pings every node in the inventory through Ansible, which
+// reaches them in parallel, and returns the error of each node that failed
+func ansiblePing(ctx context.Context, nodes []string, ansibleUsername string) map[string]error {
+	cmd := exec.CommandContext(ctx, ansiblePath, ansibleModuleArgs("k8s", ansibleUsername, "ping")...)
+	// Unreachable nodes make ansible exit non-zero, the output tells which
+	out, _ := runCommand(cmd)
+
+	// Result headers look like "node-1 | SUCCESS => {"
+	succeeded := make(map[string]bool)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, " | ")
+		if len(fields) >= 2 && strings.HasPrefix(fields[1], "SUCCESS") {
+			succeeded[strings.TrimSpace(fields[0])] = true
+		}
+	}
+	failures := make(map[string]error)
+	for _, node := range nodes {
+		if !succeeded[node] {
+			failures[node] = fmt.Errorf("no answer to an Ansible ping")
+		}
+	}
+	return failures
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// report is the structured form of a run's result. schema.go holds its
+// JSON Schema, which must be kept in step.
+type report struct {
+	APIVersion    string            `json:"apiVersion"`
+	Metadata      runMetadata       `json:"metadata"`
+	Results       []reportRow       `json:"results"`
+	Unreachable   []string          `json:"unreachable,omitempty"`
+	Maintenance   []maintenanceNode `json:"maintenance,omitempty"`
+	CloudManaged  []cloudManagedLB  `json:"cloudManaged,omitempty"`
+	BGPAdvertised []bgpAdvertisedIP `json:"bgpAdvertised,omitempty"`
+	Errors        []runError        `json:"errors,omitempty"`
+}
+
+// reportRow is a single LB IP and the node hosting it
+type reportRow struct {
+	Node   string `json:"node"`
+	IP     string `json:"ip"`
+	Source string `json:"source,omitempty"`
+	Pool   string `json:"pool,omitempty"`
+	// Services lists every service sharing the IP, with its ports
+	Services []string `json:"services,omitempty"`
+	// Ports are the ports the services expose on the IP, like 80/TCP
+	Ports    []string `json:"ports,omitempty"`
+	Protocol string   `json:"protocol,omitempty"`
+	UDPProbe string   `json:"udpProbe,omitempty"`
+	PTR      string   `json:"ptr,omitempty"`
+	MAC      string   `json:"mac,omitempty"`
+	Vendor   string   `json:"vendor,omitempty"`
+	// Speaker is the MetalLB speaker pod on the node announcing the IP
+	Speaker string `json:"speaker,omitempty"`
+	// Flapping is set when the --consensus probes of the IP disagreed
+	Flapping bool `json:"flapping,omitempty"`
+	// Flaps counts the owner changes within the daemon's flap window
+	Flaps int `json:"flaps,omitempty"`
+}
+
+func newReport(hostingNodes [][]string, unreachable []string, targets *ipSet, cloudLBs []cloudManagedLB) report {
+	r := report{APIVersion: reportAPIVersion, Metadata: currentRun(), Results: []reportRow{}, Unreachable: unreachable, Maintenance: maintenanceNodes(targets), CloudManaged: cloudLBs, BGPAdvertised: bgpAdvertisedIPs(targets), Errors: collectedErrors()}
+	for _, row := range hostingNodes {
+		r.Results = append(r.Results, newReportRow(row, targets))
+	}
+	return r
+}
+
+// newReportRow describes a single node/IP row of the result
+func newReportRow(row []string, targets *ipSet) reportRow {
+	result := reportRow{Node: row[0], IP: row[1], Source: targets.source(row[1]), Pool: targets.pools[row[1]], Services: targets.services[row[1]], Ports: targets.portList(row[1]), Protocol: targets.protocols(row[1]), UDPProbe: targets.udpProbes[row[1]], PTR: targets.ptrNames[row[1]], Speaker: targets.speakers[row[0]], Flapping: targets.flapping[row[1]], Flaps: targets.flaps[row[1]]}
+	if mac := targets.responders[row[1]]; mac != "" {
+		result.MAC, result.Vendor = mac, macVendor(mac)
+	}
+	return result
+}
+
+// writeReport prints the final result in the requested format. Unreachable
+// nodes are listed with UNREACHABLE in place of an IP, and nodes skipped for
+// maintenance with MAINTENANCE and their taint as the source. groupBy pool splits
+// the table into one table per pool, namespace into one per namespace and
+// tenant into one per tenant label value.
+func writeReport(format, groupBy string, hostingNodes [][]string, unreachable []string, targets *ipSet, cloudLBs []cloudManagedLB) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if len(selectedFields) > 0 {
+			return encoder.Encode(newFieldReport(newReport(hostingNodes, unreachable, targets, cloudLBs), selectedFields))
+		}
+		return encoder.Encode(newReport(hostingNodes, unreachable, targets, cloudLBs))
+
+	case "csv":
+		r := newReport(hostingNodes, unreachable, targets, cloudLBs)
+		if err := r.Metadata.writeCSVComments(os.Stdout); err != nil {
+			return err
+		}
+		writer := csv.NewWriter(os.Stdout)
+		if len(selectedFields) > 0 {
+			return writeFieldCSV(writer, r, unreachable)
+		}
+		if err := writer.Write([]string{"node", "ip", "source", "pool", "services", "ports", "protocol", "udpProbe"}); err != nil {
+			return err
+		}
+		for _, row := range r.Results {
+			if err := writer.Write([]string{row.Node, row.IP, row.Source, row.Pool, strings.Join(row.Services, "; "), strings.Join(row.Ports, " "), row.Protocol, row.UDPProbe}); err != nil {
+				return err
+			}
+		}
+		for _, node := range unreachable {
+			if err := writer.Write([]string{node, "UNREACHABLE", "", "", "", "", "", ""}); err != nil {
+				return err
+			}
+		}
+		for _, n := range r.Maintenance {
+			if err := writer.Write([]string{n.Node, "MAINTENANCE", n.Taint, "", "", "", "", ""}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+
+	case "html":
+		return htmlReportTemplate.Execute(os.Stdout, newReport(hostingNodes, unreachable, targets, cloudLBs))
+	}
+
+	switch groupBy {
+	case "pool":
+		printResultsByPool(hostingNodes, targets, format == "wide")
+	case "namespace", "tenant":
+		printResultsByTenant(hostingNodes, targets, format == "wide", groupBy == "tenant")
+	default:
+		printResults(hostingNodes, targets, format == "wide")
+	}
+	if len(unreachable) > 0 {
+		fmt.Printf("%sUNREACHABLE (excluded from the result): %s%s\n", ColorRed, strings.Join(unreachable, ", "), ColorReset)
+	}
+	printMaintenance(maintenanceNodes(targets))
+	printCloudManaged(cloudLBs)
+	printBGPAdvertised(bgpAdvertisedIPs(targets))
+	printErrors(collectedErrors())
+	printRunFooter(currentRun())
+	return nil
+}
+
+// writeFieldCSV writes the --fields columns of the result, keyed by field
+// name. Unreachable nodes have UNREACHABLE in the ip column, and nodes in
+// maintenance MAINTENANCE.
+func writeFieldCSV(writer *csv.Writer, r report, unreachable []string) error {
+	header := make([]string, len(selectedFields))
+	for i, field := range selectedFields {
+		header[i] = field.Name
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, row := range r.Results {
+		if err := writer.Write(fieldCells(selectedFields, row, " ")); err != nil {
+			return err
+		}
+	}
+	for _, node := range unreachable {
+		if err := writer.Write(fieldCells(selectedFields, reportRow{Node: node, IP: "UNREACHABLE"}, " ")); err != nil {
+			return err
+		}
+	}
+	for _, n := range r.Maintenance {
+		if err := writer.Write(fieldCells(selectedFields, reportRow{Node: n.Node, IP: "MAINTENANCE", Source: n.Taint}, " ")); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// outputFormatsByExtension infers --output from the --output-file extension
+var outputFormatsByExtension = map[string]string{
+	".json": "json",
+	".csv":  "csv",
+	".html": "html",
+	".htm":  "html",
+	".txt":  "table",
+}
+
+// formatForFile returns the output format for path's extension, or "" if
+// the extension says nothing
+func formatForFile(path string) string {
+	return outputFormatsByExtension[strings.ToLower(filepath.Ext(path))]
+}
+
+// reportFile sends what the final report prints to stdout into a file. The
+// report goes to a temporary file next to it, renamed into place once
+// complete, so readers never see half a report. A nil reportFile leaves
+// stdout alone.
+type reportFile struct {
+	path   string
+	tmp    *os.File
+	stdout *os.File
+}
+
+// startReportFile creates the parent directories of path and captures
+// stdout until finish
+func startReportFile(path string) (*reportFile, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	f := &reportFile{path: path, tmp: tmp, stdout: os.Stdout}
+	os.Stdout = tmp
+	return f, nil
+}
+
+// finish restores stdout and moves the report into place. A run exiting on
+// a signal, with code 128+signal, printed at most part of the report, so it
+// is thrown away and the previous report left alone.
+func (f *reportFile) finish(code int) {
+	if f == nil {
+		return
+	}
+	os.Stdout = f.stdout
+	err := f.tmp.Close()
+	if code > 128 {
+		os.Remove(f.tmp.Name())
+		logf("run interrupted, report not written to %s", f.path)
+		return
+	}
+	if err == nil {
+		err = os.Rename(f.tmp.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.tmp.Name())
+		logf("error writing report to %s: %v", f.path, err)
+		fmt.Fprintf(os.Stderr, "%sError writing report to %s: %v%s\n", ColorRed, f.path, err, ColorReset)
+		return
+	}
+	logf("report written to %s", f.path)
+}
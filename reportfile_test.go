@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReportFileFinish(t *testing.T) {
+	tests := []struct {
+		name string
+		code int
+		want string
+	}{
+		{name: "complete run", code: 0, want: "new report\n"},
+		{name: "failed checks still write the report", code: exitProbe, want: "new report\n"},
+		{name: "interrupted run keeps the previous report", code: 130, want: "previous report\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "reports", "result.json")
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if err := os.WriteFile(path, []byte("previous report\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			stdout := os.Stdout
+			f, err := startReportFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fmt.Println("new report")
+			f.finish(tt.code)
+			if os.Stdout != stdout {
+				t.Error("stdout was not restored")
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("report = %q, want %q", got, tt.want)
+			}
+			if leftover, _ := filepath.Glob(filepath.Join(dir, "reports", ".*.tmp")); len(leftover) > 0 {
+				t.Errorf("temporary files left behind: %v", leftover)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{name: "every six hours", expr: "0 */6 * * *"},
+		{name: "macro", expr: "@daily"},
+		{name: "lists, ranges and steps", expr: "0,30 8-18 1-15/2 * 1-5"},
+		{name: "Sunday as 7", expr: "0 0 * * 7"},
+		{name: "leap day", expr: "0 0 29 2 *"},
+		{name: "too few fields", expr: "* * * *", wantErr: true},
+		{name: "unknown macro", expr: "@often", wantErr: true},
+		{name: "minute out of range", expr: "60 * * * *", wantErr: true},
+		{name: "zero step", expr: "*/0 * * * *", wantErr: true},
+		{name: "backwards range", expr: "5-1 * * * *", wantErr: true},
+		{name: "not a number", expr: "x * * * *", wantErr: true},
+		{name: "day that never comes", expr: "0 0 30 2 *", wantErr: true},
+		{name: "31st of a 30-day month", expr: "0 0 31 4 *", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCronSchedule(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseCronSchedule(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// 14 October 2026 is a Wednesday
+	at := func(month time.Month, day, hour, minute int, year ...int) time.Time {
+		y := 2026
+		if len(year) > 0 {
+			y = year[0]
+		}
+		return time.Date(y, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{name: "later the same day", expr: "0 */6 * * *", from: at(time.October, 14, 7, 30), want: at(time.October, 14, 12, 0)},
+		{name: "strictly after from", expr: "@daily", from: at(time.October, 14, 0, 0), want: at(time.October, 15, 0, 0)},
+		{name: "seconds are dropped", expr: "* * * * *", from: at(time.October, 14, 7, 30).Add(59 * time.Second), want: at(time.October, 14, 7, 31)},
+		{name: "next month", expr: "0 0 1 * *", from: at(time.October, 14, 7, 30), want: at(time.November, 1, 0, 0)},
+		{name: "next year", expr: "@yearly", from: at(time.October, 14, 7, 30), want: at(time.January, 1, 0, 0, 2027)},
+		{name: "next leap day", expr: "0 0 29 2 *", from: at(time.October, 14, 7, 30), want: at(time.February, 29, 0, 0, 2028)},
+		{name: "Sunday as 7", expr: "30 8 * * 7", from: at(time.October, 14, 7, 30), want: at(time.October, 18, 8, 30)},
+		{name: "either day field matches", expr: "0 9 1 * 1", from: at(time.October, 14, 7, 30), want: at(time.October, 19, 9, 0)},
+		{name: "both day fields must match when one is *", expr: "0 9 * * 1-5", from: at(time.October, 17, 7, 30), want: at(time.October, 19, 9, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseCronSchedule(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCronSchedule(%q): %v", tt.expr, err)
+			}
+			if got := s.next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("next(%s) of %q = %s, want %s", tt.from, tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFollowingSlot(t *testing.T) {
+	s, err := parseCronSchedule("@yearly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &daemon{schedule: s}
+	now := time.Now()
+	thisYear := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, now.Location())
+
+	tests := []struct {
+		name string
+		slot time.Time
+		want time.Time
+	}{
+		{name: "next slot still ahead", slot: thisYear, want: thisYear.AddDate(1, 0, 0)},
+		{name: "one missed slot", slot: thisYear.AddDate(-1, 0, 0), want: thisYear},
+		{name: "several missed slots catch up once", slot: thisYear.AddDate(-3, 0, 0), want: thisYear},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.followingSlot(tt.slot); !got.Equal(tt.want) {
+				t.Errorf("followingSlot(%s) = %s, want %s", tt.slot, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import "fmt"
+
+// reportAPIVersion versions the JSON report. Fields may be added within a
+// version; renaming or removing one, or changing its type, needs a new
+// version.
+const reportAPIVersion = "get-loadbalancerip/v1"
+
+// reportSchema is the JSON Schema of the JSON report at reportAPIVersion,
+// printed by the schema subcommand. It must follow the report type.
+const reportSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "urn:get-loadbalancerip:report:v1",
+  "title": "get_loadBalancerIP report",
+  "description": "The result of a run with --output json. With --fields, results hold only the selected fields, in the selected order.",
+  "type": "object",
+  "required": ["apiVersion", "metadata", "results"],
+  "properties": {
+    "apiVersion": {"const": "get-loadbalancerip/v1"},
+    "metadata": {
+      "type": "object",
+      "required": ["runId", "version", "cluster", "context", "started", "finished"],
+      "properties": {
+        "runId": {"type": "string", "description": "Random ID of the run or daemon cycle"},
+        "version": {"type": "string", "description": "Tool version"},
+        "cluster": {"type": "string", "description": "Cluster of the kubeconfig's current context"},
+        "context": {"type": "string", "description": "Current kubeconfig context"},
+        "user": {"type": "string", "description": "Kubeconfig user of the current context"},
+        "started": {"type": "string", "format": "date-time"},
+        "finished": {"type": "string", "format": "date-time"},
+        "staleInventory": {"type": "string", "format": "date-time", "description": "When the inventory was read, if the API server was unavailable and the results are based on stale inventory"}
+      }
+    },
+    "results": {
+      "type": "array",
+      "description": "One entry per LB IP and node hosting it",
+      "items": {
+        "type": "object",
+        "properties": {
+          "node": {"type": "string"},
+          "ip": {"type": "string"},
+          "source": {"type": "string", "description": "Where the IP was found, e.g. Service or Ingress"},
+          "pool": {"type": "string", "description": "MetalLB or Cilium pool of the IP"},
+          "services": {"type": "array", "items": {"type": "string"}, "description": "Services sharing the IP, with their ports"},
+          "ports": {"type": "array", "items": {"type": "string"}, "description": "Ports exposed on the IP, like 80/TCP"},
+          "protocol": {"type": "string"},
+          "udpProbe": {"type": "string"},
+          "ptr": {"type": "string", "description": "Reverse DNS name of the IP"},
+          "mac": {"type": "string", "description": "MAC address that answered for the IP"},
+          "vendor": {"type": "string", "description": "Vendor of the MAC address"},
+          "speaker": {"type": "string", "description": "MetalLB speaker pod on the node"},
+          "flapping": {"type": "boolean", "description": "Set when the --consensus probes disagreed"},
+          "flaps": {"type": "integer", "description": "Owner changes within the daemon's flap window"}
+        }
+      }
+    },
+    "unreachable": {"type": "array", "items": {"type": "string"}, "description": "Nodes left out of the result"},
+    "maintenance": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["node", "taint"],
+        "properties": {
+          "node": {"type": "string"},
+          "taint": {"type": "string", "description": "The --skip-taints taint the node carries"}
+        }
+      },
+      "description": "Nodes not probed because they are under maintenance"
+    },
+    "cloudManaged": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["namespace", "service", "provider", "address"],
+        "properties": {
+          "namespace": {"type": "string"},
+          "service": {"type": "string"},
+          "provider": {"type": "string"},
+          "address": {"type": "string"}
+        }
+      }
+    },
+    "bgpAdvertised": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["ip", "pool"],
+        "properties": {
+          "ip": {"type": "string"},
+          "pool": {"type": "string"},
+          "services": {"type": "array", "items": {"type": "string"}}
+        }
+      }
+    },
+    "errors": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["phase", "error"],
+        "properties": {
+          "phase": {"type": "string"},
+          "subject": {"type": "string"},
+          "error": {"type": "string"},
+          "class": {"enum": ["config", "api", "backend", "probe"]}
+        }
+      }
+    }
+  }
+}`
+
+// printSchema prints the JSON Schema of the JSON report
+func printSchema() {
+	fmt.Println(reportSchema)
+}
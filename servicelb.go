@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Labels k3s ServiceLB (klipper-lb) puts on its svclb pods
+const (
+	svclbServiceNameLabel      = "svccontroller.k3s.cattle.io/svcname"
+	svclbServiceNamespaceLabel = "svccontroller.k3s.cattle.io/svcnamespace"
+)
+
+// getServiceLBPlacement reports the hosting nodes of each LB IP from the
+// placement of k3s svclb pods. ServiceLB binds the service ports on every node
+// running an svclb pod and publishes those nodes' IPs as the LB IPs, so an IP
+// is hosted by the svclb node that owns it.
+func getServiceLBPlacement(clientset kubernetes.Interface, lbIPs []string) ([][]string, error) {
+	var hostingNodes [][]string
+
+	pods, err := clientset.CoreV1().Pods("").List(context.TODO(), v1.ListOptions{LabelSelector: svclbServiceNameLabel})
+	if err != nil {
+		return hostingNodes, err
+	}
+	if len(pods.Items) == 0 {
+		return hostingNodes, fmt.Errorf("no svclb pods found; is this a k3s cluster with ServiceLB enabled?")
+	}
+
+	wanted := make(map[string]bool)
+	for _, ip := range lbIPs {
+		wanted[ip] = true
+	}
+
+	// Cache node addresses so each node is fetched once
+	nodeAddresses := make(map[string]map[string]bool)
+	seen := make(map[string]bool)
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || pod.Status.Phase != "Running" {
+			continue
+		}
+
+		// Older k3s releases run svclb pods in the service's own namespace
+		svcNamespace := pod.Labels[svclbServiceNamespaceLabel]
+		if svcNamespace == "" {
+			svcNamespace = pod.Namespace
+		}
+		service, err := clientset.CoreV1().Services(svcNamespace).Get(context.TODO(), pod.Labels[svclbServiceNameLabel], v1.GetOptions{})
+		if err != nil {
+			recordError("fetching service for svclb pod "+pod.Name, svcNamespace+"/"+pod.Labels[svclbServiceNameLabel], apiError{err})
+			continue
+		}
+
+		addresses, ok := nodeAddresses[pod.Spec.NodeName]
+		if !ok {
+			addresses = make(map[string]bool)
+			node, err := clientset.CoreV1().Nodes().Get(context.TODO(), pod.Spec.NodeName, v1.GetOptions{})
+			if err != nil {
+				recordError("fetching node", pod.Spec.NodeName, apiError{err})
+				continue
+			}
+			for _, address := range node.Status.Addresses {
+				addresses[address.Address] = true
+			}
+			nodeAddresses[pod.Spec.NodeName] = addresses
+		}
+
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			key := pod.Spec.NodeName + "/" + ingress.IP
+			if wanted[ingress.IP] && addresses[ingress.IP] && !seen[key] {
+				seen[key] = true
+				hostingNodes = append(hostingNodes, []string{pod.Spec.NodeName, ingress.IP})
+			}
+		}
+	}
+
+	return hostingNodes, nil
+}
+
+// compareWithARP returns a warning for every placement that ARP probing did
+// not confirm, and for every ARP owner that the placement did not predict.
+func compareWithARP(placement, arpResults [][]string) []string {
+	if len(arpResults) == 0 {
+		return []string{"ARP cross-check returned no owners; results are based on svclb pod placement only."}
+	}
+
+	fromPlacement := make(map[string]bool)
+	for _, row := range placement {
+		fromPlacement[row[0]+"/"+row[1]] = true
+	}
+	fromARP := make(map[string]bool)
+	for _, row := range arpResults {
+		fromARP[row[0]+"/"+row[1]] = true
+	}
+
+	var warnings []string
+	for _, row := range placement {
+		if !fromARP[row[0]+"/"+row[1]] {
+			warnings = append(warnings, fmt.Sprintf("ARP cross-check did not confirm %s on node %s", row[1], row[0]))
+		}
+	}
+	for _, row := range arpResults {
+		if !fromPlacement[row[0]+"/"+row[1]] {
+			warnings = append(warnings, fmt.Sprintf("ARP shows %s on node %s, which runs no matching svclb pod", row[1], row[0]))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,28 @@
+package main
+
+import "time"
+
+// inventorySnapshot is the node and service inventory of the last daemon
+// cycle that reached the API server. With --use-cache, cycles that find the
+// API server unavailable probe against it instead, as long as it is no
+// older than ttl.
+type inventorySnapshot struct {
+	ttl time.Duration
+
+	taken       time.Time
+	targets     *ipSet
+	cloudLBs    []cloudManagedLB
+	nodes       []string
+	addresses   map[string]string
+	maintenance map[string]string
+}
+
+// save keeps the inventory a cycle read at taken
+func (s *inventorySnapshot) save(targets *ipSet, cloudLBs []cloudManagedLB, nodes []string, addresses map[string]string, taken time.Time) {
+	s.targets, s.cloudLBs, s.nodes, s.addresses, s.maintenance, s.taken = targets, cloudLBs, nodes, addresses, targets.maintenance, taken
+}
+
+// usable reports whether the snapshot may stand in for the API server at now
+func (s *inventorySnapshot) usable(now time.Time) bool {
+	return s.targets != nil && now.Sub(s.taken) <= s.ttl
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// speakerSelectors match the MetalLB speaker pods deployed by the Helm chart
+// and by the plain manifests
+var speakerSelectors = []string{
+	"app.kubernetes.io/name=metallb,app.kubernetes.io/component=speaker",
+	"app=metallb,component=speaker",
+}
+
+// assignSpeakers records the MetalLB speaker pod running on each node. In
+// layer 2 mode the speaker on the node hosting an IP is the one announcing
+// it, so its logs explain why the IP is or isn't there.
+func assignSpeakers(clientset kubernetes.Interface, targets *ipSet) {
+	targets.speakers = make(map[string]string)
+	for _, selector := range speakerSelectors {
+		pods, err := clientset.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			recordError("listing MetalLB speakers", "", apiError{err})
+			return
+		}
+		for _, pod := range pods.Items {
+			if pod.Spec.NodeName != "" && pod.DeletionTimestamp == nil {
+				targets.speakers[pod.Spec.NodeName] = pod.Namespace + "/" + pod.Name
+			}
+		}
+		if len(targets.speakers) > 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sshOptions holds the -o options set by --ssh-strict-host-key-checking and
+// --ssh-known-hosts. They are passed to ssh directly and to every ansible
+// connection, so host key handling does not depend on the environment.
+var sshOptions []string
+
+// setupSSHOptions validates the host key policy flags and fills sshOptions
+func setupSSHOptions(strictHostKeyChecking, knownHosts string) error {
+	if strictHostKeyChecking != "" {
+		if strictHostKeyChecking != "yes" && strictHostKeyChecking != "no" && strictHostKeyChecking != "accept-new" {
+			return fmt.Errorf("invalid host key checking %q (expected yes, no or accept-new)", strictHostKeyChecking)
+		}
+		sshOptions = append(sshOptions, "-o", "StrictHostKeyChecking="+strictHostKeyChecking)
+	}
+	if knownHosts != "" {
+		if _, err := os.Stat(knownHosts); err != nil && strictHostKeyChecking != "accept-new" {
+			return fmt.Errorf("known hosts file: %v", err)
+		}
+		sshOptions = append(sshOptions, "-o", "UserKnownHostsFile="+knownHosts)
+	}
+	return nil
+}
+
+// ansibleSSHArgs passes sshOptions to ansible's ssh connections
+func ansibleSSHArgs() []string {
+	if len(sshOptions) == 0 {
+		return nil
+	}
+	return []string{"--ssh-common-args", strings.Join(sshOptions, " ")}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ssmPollInterval is how often a running SSM command is checked for completion
+const ssmPollInterval = time.Second
+
+// ssmInvocation is the part of `aws ssm get-command-invocation` output we use
+type ssmInvocation struct {
+	Status                string `json:"Status"`
+	ResponseCode          int    `json:"ResponseCode"`
+	StandardOutputContent string `json:"StandardOutputContent"`
+	StandardErrorContent  string `json:"StandardErrorContent"`
+}
+
+// ssmProber runs the arping probe on EC2 instances through SSM Session
+// Manager with the aws CLI, for clusters without SSH access. As with Ansible,
+// a failed arping means the node hosts the IP.
+type ssmProber struct {
+	region    string
+	instances map[string]string
+}
+
+func (p ssmProber) Probe(ctx context.Context, node, iface, ip string) ProbeResult {
+	instanceID, ok := p.instances[node]
+	if !ok {
+		return ProbeResult{Err: fmt.Errorf("node %s has no EC2 instance ID in its provider ID", node)}
+	}
+	invocation, err := p.run(ctx, instanceID, arpingCommand(iface, ip))
+	if err != nil {
+		return ProbeResult{Err: err}
+	}
+	// arping exits 1 when nothing answers, which means the node holds the IP;
+	// anything else is the command failing on the instance
+	switch invocation.ResponseCode {
+	case 0:
+		return ProbeResult{Detail: invocation.Status}
+	case 1:
+		return ProbeResult{Hosted: true, Detail: invocation.Status}
+	}
+	return ProbeResult{Err: fmt.Errorf("SSM command on %s exited %d: %s", instanceID, invocation.ResponseCode, strings.TrimSpace(invocation.StandardErrorContent))}
+}
+
+func (p ssmProber) detectInterface(ctx context.Context, nodes []string) string {
+	invocation, err := p.run(ctx, p.instances[detectionNode(nodes)], interfaceDetectionCommand)
+	if err != nil {
+		logf("error detecting interface through SSM: %v", err)
+		fmt.Printf("%sError detecting interface through SSM: %v%s\n", ColorRed, err, ColorReset)
+		return ""
+	}
+	return parseInterfaceDetection(invocation.StandardOutputContent)
+}
+
+func (p ssmProber) commandLine(node, command string) string {
+	return shellJoin("aws", p.sendArgs(p.instances[node], command)...)
+}
+
+// sendArgs returns the aws CLI arguments that send command to instanceID
+func (p ssmProber) sendArgs(instanceID, command string) []string {
+	parameters, _ := json.Marshal(map[string][]string{"commands": {command}})
+	return p.withRegion([]string{"ssm", "send-command", "--instance-ids", instanceID, "--document-name", "AWS-RunShellScript", "--parameters", string(parameters), "--query", "Command.CommandId", "--output", "text"})
+}
+
+func (p ssmProber) withRegion(args []string) []string {
+	if p.region != "" {
+		args = append(args, "--region", p.region)
+	}
+	return args
+}
+
+// run sends command to instanceID and waits for it to finish
+func (p ssmProber) run(ctx context.Context, instanceID, command string) (ssmInvocation, error) {
+	var invocation ssmInvocation
+	if instanceID == "" {
+		return invocation, fmt.Errorf("no EC2 instance ID to run %q on", command)
+	}
+
+	out, err := runCommand(exec.CommandContext(ctx, "aws", p.sendArgs(instanceID, command)...))
+	if err != nil {
+		return invocation, fmt.Errorf("sending SSM command to %s: %v: %s", instanceID, err, strings.TrimSpace(string(out)))
+	}
+	commandID := strings.TrimSpace(string(out))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return invocation, ctx.Err()
+		case <-time.After(ssmPollInterval):
+		}
+
+		cmd := exec.CommandContext(ctx, "aws", p.withRegion([]string{"ssm", "get-command-invocation", "--command-id", commandID, "--instance-id", instanceID, "--output", "json"})...)
+		out, err := runCommand(cmd)
+		if err != nil {
+			// The invocation is not visible until SSM has dispatched it
+			if strings.Contains(string(out), "InvocationDoesNotExist") {
+				continue
+			}
+			return invocation, fmt.Errorf("reading SSM command %s on %s: %v: %s", commandID, instanceID, err, strings.TrimSpace(string(out)))
+		}
+		if err := json.Unmarshal(out, &invocation); err != nil {
+			return invocation, fmt.Errorf("decoding SSM command %s on %s: %v", commandID, instanceID, err)
+		}
+		switch invocation.Status {
+		case "Pending", "InProgress", "Delayed":
+			continue
+		case "Success", "Failed":
+			return invocation, nil
+		}
+		return invocation, fmt.Errorf("SSM command %s on %s ended with status %s", commandID, instanceID, invocation.Status)
+	}
+}
+
+// getNodeInstanceIDs maps node names to the EC2 instance ID in their provider
+// ID, which has the form aws:///<zone>/<instance-id>.
+func getNodeInstanceIDs(clientset kubernetes.Interface) (map[string]string, error) {
+	nodeList, err := clientset.CoreV1().Nodes().List(context.TODO(), v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make(map[string]string)
+	for _, node := range nodeList.Items {
+		if !strings.HasPrefix(node.Spec.ProviderID, "aws://") {
+			continue
+		}
+		parts := strings.Split(node.Spec.ProviderID, "/")
+		if instanceID := parts[len(parts)-1]; strings.HasPrefix(instanceID, "i-") {
+			instances[node.Name] = instanceID
+		}
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no node has an AWS provider ID")
+	}
+	return instances, nil
+}
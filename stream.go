@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// liveTableRows caps the live table, so it always fits on screen and can be
+// redrawn in place
+const liveTableRows = 20
+
+// resultStreamer prints each node/IP mapping as soon as it is confirmed, so
+// long runs give feedback and partial results survive an interrupted run.
+// Each row is also passed to onResult, if set. A nil streamer discards everything.
+type resultStreamer struct {
+	format   string // table, live, jsonl, log or empty to print nothing
+	progress *progressBar
+	targets  *ipSet
+	onResult func(row []string)
+	started  bool
+	rows     [][]string // rows found so far, for the live table
+}
+
+// streamedResult is a single JSON-lines record
+type streamedResult struct {
+	Time   string `json:"time"`
+	Node   string `json:"node"`
+	IP     string `json:"ip"`
+	Source string `json:"source,omitempty"`
+}
+
+func newResultStreamer(format string, progress *progressBar, targets *ipSet, onResult func(row []string)) *resultStreamer {
+	if format == "" && onResult == nil {
+		return nil
+	}
+	return &resultStreamer{format: format, progress: progress, targets: targets, onResult: onResult}
+}
+
+// emit prints a confirmed hosting node row
+func (s *resultStreamer) emit(row []string) {
+	if s == nil {
+		return
+	}
+	if s.onResult != nil {
+		s.onResult(row)
+	}
+	node, ip := row[0], row[1]
+	source := s.targets.source(ip)
+
+	switch s.format {
+	case "":
+		return
+	case "jsonl":
+		line, err := json.Marshal(streamedResult{Time: time.Now().Format(time.RFC3339), Node: node, IP: ip, Source: source})
+		if err != nil {
+			return
+		}
+		s.progress.println(string(line))
+	case "log":
+		s.progress.println(fmt.Sprintf("%s found %s on %s (%s)", time.Now().Format(time.RFC3339), ip, node, source))
+	case "live":
+		s.rows = append(s.rows, []string{node, ip, source})
+		s.progress.setLive(s.liveTable())
+	default:
+		if !s.started {
+			s.progress.println(fmt.Sprintf("%s%-30s %-18s %s%s", Bold, "NODE NAME", "LOADBALANCER IP", "SOURCE", ColorReset))
+		}
+		s.progress.println(fmt.Sprintf("%s%-30s %-18s %s%s", ColorYellow, node, ip, source, ColorReset))
+	}
+	s.started = true
+}
+
+// liveTable renders the rows found so far as a table, keeping the latest
+// liveTableRows rows
+func (s *resultStreamer) liveTable() []string {
+	rows := s.rows
+	var hidden int
+	if len(rows) > liveTableRows {
+		hidden = len(rows) - liveTableRows
+		rows = rows[hidden:]
+	}
+
+	var buf bytes.Buffer
+	table := newTable(&buf)
+	table.SetHeader([]string{"Node Name", "LoadBalancer IP", "Source"})
+	table.AppendBulk(rows)
+	table.Render()
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if hidden > 0 {
+		lines = append([]string{fmt.Sprintf("... %d earlier results", hidden)}, lines...)
+	}
+	return lines
+}
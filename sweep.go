@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// sweepResult is an address of the swept pool that something answered for.
+// HeldBy names the node holding it, or is empty when every node got an ARP
+// reply, meaning a device outside the cluster answers.
+type sweepResult struct {
+	IP        string `json:"ip"`
+	HeldBy    string `json:"heldBy,omitempty"`
+	Allocated bool   `json:"allocated"`
+	Status    string `json:"status"`
+}
+
+// runSweep ARP-probes every address of the pool from every node. A node
+// cannot arping its own address, so an address nobody answers for looks held
+// by all nodes, one held by a node gets no reply only there, and one held by
+// another device is answered everywhere. Answered addresses that no service
+// is allocated are stray: leftover static assignments or conflicts waiting
+// for MetalLB to allocate onto them. Telling a node's own address from a
+// free one takes at least two reachable nodes. Only the nodes whose probe of
+// an address succeeded vote on it; a failed probe is neither a reply nor
+// the lack of one.
+func runSweep(ctx context.Context, nodes []string, arpInterface string, pool []string, allocated *ipSet, prober Prober, nodeTimeout time.Duration, pacer *probePacer) ([]sweepResult, []string) {
+	progress := newProgressBar(len(nodes))
+	silent := make(map[string][]string)
+	answered := make(map[string]int)
+	var unreachable []string
+	for _, node := range nodes {
+		progress.startNode(node)
+		noReply, replied, ok := sweepNode(ctx, node, arpInterface, pool, prober, nodeTimeout, pacer)
+		if !ok {
+			unreachable = append(unreachable, node)
+		}
+		for _, ip := range noReply {
+			silent[ip] = append(silent[ip], node)
+		}
+		for _, ip := range replied {
+			answered[ip]++
+		}
+		progress.nodeDone()
+	}
+	progress.Stop()
+
+	var results []sweepResult
+	for _, ip := range pool {
+		voters := len(silent[ip]) + answered[ip]
+		if voters == 0 || len(silent[ip]) == voters {
+			continue
+		}
+		_, isAllocated := allocated.sources[ip]
+		result := sweepResult{IP: ip, HeldBy: strings.Join(silent[ip], ", "), Allocated: isAllocated, Status: "allocated"}
+		if !isAllocated {
+			result.Status = "stray"
+		}
+		results = append(results, result)
+	}
+	return results, unreachable
+}
+
+// sweepNode probes every address of the pool from node and returns those
+// that got no ARP reply and those that did. Addresses whose probe failed are
+// in neither. When the node turns out to be unreachable nothing is returned
+// and false is reported.
+func sweepNode(ctx context.Context, node, arpInterface string, pool []string, prober Prober, nodeTimeout time.Duration, pacer *probePacer) ([]string, []string, bool) {
+	var noReply, replied []string
+	for _, ip := range pool {
+		if err := pacer.wait(ctx, node); err != nil {
+			return noReply, replied, true
+		}
+		probeCtx, cancel := ctx, func() {}
+		if nodeTimeout > 0 {
+			probeCtx, cancel = context.WithTimeout(ctx, nodeTimeout)
+		}
+		result := prober.Probe(probeCtx, node, arpInterface, ip)
+		if probeCtx.Err() == context.DeadlineExceeded {
+			result = ProbeResult{Unreachable: true, Err: fmt.Errorf("no answer within %v", nodeTimeout)}
+		}
+		cancel()
+		switch {
+		case result.Unreachable:
+			recordError("connecting to node", node, backendError{result.Err})
+			return nil, nil, false
+		case result.Err != nil:
+			recordError("probing "+ip, node, probeError{result.Err})
+		case result.Hosted:
+			noReply = append(noReply, ip)
+		default:
+			replied = append(replied, ip)
+		}
+	}
+	return noReply, replied, true
+}
+
+// writeSweep prints the answered addresses of a sweep
+func writeSweep(format string, results []sweepResult, unreachable []string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(map[string]interface{}{"metadata": currentRun(), "answered": results, "unreachable": unreachable})
+	case "csv":
+		if err := currentRun().writeCSVComments(os.Stdout); err != nil {
+			return err
+		}
+		fmt.Println("ip,heldBy,allocated,status")
+		for _, result := range results {
+			fmt.Printf("%s,%s,%t,%s\n", result.IP, strings.ReplaceAll(result.HeldBy, ", ", ";"), result.Allocated, result.Status)
+		}
+		return nil
+	}
+
+	if !quiet {
+		fmt.Println("\nAddresses answered in the pool:")
+	}
+	table := newTable(os.Stdout)
+	table.SetHeader([]string{"IP", "Held By", "Allocated", "Status"})
+	for _, result := range results {
+		heldBy := result.HeldBy
+		if heldBy == "" {
+			heldBy = "(device outside the cluster)"
+		}
+		status := result.Status
+		if status == "stray" {
+			status = ColorRed + status + ColorReset
+		}
+		table.Append([]string{result.IP, heldBy, fmt.Sprintf("%t", result.Allocated), status})
+	}
+	table.Render()
+	if len(unreachable) > 0 {
+		fmt.Printf("%sUNREACHABLE (excluded from the sweep): %s%s\n", ColorRed, strings.Join(unreachable, ", "), ColorReset)
+	}
+	printErrors(collectedErrors())
+	printRunFooter(currentRun())
+	return nil
+}
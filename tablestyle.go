@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// tableStyle is the look of every table, set by the --table-* flags
+type tableStyle struct {
+	Border   string // box, markdown or none
+	Align    string // auto, left, center or right
+	AutoWrap bool
+	MaxWidth int // column width above which cells wrap
+	RowLines bool
+}
+
+var tables = tableStyle{Border: "box", Align: "auto", AutoWrap: true, MaxWidth: tablewriter.MAX_ROW_WIDTH}
+
+// tableAlignments maps --table-align to tablewriter's alignments
+var tableAlignments = map[string]int{
+	"auto":   tablewriter.ALIGN_DEFAULT,
+	"left":   tablewriter.ALIGN_LEFT,
+	"center": tablewriter.ALIGN_CENTER,
+	"right":  tablewriter.ALIGN_RIGHT,
+}
+
+// newTable returns a table writing to w in the configured style
+func newTable(w io.Writer) *tablewriter.Table {
+	table := tablewriter.NewWriter(w)
+	table.SetAlignment(tableAlignments[tables.Align])
+	table.SetAutoWrapText(tables.AutoWrap)
+	table.SetColWidth(tables.MaxWidth)
+	table.SetRowLine(tables.RowLines)
+	switch tables.Border {
+	case "markdown":
+		table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+		table.SetCenterSeparator("|")
+	case "none":
+		// Plain columns like kubectl, for terminals that garble box drawing
+		table.SetBorder(false)
+		table.SetHeaderLine(false)
+		table.SetRowLine(false)
+		table.SetCenterSeparator("")
+		table.SetColumnSeparator("")
+		table.SetRowSeparator("")
+		table.SetTablePadding("   ")
+		table.SetNoWhiteSpace(true)
+	}
+	return table
+}
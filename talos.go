@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// talosAddress is the part of a Talos AddressStatus resource we use, as
+// printed by `talosctl get addresses -o json`
+type talosAddress struct {
+	Node string `json:"node"`
+	Spec struct {
+		Address  string `json:"address"`
+		LinkName string `json:"linkName"`
+	} `json:"spec"`
+}
+
+// talosLink is the part of a Talos LinkStatus resource we use, as printed by
+// `talosctl get links -o json`
+type talosLink struct {
+	Node string `json:"node"`
+	Spec struct {
+		HardwareAddr string `json:"hardwareAddr"`
+	} `json:"spec"`
+}
+
+// talosNeighborTable is the kernel neighbor table, which talosctl read can
+// fetch although Talos nodes have no shell
+const talosNeighborTable = "/proc/net/arp"
+
+// runTalosLookup asks the Talos machine API of every node where its LB IPs
+// are, since Talos nodes have no shell to arping from. A node hosts an LB IP
+// assigned to one of its links, as with kube-vip or keepalived. IPs that are
+// only answered for, like MetalLB L2 IPs, are placed from the neighbor tables
+// of the nodes, as with --probe-method neigh: the IP is hosted by the node
+// owning the MAC the other nodes have cached for it. The cached MAC of every
+// such IP is returned as well.
+func runTalosLookup(talosconfig string, nodes []string, nodeAddresses map[string]string, lbIPs []string) ([][]string, map[string]string, error) {
+	var hostingNodes [][]string
+	responders := make(map[string]string)
+
+	// talosctl reports nodes by the address they were contacted on
+	nodeNames := make(map[string]string)
+	var endpoints []string
+	for _, node := range nodes {
+		if address, ok := nodeAddresses[node]; ok {
+			nodeNames[address] = node
+			endpoints = append(endpoints, address)
+		}
+	}
+	if len(endpoints) == 0 {
+		return hostingNodes, responders, fmt.Errorf("no node addresses to reach the Talos API on; check --node-address-type")
+	}
+
+	assigned, err := talosAssignedIPs(talosconfig, endpoints, nodeNames)
+	if err != nil {
+		return hostingNodes, responders, err
+	}
+	nodeMACs, err := talosNodeMACs(talosconfig, endpoints, nodeNames)
+	if err != nil {
+		return hostingNodes, responders, err
+	}
+
+	// Dump the neighbor table of every node; one node failing still leaves
+	// the tables of the others
+	sightings := make(map[string][]neighSighting)
+	for _, endpoint := range endpoints {
+		node := nodeNames[endpoint]
+		out, err := runCommand(exec.Command("talosctl", talosArgs(talosconfig, []string{endpoint}, "read", talosNeighborTable)...))
+		if err != nil {
+			recordError("reading Talos neighbors", node, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out))))
+			continue
+		}
+		for ip, entry := range parseProcNetARP(string(out)) {
+			sightings[ip] = append(sightings[ip], neighSighting{node: node, entry: entry})
+		}
+	}
+
+	for _, ip := range lbIPs {
+		if owners := assigned[ip]; len(owners) > 0 {
+			for _, node := range owners {
+				hostingNodes = append(hostingNodes, []string{node, ip})
+			}
+			continue
+		}
+		if len(sightings[ip]) == 0 {
+			continue
+		}
+		mac, conflict := resolveNeighSightings(sightings[ip])
+		if conflict != nil {
+			recordError("reading Talos neighbors", ip, conflict)
+		}
+		responders[ip] = mac
+		if node, ok := nodeMACs[mac]; ok {
+			hostingNodes = append(hostingNodes, []string{node, ip})
+		}
+	}
+
+	return hostingNodes, responders, nil
+}
+
+// talosAssignedIPs returns the nodes each address is assigned to a link on
+func talosAssignedIPs(talosconfig string, endpoints []string, nodeNames map[string]string) (map[string][]string, error) {
+	out, err := runCommand(exec.Command("talosctl", talosArgs(talosconfig, endpoints, "get", "addresses", "-o", "json")...))
+	if err != nil {
+		return nil, fmt.Errorf("reading Talos addresses: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	assigned := make(map[string][]string)
+	decoder := json.NewDecoder(strings.NewReader(string(out)))
+	for {
+		var address talosAddress
+		if err := decoder.Decode(&address); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("decoding Talos addresses: %v", err)
+		}
+		prefix, err := netip.ParsePrefix(address.Spec.Address)
+		if err != nil {
+			continue
+		}
+		if node, ok := nodeNames[address.Node]; ok && !containsString(assigned[prefix.Addr().String()], node) {
+			assigned[prefix.Addr().String()] = append(assigned[prefix.Addr().String()], node)
+		}
+	}
+	return assigned, nil
+}
+
+// talosNodeMACs maps the MAC of every link of the nodes to its node
+func talosNodeMACs(talosconfig string, endpoints []string, nodeNames map[string]string) (map[string]string, error) {
+	out, err := runCommand(exec.Command("talosctl", talosArgs(talosconfig, endpoints, "get", "links", "-o", "json")...))
+	if err != nil {
+		return nil, fmt.Errorf("reading Talos links: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	nodeMACs := make(map[string]string)
+	decoder := json.NewDecoder(strings.NewReader(string(out)))
+	for {
+		var link talosLink
+		if err := decoder.Decode(&link); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("decoding Talos links: %v", err)
+		}
+		// Loopback and tunnel links have no MAC, or an all-zero one
+		mac := normalizeMAC(link.Spec.HardwareAddr)
+		if node, ok := nodeNames[link.Node]; ok && mac != "" && mac != "00:00:00:00:00:00" {
+			nodeMACs[mac] = node
+		}
+	}
+	return nodeMACs, nil
+}
+
+// parseProcNetARP converts /proc/net/arp into neighbor entries by IP,
+// skipping incomplete ones. The kernel does not report reachability there,
+// so only permanent entries carry a state.
+func parseProcNetARP(out string) map[string]neighEntry {
+	entries := make(map[string]neighEntry)
+	for _, line := range strings.Split(out, "\n") {
+		// IP address  HW type  Flags  HW address  Mask  Device
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		flags, err := strconv.ParseUint(strings.TrimPrefix(fields[2], "0x"), 16, 32)
+		if err != nil || flags&0x2 == 0 {
+			continue
+		}
+		mac := normalizeMAC(fields[3])
+		if _, err := netip.ParseAddr(fields[0]); err != nil || mac == "" || mac == "00:00:00:00:00:00" {
+			continue
+		}
+		entry := neighEntry{Dst: fields[0], Dev: fields[5], LLAddr: mac}
+		if flags&0x4 != 0 {
+			entry.State = []string{"PERMANENT"}
+		}
+		entries[fields[0]] = entry
+	}
+	return entries
+}
+
+// talosArgs returns the talosctl arguments that run command against endpoints
+func talosArgs(talosconfig string, endpoints []string, command ...string) []string {
+	var args []string
+	if talosconfig != "" {
+		args = append(args, "--talosconfig", talosconfig)
+	}
+	args = append(args, "--nodes", strings.Join(endpoints, ","))
+	return append(args, command...)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProcNetARP(t *testing.T) {
+	out := `IP address       HW type     Flags       HW address            Mask     Device
+7.10.20.5        0x1         0x2         52:54:00:AA:BB:01     *        eth0
+7.10.20.6        0x1         0x6         52:54:00:aa:bb:02     *        eth0
+7.10.20.7        0x1         0x0         00:00:00:00:00:00     *        eth0
+7.10.20.8        0x1         0x2         00:00:00:00:00:00     *        eth0
+`
+	want := map[string]neighEntry{
+		"7.10.20.5": {Dst: "7.10.20.5", Dev: "eth0", LLAddr: "52:54:00:aa:bb:01"},
+		"7.10.20.6": {Dst: "7.10.20.6", Dev: "eth0", LLAddr: "52:54:00:aa:bb:02", State: []string{"PERMANENT"}},
+	}
+	if got := parseProcNetARP(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProcNetARP() = %+v, want %+v", got, want)
+	}
+}
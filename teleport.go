@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// teleportProber runs the arping probe on every node with `tsh ssh`, so
+// probes go through Teleport's access controls and session recording. The
+// node name is used as the Teleport host.
+type teleportProber struct {
+	proxy string
+	login string
+}
+
+func (p teleportProber) Probe(ctx context.Context, node, iface, ip string) ProbeResult {
+	out, err := runNamedCommand(node+"_"+ip, exec.CommandContext(ctx, "tsh", p.sshArgs(node, teleportArpingCommand(iface, ip))...))
+	// tsh exits 1 for its own failures too, so the exit status of arping is
+	// read from the line the remote command prints after it
+	m := teleportArpingRC.FindStringSubmatch(string(out))
+	if m == nil {
+		if err == nil {
+			err = errors.New("no arping status in output")
+		}
+		return ProbeResult{Unreachable: true, Err: fmt.Errorf("tsh ssh %s: %v: %s", node, err, strings.TrimSpace(string(out)))}
+	}
+	switch m[1] {
+	case "0":
+		return ProbeResult{}
+	case "1":
+		// nothing answered, so the node holds the IP
+		return ProbeResult{Hosted: true}
+	}
+	return ProbeResult{Err: fmt.Errorf("arping on %s exited %s: %s", node, m[1], strings.TrimSpace(teleportArpingRC.ReplaceAllString(string(out), "")))}
+}
+
+// teleportArpingRC matches the status line printed by teleportArpingCommand
+var teleportArpingRC = regexp.MustCompile(`(?m)^arping-rc=(\d+)\s*$`)
+
+// teleportArpingCommand arpings ip from iface and prints the exit status of
+// arping, which tsh ssh cannot be relied on to pass through
+func teleportArpingCommand(iface, ip string) string {
+	return arpingCommand(iface, ip) + `; echo "arping-rc=$?"`
+}
+
+func (p teleportProber) detectInterface(ctx context.Context, nodes []string) string {
+	node := detectionNode(nodes)
+	out, err := runCommand(exec.CommandContext(ctx, "tsh", p.sshArgs(node, interfaceDetectionCommand)...))
+	if err != nil {
+		logf("error detecting interface through Teleport: %v", err)
+		fmt.Printf("%sError detecting interface through Teleport: %v%s\n", ColorRed, err, ColorReset)
+		return ""
+	}
+	return parseInterfaceDetection(string(out))
+}
+
+func (p teleportProber) commandLine(node, command string) string {
+	return shellJoin("tsh", p.sshArgs(node, command)...)
+}
+
+// sshArgs returns the tsh arguments that run command on node
+func (p teleportProber) sshArgs(node, command string) []string {
+	args := []string{"ssh"}
+	if p.proxy != "" {
+		args = append(args, "--proxy", p.proxy)
+	}
+	if p.login != "" {
+		args = append(args, "-l", p.login)
+	}
+	return append(args, node, command)
+}
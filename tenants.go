@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// assignTenants records the namespaces of the services using each IP, or with
+// tenantLabel the value of that label on those namespaces, so the report can
+// be split into one section per tenant. IPs no service claims, like manual
+// ones and keepalived VIPs, are in no section.
+func assignTenants(clientset kubernetes.Interface, targets *ipSet, tenantLabel string) {
+	var tenantOf map[string]string
+	if tenantLabel != "" {
+		namespaces, err := clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			recordError("listing namespaces", "", apiError{err})
+		} else {
+			tenantOf = make(map[string]string, len(namespaces.Items))
+			for _, namespace := range namespaces.Items {
+				tenantOf[namespace.Name] = namespace.Labels[tenantLabel]
+			}
+		}
+	}
+
+	for _, ip := range targets.ips {
+		targets.tenants[ip] = nil
+		seen := make(map[string]bool)
+		for _, service := range targets.services[ip] {
+			namespace, _, ok := strings.Cut(service, "/")
+			if !ok {
+				continue
+			}
+			tenant := namespace
+			if tenantOf != nil {
+				// Namespaces without the label are in no section
+				if tenant = tenantOf[namespace]; tenant == "" {
+					continue
+				}
+			}
+			if !seen[tenant] {
+				seen[tenant] = true
+				targets.tenants[ip] = append(targets.tenants[ip], tenant)
+			}
+		}
+	}
+}
+
+// printResultsByTenant prints one result table per namespace, or per tenant
+// when byLabel is set. An IP shared by services of several tenants is listed
+// in each of their sections.
+func printResultsByTenant(hostingNodes [][]string, targets *ipSet, wide, byLabel bool) {
+	title, none := "Namespace", "(no namespace)"
+	if byLabel {
+		title, none = "Tenant", "(no tenant)"
+	}
+	printResultSections(hostingNodes, targets, wide, title, none, func(ip string) []string {
+		return targets.tenants[ip]
+	})
+}
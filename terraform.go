@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+)
+
+// terraformOutput is one output of `terraform output -json`, or of the
+// outputs section of a state file
+type terraformOutput struct {
+	Value interface{} `json:"value"`
+}
+
+// readTerraformIPs returns the IPs found in the outputs of a Terraform state
+// file or of `terraform output -json`, limited to the outputs named in only
+// if any. IPs may be plain strings or nested anywhere in list, map and
+// object outputs. Resources in the state are not searched, since they hold
+// node and subnet addresses too.
+func readTerraformIPs(path string, only []string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// A state file wraps the outputs, `terraform output -json` is just them,
+	// and is told apart by its terraform_version string
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	raw := data
+	if version := document["terraform_version"]; len(version) > 0 && version[0] == '"' {
+		raw = document["outputs"]
+	}
+	outputs := make(map[string]terraformOutput)
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &outputs); err != nil {
+			return nil, fmt.Errorf("parsing the outputs of %s: %v", path, err)
+		}
+	}
+
+	names := only
+	if len(names) == 0 {
+		for name := range outputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	var ips []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		output, ok := outputs[name]
+		if !ok {
+			return nil, fmt.Errorf("%s has no output %q", path, name)
+		}
+		collectTerraformIPs(output.Value, seen, &ips)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IP addresses found in the outputs of %s", path)
+	}
+	return ips, nil
+}
+
+// collectTerraformIPs appends every IP in value, in order
+func collectTerraformIPs(value interface{}, seen map[string]bool, ips *[]string) {
+	switch v := value.(type) {
+	case string:
+		if addr, err := netip.ParseAddr(v); err == nil && !seen[addr.String()] {
+			seen[addr.String()] = true
+			*ips = append(*ips, addr.String())
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectTerraformIPs(item, seen, ips)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			collectTerraformIPs(v[key], seen, ips)
+		}
+	}
+}
+
+// unannouncedIPs returns the IPs no node hosts
+func unannouncedIPs(ips []string, hostingNodes [][]string) []string {
+	hosted := make(map[string]bool)
+	for _, row := range hostingNodes {
+		hosted[row[1]] = true
+	}
+	var missing []string
+	for _, ip := range ips {
+		if !hosted[ip] {
+			missing = append(missing, ip)
+		}
+	}
+	return missing
+}
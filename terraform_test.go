@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadTerraformIPs(t *testing.T) {
+	state := `{
+		"version": 4,
+		"terraform_version": "1.9.5",
+		"outputs": {
+			"ingress_ip": {"value": "7.10.20.5", "type": "string"},
+			"lb_ips": {"value": ["7.10.20.6", "not an ip", "7.10.20.5"]},
+			"pools": {"value": {"b": {"ip": "7.10.20.8"}, "a": "7.10.20.7"}}
+		},
+		"resources": [{"instances": [{"attributes": {"private_ip": "10.0.0.1"}}]}]
+	}`
+	outputs := `{"lb_ips": {"sensitive": false, "type": ["list", "string"], "value": ["7.10.20.6"]}}`
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	statePath := write("terraform.tfstate", state)
+
+	tests := []struct {
+		name    string
+		path    string
+		only    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "state file", path: statePath, want: []string{"7.10.20.5", "7.10.20.6", "7.10.20.7", "7.10.20.8"}},
+		{name: "named outputs in order", path: statePath, only: []string{"pools", "ingress_ip"}, want: []string{"7.10.20.7", "7.10.20.8", "7.10.20.5"}},
+		{name: "terraform output -json", path: write("outputs.json", outputs), want: []string{"7.10.20.6"}},
+		{name: "unknown output", path: statePath, only: []string{"missing"}, wantErr: true},
+		{name: "no IPs", path: write("empty.tfstate", `{"terraform_version": "1.9.5", "outputs": {}}`), wantErr: true},
+		{name: "not JSON", path: write("broken.tfstate", "terraform {"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readTerraformIPs(tt.path, tt.only)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readTerraformIPs() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readTerraformIPs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
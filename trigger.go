@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxTriggerIPs caps the IPs one trigger may probe, so a stray /16 can't
+// turn a webhook into a sweep
+const maxTriggerIPs = 256
+
+// triggerRequest names the IPs, CIDRs or ranges a webhook wants probed now
+type triggerRequest struct {
+	IPs []string `json:"ips"`
+}
+
+// triggerResponse is the result of a triggered probe. Unhosted lists the
+// requested IPs no node answered for.
+type triggerResponse struct {
+	Started  time.Time   `json:"started"`
+	Finished time.Time   `json:"finished"`
+	Results  []reportRow `json:"results"`
+	Unhosted []string    `json:"unhosted,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// handleTrigger probes the IPs of a POST /v1/trigger right away and answers
+// with the result once the probe finishes. Callers authenticate with the
+// trigger token as a bearer token.
+func (d *daemon) handleTrigger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(d.triggerToken)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req triggerRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	ips, err := parseIPList(strings.Join(req.IPs, ","))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch {
+	case len(ips) == 0:
+		http.Error(w, "no IPs to probe: set ips", http.StatusBadRequest)
+		return
+	case len(ips) > maxTriggerIPs:
+		http.Error(w, fmt.Sprintf("%d IPs requested, at most %d may be probed per trigger", len(ips), maxTriggerIPs), http.StatusBadRequest)
+		return
+	}
+
+	logf("trigger from %s: probing %s", r.RemoteAddr, strings.Join(ips, ", "))
+	resp := triggerResponse{Started: time.Now(), Results: []reportRow{}}
+	probeErr := d.probe(r.Context(), ips, func(row reportRow) {
+		resp.Results = append(resp.Results, row)
+	})
+	resp.Finished = time.Now()
+	hosted := make(map[string]bool)
+	for _, row := range resp.Results {
+		hosted[row.IP] = true
+	}
+	for _, ip := range ips {
+		if !hosted[ip] {
+			resp.Unhosted = append(resp.Unhosted, ip)
+		}
+	}
+
+	status := http.StatusOK
+	if probeErr != nil {
+		resp.Error = probeErr.Error()
+		status = http.StatusBadGateway
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandleTrigger(t *testing.T) {
+	var probed []string
+	d := &daemon{triggerToken: "s3cret", probe: func(ctx context.Context, ips []string, onResult func(row reportRow)) error {
+		probed = ips
+		for _, ip := range ips {
+			if ip == "7.10.20.5" {
+				onResult(reportRow{Node: "node-1", IP: ip})
+			}
+			if ip == "7.10.20.99" {
+				return errors.New("node-2 unreachable")
+			}
+		}
+		return nil
+	}}
+
+	tests := []struct {
+		name     string
+		method   string
+		token    string
+		body     string
+		status   int
+		probed   []string
+		results  int
+		unhosted []string
+	}{
+		{name: "GET is not allowed", method: http.MethodGet, token: "s3cret", status: http.StatusMethodNotAllowed},
+		{name: "missing token", method: http.MethodPost, body: `{"ips":["7.10.20.5"]}`, status: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodPost, token: "guess", body: `{"ips":["7.10.20.5"]}`, status: http.StatusUnauthorized},
+		{name: "invalid JSON", method: http.MethodPost, token: "s3cret", body: `{"ips":`, status: http.StatusBadRequest},
+		{name: "invalid IP", method: http.MethodPost, token: "s3cret", body: `{"ips":["7.10.20.300"]}`, status: http.StatusBadRequest},
+		{name: "no IPs", method: http.MethodPost, token: "s3cret", body: `{"ips":[]}`, status: http.StatusBadRequest},
+		{name: "too many IPs", method: http.MethodPost, token: "s3cret", body: `{"ips":["7.10.0.0/23"]}`, status: http.StatusBadRequest},
+		{
+			name: "probes the requested range", method: http.MethodPost, token: "s3cret", body: `{"ips":["7.10.20.4-7.10.20.6"]}`,
+			status: http.StatusOK, probed: []string{"7.10.20.4", "7.10.20.5", "7.10.20.6"}, results: 1, unhosted: []string{"7.10.20.4", "7.10.20.6"},
+		},
+		{
+			name: "probe errors are a bad gateway", method: http.MethodPost, token: "s3cret", body: `{"ips":["7.10.20.99"]}`,
+			status: http.StatusBadGateway, probed: []string{"7.10.20.99"}, unhosted: []string{"7.10.20.99"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probed = nil
+			req := httptest.NewRequest(tt.method, "/v1/trigger", strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			d.handleTrigger(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if !reflect.DeepEqual(probed, tt.probed) {
+				t.Errorf("probed %v, want %v", probed, tt.probed)
+			}
+			if tt.probed == nil {
+				return
+			}
+			var resp triggerResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Results) != tt.results || !reflect.DeepEqual(resp.Unhosted, tt.unhosted) {
+				t.Errorf("results %+v, unhosted %v, want %d results, unhosted %v", resp.Results, resp.Unhosted, tt.results, tt.unhosted)
+			}
+			if (tt.status == http.StatusBadGateway) != (resp.Error != "") {
+				t.Errorf("error = %q with status %d", resp.Error, rec.Code)
+			}
+		})
+	}
+}
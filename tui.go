@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// tuiStage is the screen the interactive TUI is currently showing
+type tuiStage int
+
+const (
+	stageContext tuiStage = iota
+	stageUsername
+	stageLoading
+	stageServices
+	stageProbing
+	stageResults
+)
+
+// lbService is a LoadBalancer service offered for selection in the TUI
+type lbService struct {
+	Namespace string
+	Name      string
+	IPs       []string
+}
+
+// clusterLoadedMsg is sent once the selected cluster has been inspected and
+// the inventory written
+type clusterLoadedMsg struct {
+	nodes        []string
+	arpInterface string
+	services     []lbService
+	prober       Prober
+	err          error
+}
+
+// tuiOptions are the command line settings the TUI probes with
+type tuiOptions struct {
+	// NodeAddressType is the node address the inventory reaches nodes at
+	NodeAddressType string
+
+	// ProberSpec selects the prober, as for loadProber
+	ProberSpec string
+
+	// NodeTimeout, if set, bounds each probe
+	NodeTimeout time.Duration
+}
+
+// nodeProbedMsg is sent when every selected IP has been probed from one node
+type nodeProbedMsg struct {
+	node string
+	rows [][]string
+}
+
+type tuiModel struct {
+	stage      tuiStage
+	kubeconfig string
+	opts       tuiOptions
+	err        error
+
+	// Context selection
+	contexts []string
+	cursor   int
+
+	// Ansible username prompt
+	input    textinput.Model
+	username string
+
+	// Cluster state
+	nodes        []string
+	arpInterface string
+	services     []lbService
+	selected     map[int]bool
+	lbIPs        []string
+	targets      *ipSet
+	prober       Prober
+
+	// Probe progress
+	nodeStatus map[string]string
+	probed     int
+	rows       [][]string
+
+	// Results browsing
+	table     table.Model
+	filter    textinput.Model
+	filtering bool
+}
+
+// runTUI runs the interactive terminal UI: pick a context, select services,
+// watch the per-node probes and browse the results.
+func runTUI(kubeconfig string, opts tuiOptions) error {
+	rawConfig, err := loadKubeconfig(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	var contexts []string
+	for name := range rawConfig.Contexts {
+		contexts = append(contexts, name)
+	}
+	if len(contexts) == 0 {
+		return fmt.Errorf("no contexts found in the kubeconfig")
+	}
+	sort.Strings(contexts)
+
+	input := textinput.New()
+	input.Placeholder = "johndoe or johndoe-adm"
+
+	filter := textinput.New()
+	filter.Prompt = "Filter: "
+
+	m := tuiModel{
+		stage:      stageContext,
+		kubeconfig: kubeconfig,
+		opts:       opts,
+		contexts:   contexts,
+		input:      input,
+		filter:     filter,
+		selected:   make(map[int]bool),
+		nodeStatus: make(map[string]string),
+	}
+	for i, name := range contexts {
+		if name == rawConfig.CurrentContext {
+			m.cursor = i
+		}
+	}
+
+	_, err = tea.NewProgram(m, tea.WithAltScreen()).Run()
+
+	// Remove the inventory file once the UI is closed
+	if rmErr := removeInventoryFile(); rmErr != nil && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case clusterLoadedMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.nodes, m.arpInterface, m.services, m.prober = msg.nodes, msg.arpInterface, msg.services, msg.prober
+		m.stage, m.cursor = stageServices, 0
+		return m, nil
+
+	case nodeProbedMsg:
+		m.nodeStatus[msg.node] = "done"
+		m.rows = append(m.rows, msg.rows...)
+		m.probed++
+		if m.probed < len(m.nodes) {
+			return m, m.probeNextNode()
+		}
+		m.stage = stageResults
+		m.table = table.New(
+			table.WithColumns([]table.Column{
+				{Title: "Node Name", Width: 30},
+				{Title: "LoadBalancer IP", Width: 18},
+				{Title: "Source", Width: 20},
+			}),
+			table.WithFocused(true),
+			table.WithHeight(15),
+		)
+		m.applyFilter()
+		return m, nil
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		return m.handleKey(msg)
+	}
+
+	return m, nil
+}
+
+func (m tuiModel) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch m.stage {
+	case stageContext:
+		switch msg.String() {
+		case "q":
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.contexts)-1 {
+				m.cursor++
+			}
+		case "enter":
+			m.stage = stageUsername
+			m.input.Focus()
+		}
+
+	case stageUsername:
+		if msg.String() == "enter" && strings.TrimSpace(m.input.Value()) != "" {
+			m.username = strings.TrimSpace(m.input.Value())
+			m.stage = stageLoading
+			return m, loadCluster(m.kubeconfig, m.contexts[m.cursor], m.username, m.opts)
+		}
+		m.input, cmd = m.input.Update(msg)
+
+	case stageServices:
+		switch msg.String() {
+		case "q":
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.services)-1 {
+				m.cursor++
+			}
+		case " ":
+			m.selected[m.cursor] = !m.selected[m.cursor]
+		case "a":
+			selected := 0
+			for _, on := range m.selected {
+				if on {
+					selected++
+				}
+			}
+			all := selected != len(m.services)
+			m.selected = make(map[int]bool)
+			if all {
+				for i := range m.services {
+					m.selected[i] = true
+				}
+			}
+		case "enter":
+			m.targets = newIPSet()
+			for i, service := range m.services {
+				if !m.selected[i] {
+					continue
+				}
+				for _, ip := range service.IPs {
+					m.targets.add(ip, fmt.Sprintf("%s/%s", service.Namespace, service.Name))
+				}
+			}
+			m.lbIPs = m.targets.ips
+			if len(m.lbIPs) == 0 || len(m.nodes) == 0 {
+				m.err = fmt.Errorf("select at least one service with a LoadBalancer IP")
+				return m, nil
+			}
+			m.err = nil
+			m.stage = stageProbing
+			for _, node := range m.nodes {
+				m.nodeStatus[node] = "pending"
+			}
+			return m, m.probeNextNode()
+		}
+
+	case stageResults:
+		if m.filtering {
+			switch msg.String() {
+			case "esc", "enter":
+				m.filtering = false
+				m.filter.Blur()
+				m.table.Focus()
+			default:
+				m.filter, cmd = m.filter.Update(msg)
+				m.applyFilter()
+			}
+			return m, cmd
+		}
+		switch msg.String() {
+		case "q":
+			return m, tea.Quit
+		case "/":
+			m.filtering = true
+			m.table.Blur()
+			m.filter.Focus()
+		default:
+			m.table, cmd = m.table.Update(msg)
+		}
+	}
+
+	return m, cmd
+}
+
+// probeNextNode marks the next node as probing and returns the command probing it
+func (m tuiModel) probeNextNode() tea.Cmd {
+	node := m.nodes[m.probed]
+	m.nodeStatus[node] = "probing"
+	arpInterface, lbIPs, prober, nodeTimeout := m.arpInterface, m.lbIPs, m.prober, m.opts.NodeTimeout
+	return func() tea.Msg {
+		rows, _ := runARPCommandOnNode(context.Background(), node, arpInterface, lbIPs, prober, nodeTimeout, nil, nil, nil)
+		return nodeProbedMsg{node: node, rows: rows}
+	}
+}
+
+// applyFilter refreshes the result table with the rows matching the filter
+func (m *tuiModel) applyFilter() {
+	query := strings.ToLower(m.filter.Value())
+	var rows []table.Row
+	for _, row := range m.rows {
+		full := append(append([]string{}, row...), m.targets.source(row[1]))
+		if query == "" || strings.Contains(strings.ToLower(strings.Join(full, " ")), query) {
+			rows = append(rows, table.Row(full))
+		}
+	}
+	m.table.SetRows(rows)
+}
+
+func (m tuiModel) View() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%sLoadBalancer IP finder%s\n\n", Bold, ColorReset)
+
+	switch m.stage {
+	case stageContext:
+		b.WriteString("Select a cluster context:\n\n")
+		for i, name := range m.contexts {
+			cursor := "  "
+			if i == m.cursor {
+				cursor = ColorGreen + "> " + ColorReset
+			}
+			fmt.Fprintf(&b, "%s%s\n", cursor, name)
+		}
+		b.WriteString("\n↑/↓ move • enter select • q quit\n")
+
+	case stageUsername:
+		fmt.Fprintf(&b, "Context: %s%s%s\n\n", ColorGreen, m.contexts[m.cursor], ColorReset)
+		b.WriteString("Enter the Ansible username to run ARP command:\n\n")
+		b.WriteString(m.input.View())
+		b.WriteString("\n\nenter continue • ctrl+c quit\n")
+
+	case stageLoading:
+		b.WriteString("Discovering nodes, interface and LoadBalancer services...\n")
+
+	case stageServices:
+		fmt.Fprintf(&b, "Interface: %s%s%s • Nodes: %d\n\n", ColorGreen, m.arpInterface, ColorReset, len(m.nodes))
+		b.WriteString("Select the services to probe:\n\n")
+		for i, service := range m.services {
+			cursor := "  "
+			if i == m.cursor {
+				cursor = ColorGreen + "> " + ColorReset
+			}
+			check := "[ ]"
+			if m.selected[i] {
+				check = "[x]"
+			}
+			fmt.Fprintf(&b, "%s%s %s/%s  %s%s%s\n", cursor, check, service.Namespace, service.Name, ColorYellow, strings.Join(service.IPs, ", "), ColorReset)
+		}
+		b.WriteString("\n↑/↓ move • space toggle • a all • enter probe • q quit\n")
+
+	case stageProbing:
+		fmt.Fprintf(&b, "Probing %d IP(s) on %d node(s): %d/%d done\n\n", len(m.lbIPs), len(m.nodes), m.probed, len(m.nodes))
+		for _, node := range m.nodes {
+			status := m.nodeStatus[node]
+			color := ColorWhite
+			switch status {
+			case "probing":
+				color = ColorYellow
+			case "done":
+				color = ColorGreen
+			}
+			fmt.Fprintf(&b, "  %s%-8s%s %s\n", color, status, ColorReset, node)
+		}
+
+	case stageResults:
+		b.WriteString(m.table.View())
+		b.WriteString("\n")
+		if m.filtering || m.filter.Value() != "" {
+			b.WriteString(m.filter.View())
+			b.WriteString("\n")
+		}
+		b.WriteString("\n↑/↓ scroll • / filter • q quit\n")
+	}
+
+	if m.err != nil {
+		fmt.Fprintf(&b, "\n%sError: %v%s\n", ColorRed, m.err, ColorReset)
+	}
+	return b.String()
+}
+
+// loadCluster connects to the chosen context, writes the inventory, loads
+// the prober, detects the ARP interface and lists the LoadBalancer services
+// available to probe.
+func loadCluster(kubeconfig, contextName, username string, opts tuiOptions) tea.Cmd {
+	return func() tea.Msg {
+		config, err := contextRESTConfig(kubeconfig, contextName)
+		if err != nil {
+			return clusterLoadedMsg{err: fmt.Errorf("loading context %s: %v", contextName, err)}
+		}
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return clusterLoadedMsg{err: fmt.Errorf("creating Kubernetes client: %v", err)}
+		}
+
+		nodes, addresses, roles, err := getAllNodes(clientset, opts.NodeAddressType)
+		if err != nil {
+			return clusterLoadedMsg{err: fmt.Errorf("fetching nodes: %v", err)}
+		}
+		if err := createInventoryFile(nodes, addresses, roles, username); err != nil {
+			return clusterLoadedMsg{err: fmt.Errorf("creating inventory file: %v", err)}
+		}
+		prober, err := loadProber(opts.ProberSpec, username)
+		if err != nil {
+			return clusterLoadedMsg{err: fmt.Errorf("loading prober: %v", err)}
+		}
+		// Mixed fleets run different arping variants with different flags
+		if arping, ok := prober.(arpingProber); ok {
+			arping.flavors = detectArpingFlavors(username)
+			prober = arping
+		}
+		arpInterface := getInterfaceNameStartingWithSeven()
+		if arpInterface == "" {
+			return clusterLoadedMsg{err: fmt.Errorf("failed to retrieve network interface starting with '7'")}
+		}
+
+		services, err := getLoadBalancerServices(clientset)
+		if err != nil {
+			return clusterLoadedMsg{err: fmt.Errorf("fetching services: %v", err)}
+		}
+		return clusterLoadedMsg{nodes: nodes, arpInterface: arpInterface, services: services, prober: prober}
+	}
+}
+
+// getLoadBalancerServices lists the LoadBalancer services that have at least
+// one probeable IP, skipping cloud-managed load balancers.
+func getLoadBalancerServices(clientset kubernetes.Interface) ([]lbService, error) {
+	services, err := clientset.CoreV1().Services("").List(context.TODO(), v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var lbServices []lbService
+	for _, service := range services.Items {
+		if service.Spec.Type != "LoadBalancer" || getCloudProvider(service) != "" {
+			continue
+		}
+		var ips []string
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if strings.HasPrefix(ingress.IP, "7") {
+				ips = append(ips, ingress.IP)
+			}
+		}
+		if len(ips) > 0 {
+			lbServices = append(lbServices, lbService{Namespace: service.Namespace, Name: service.Name, IPs: ips})
+		}
+	}
+	return lbServices, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// udpProbeTimeout is how long a UDP port is given to answer
+const udpProbeTimeout = 2 * time.Second
+
+// probeUDPPort sends an empty datagram to ip:port. A reply means open, an
+// ICMP port unreachable means closed, and silence is the usual UDP
+// open|filtered, since most UDP services ignore unexpected datagrams.
+func probeUDPPort(ip string, port int32) string {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(ip, strconv.Itoa(int(port))), udpProbeTimeout)
+	if err != nil {
+		return "error"
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(udpProbeTimeout))
+
+	if _, err := conn.Write([]byte{}); err != nil {
+		return "error"
+	}
+	buf := make([]byte, 1)
+	_, err = conn.Read(buf)
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return "open"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "closed"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "open|filtered"
+	}
+	return "error"
+}
+
+// runUDPProbes probes the UDP ports of every target and records the outcome
+// on the target set, like "53/UDP open|filtered". Only the exposed ports of
+// the services sharing each IP are probed.
+func runUDPProbes(targets *ipSet) {
+	for _, ip := range targets.ips {
+		var results []string
+		for _, port := range targets.ports[ip] {
+			if port.Protocol != "UDP" {
+				continue
+			}
+			state := probeUDPPort(ip, port.Port)
+			logf("UDP probe of %s:%d: %s", ip, port.Port, state)
+			results = append(results, fmt.Sprintf("%d/UDP %s", port.Port, state))
+		}
+		if len(results) > 0 {
+			targets.udpProbes[ip] = strings.Join(results, ", ")
+		}
+	}
+}
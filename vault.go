@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// vaultTimeout bounds the request for SSH credentials
+const vaultTimeout = 10 * time.Second
+
+// vaultSecret is the part of a Vault read response we use. KV version 2
+// nests the secret's fields in a second data object.
+type vaultSecret struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+// setupVaultSSHCredentials reads the SSH private key (field private_key) and
+// optional signed certificate (field certificate or signed_key) stored at path
+// in Vault, writes them to a private temporary directory and adds them to
+// sshOptions. The token comes from VAULT_TOKEN or ~/.vault-token. The returned
+// cleanup removes the credentials again.
+func setupVaultSSHCredentials(addr, path string) (func(), error) {
+	token, err := vaultToken()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	client := &http.Client{Timeout: vaultTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("reading %s: %s", path, resp.Status)
+	}
+
+	var secret vaultSecret
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", path, err)
+	}
+	fields := secret.Data
+	if nested, ok := fields["data"].(map[string]interface{}); ok {
+		fields = nested
+	}
+	privateKey, _ := fields["private_key"].(string)
+	if privateKey == "" {
+		return nil, fmt.Errorf("secret %s has no private_key field", path)
+	}
+	certificate, _ := fields["certificate"].(string)
+	if certificate == "" {
+		certificate, _ = fields["signed_key"].(string)
+	}
+
+	dir, err := os.MkdirTemp("", "get_loadBalancerIP-ssh-")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	keyPath := filepath.Join(dir, "id")
+	if err := os.WriteFile(keyPath, []byte(strings.TrimSpace(privateKey)+"\n"), 0600); err != nil {
+		cleanup()
+		return nil, err
+	}
+	sshOptions = append(sshOptions, "-o", "IdentityFile="+keyPath, "-o", "IdentitiesOnly=yes")
+	if certificate != "" {
+		certPath := filepath.Join(dir, "id-cert.pub")
+		if err := os.WriteFile(certPath, []byte(strings.TrimSpace(certificate)+"\n"), 0600); err != nil {
+			cleanup()
+			return nil, err
+		}
+		sshOptions = append(sshOptions, "-o", "CertificateFile="+certPath)
+	}
+	logf("loaded SSH credentials from vault path %s", path)
+	return cleanup, nil
+}
+
+// vaultToken returns the Vault token the way the vault CLI finds it
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	home, err := os.UserHomeDir()
+	if err == nil {
+		if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
+	}
+	return "", fmt.Errorf("no Vault token: set VAULT_TOKEN or log in with the vault CLI")
+}